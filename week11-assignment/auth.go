@@ -0,0 +1,97 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ===================== Acting User =====================
+// week11 ไม่มี login ของตัวเอง ใช้ access token ที่ออกโดย week13-lab6 (secret เดียวกัน)
+// เพื่อให้รู้ว่าใครเป็นผู้แก้ไข ใช้กับ trigger record_book_revision และ audit_logs ร่วมกับ week13
+
+var jwtSecret = []byte(getEnv("JWT_SECRET", "my-super-secret-key-change-in-production-2024"))
+
+// actingClaims ต้องตรงกับ CustomClaims ใน week13-lab6/main.go
+type actingClaims struct {
+	UserID   int      `json:"user_id"`
+	Username string   `json:"username"`
+	Roles    []string `json:"roles"`
+	jwt.RegisteredClaims
+}
+
+func verifyToken(tokenString string) (*actingClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &actingClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return jwtSecret, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(*actingClaims)
+	if !ok || !token.Valid || claims.UserID == 0 {
+		return nil, fmt.Errorf("invalid token")
+	}
+	return claims, nil
+}
+
+// optionalActingUser stores the user of a week13 access token in the
+// context as "user_id". week11 writes are open to anonymous clients (the
+// storefront sends no token), so a request without one passes with no
+// acting user; only a token that is sent but invalid is rejected.
+func optionalActingUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if header == "" {
+			c.Next()
+			return
+		}
+		tokenString, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid authorization header format"})
+			c.Abort()
+			return
+		}
+		claims, err := verifyToken(tokenString)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+			c.Abort()
+			return
+		}
+		c.Set("user_id", claims.UserID)
+		c.Next()
+	}
+}
+
+// setActingUser บอก trigger record_book_revision (migration 010) ว่าใครเป็นผู้แก้ไข
+// มีผลเฉพาะใน transaction นี้ userID 0 (ไม่มี token) ส่งเป็นค่าว่าง ให้ trigger บันทึก changed_by เป็น NULL
+func setActingUser(tx *sql.Tx, userID int) error {
+	value := ""
+	if userID != 0 {
+		value = strconv.Itoa(userID)
+	}
+	_, err := tx.Exec("SELECT set_config('app.user_id', $1, true)", value)
+	return err
+}
+
+// logAudit writes an audit_logs entry (table from week13-lab6) inside tx,
+// so the entry is only kept if the change itself commits. userID 0 is
+// stored as NULL.
+func logAudit(tx *sql.Tx, c *gin.Context, userID int, action, resource, resourceID string) error {
+	var user interface{}
+	if userID != 0 {
+		user = userID
+	}
+	_, err := tx.Exec(`
+		INSERT INTO audit_logs (user_id, action, resource, resource_id, ip_address, user_agent)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, user, action, resource, resourceID, c.ClientIP(), c.GetHeader("User-Agent"))
+	return err
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+type Author struct {
+	ID        int      `json:"id"`
+	Name      string   `json:"name"`
+	Aliases   []string `json:"aliases"`
+	Bio       string   `json:"bio,omitempty"`
+	BookCount int      `json:"book_count"`
+}
+
+// AuthorRef is the short form of an author embedded in a Book.
+type AuthorRef struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// authorSeparator แยกผู้แต่งร่วม กติกาเดียวกับ migration 007
+var authorSeparator = regexp.MustCompile(`(?i)\s+and\s+|\s*[,&]\s*`)
+
+// authorAliasVector is the tsvector of an author's aliases (alias "a"),
+// built like books.search_vector so the same tsquery matches both.
+const authorAliasVector = `(to_tsvector('english', array_to_string(a.aliases, ' ')) ||
+	to_tsvector('simple', thai_bigrams(array_to_string(a.aliases, ' '))))`
+
+func splitAuthors(author string) []string {
+	var names []string
+	for _, name := range authorSeparator.Split(author, -1) {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// linkBookAuthors rebuilds book_authors for a book from its author string.
+func linkBookAuthors(tx *sql.Tx, bookID int, author string) error {
+	if _, err := tx.Exec("DELETE FROM book_authors WHERE book_id = $1", bookID); err != nil {
+		return err
+	}
+
+	for i, name := range splitAuthors(author) {
+		var authorID int
+		// DO UPDATE (ไม่ใช่ DO NOTHING) เพื่อให้ RETURNING คืน id ของแถวเดิมได้
+		err := tx.QueryRow(`
+			INSERT INTO authors (name) VALUES ($1)
+			ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+			RETURNING id
+		`, name).Scan(&authorID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO book_authors (book_id, author_id, author_order)
+			VALUES ($1, $2, $3)
+			ON CONFLICT DO NOTHING
+		`, bookID, authorID, i+1)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolvePublisher returns the id of the named publisher, adding it if it
+// is new, or nil for an empty name. Callers write the id in the same
+// statement as the rest of the book so a save is recorded as one revision.
+func resolvePublisher(tx *sql.Tx, publisher string) (*int, error) {
+	if publisher = strings.TrimSpace(publisher); publisher == "" {
+		return nil, nil
+	}
+	var id int
+	err := tx.QueryRow(`
+		INSERT INTO publishers (name) VALUES ($1)
+		ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+		RETURNING id
+	`, publisher).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// bookAuthors returns a book's authors in credit order.
+func bookAuthors(bookID int) ([]AuthorRef, error) {
+	rows, err := db.Query(`
+		SELECT a.id, a.name
+		FROM book_authors ba
+		JOIN authors a ON a.id = ba.author_id
+		WHERE ba.book_id = $1
+		ORDER BY ba.author_order
+	`, bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	authors := []AuthorRef{}
+	for rows.Next() {
+		var a AuthorRef
+		if err := rows.Scan(&a.ID, &a.Name); err != nil {
+			return nil, err
+		}
+		authors = append(authors, a)
+	}
+	return authors, rows.Err()
+}
+
+// @Summary Get author by ID
+// @Tags Authors
+// @Produce json
+// @Param id path int true "Author ID"
+// @Success 200 {object} Author
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/authors/{id} [get]
+func getAuthor(c *gin.Context) {
+	var author Author
+	err := db.QueryRow(`
+		SELECT a.id, a.name, a.aliases, COALESCE(a.bio, ''),
+		       (SELECT COUNT(*) FROM book_authors ba JOIN books b ON b.id = ba.book_id
+		        WHERE ba.author_id = a.id AND b.deleted_at IS NULL)
+		FROM authors a
+		WHERE a.id = $1
+	`, c.Param("id")).Scan(&author.ID, &author.Name, pq.Array(&author.Aliases), &author.Bio, &author.BookCount)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "author not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if author.Aliases == nil {
+		author.Aliases = []string{}
+	}
+	c.JSON(http.StatusOK, author)
+}
+
+// @Summary Get books by author
+// @Tags Authors
+// @Produce json
+// @Param id path int true "Author ID"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param cursor query string false "Cursor from previous page's next_cursor"
+// @Param sort query string false "price, rating, year, title, created_at (default year)"
+// @Param order query string false "asc or desc (default desc)"
+// @Success 200 {object} BookPage
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/authors/{id}/books [get]
+func getAuthorBooks(c *gin.Context) {
+	listBooksOf(c, "authors", "author not found",
+		"id IN (SELECT book_id FROM book_authors WHERE author_id = %s)")
+}
+
+// @Summary Get books by publisher
+// @Tags Publishers
+// @Produce json
+// @Param id path int true "Publisher ID"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param cursor query string false "Cursor from previous page's next_cursor"
+// @Param sort query string false "price, rating, year, title, created_at (default year)"
+// @Param order query string false "asc or desc (default desc)"
+// @Success 200 {object} BookPage
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/publishers/{id}/books [get]
+func getPublisherBooks(c *gin.Context) {
+	listBooksOf(c, "publishers", "publisher not found", "publisher_id = %s")
+}
+
+// listBooksOf pages through the books belonging to the :id row of table.
+// cond is a WHERE condition with one %s for the bound id.
+func listBooksOf(c *gin.Context, table, notFound, cond string) {
+	var id int
+	err := db.QueryRow("SELECT id FROM "+table+" WHERE id = $1", c.Param("id")).Scan(&id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	p, err := parsePageParams(c, bookSortFields, "year", "desc")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	q := newBookQuery()
+	if err := applyBookFilters(c, q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	q.add(strings.Replace(cond, "%s", q.arg(id), 1))
+
+	page, err := fetchBookPage(q, p)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// categorySlug normalizes a category name the same way migration 006 did,
+// so "Non Fiction", "non-fiction" and "NON-FICTION" all map to one row.
+func categorySlug(name string) string {
+	return strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(strings.TrimSpace(name)), "-"), "-")
+}
+
+// resolveCategory looks up the category for a book and rewrites *category
+// to its canonical slug. An empty category leaves the book uncategorized.
+func resolveCategory(category *string) (*int, error) {
+	slug := categorySlug(*category)
+	if slug == "" {
+		*category = ""
+		return nil, nil
+	}
+
+	var id int
+	err := db.QueryRow("SELECT id FROM categories WHERE slug = $1", slug).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("unknown category: %s", *category)
+	} else if err != nil {
+		return nil, err
+	}
+
+	*category = slug
+	return &id, nil
+}
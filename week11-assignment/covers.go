@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxCoverPixels = 40_000_000 // กันไฟล์เล็กที่ขยายแล้วกินหน่วยความจำมหาศาล (decompression bomb)
+	coverCacheAge  = 365 * 24 * 60 * 60
+)
+
+// coverThumbnailWidths are the generated sizes, keyed by the name used in
+// Book.CoverThumbnails and in the object key (w160.jpg, ...).
+var coverThumbnailWidths = []struct {
+	name  string
+	width int
+}{
+	{"small", 160},
+	{"medium", 320},
+	{"large", 640},
+}
+
+// coverExtensions are the upload types we accept, by sniffed content type.
+var coverExtensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+var covers coverStorage
+
+// coverURLPrefix is prepended to object keys in Book.CoverImage. Set
+// COVER_PUBLIC_URL to a CDN or the API's absolute URL when the frontend
+// runs on another origin.
+func coverURLPrefix() string {
+	return strings.TrimRight(getEnv("COVER_PUBLIC_URL", "/api/v1/covers"), "/") + "/"
+}
+
+func coverMaxBytes() int64 {
+	n, err := strconv.ParseInt(getEnv("COVER_MAX_BYTES", "5242880"), 10, 64)
+	if err != nil || n <= 0 {
+		return 5 << 20
+	}
+	return n
+}
+
+// coverKeys returns the object keys of an uploaded cover, original first.
+// Covers baked into the frontend (/images/books/...) have none.
+func coverKeys(coverImage string) []string {
+	key, ok := strings.CutPrefix(coverImage, coverURLPrefix())
+	if !ok {
+		return nil
+	}
+	dir, file, _ := strings.Cut(key, "/original.")
+	if file == "" {
+		return nil
+	}
+	keys := []string{key}
+	for _, t := range coverThumbnailWidths {
+		keys = append(keys, fmt.Sprintf("%s/w%d.jpg", dir, t.width))
+	}
+	return keys
+}
+
+// coverThumbnails maps thumbnail names to URLs for an uploaded cover.
+func coverThumbnails(coverImage string) map[string]string {
+	keys := coverKeys(coverImage)
+	if keys == nil {
+		return nil
+	}
+	thumbs := map[string]string{}
+	for i, t := range coverThumbnailWidths {
+		thumbs[t.name] = coverURLPrefix() + keys[i+1]
+	}
+	return thumbs
+}
+
+// ===================== Image processing =====================
+
+// flatten draws img onto a white RGBA canvas so transparent PNG/GIF covers
+// become JPEG-safe, and gives resizeToWidth direct access to pixels.
+func flatten(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+	return dst
+}
+
+// resizeToWidth downsamples src with a box filter (average of the source
+// pixels each target pixel covers), keeping the aspect ratio. Images that are
+// already narrower are returned as is; covers are never upscaled.
+func resizeToWidth(src *image.RGBA, width int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	if width >= sw {
+		return src
+	}
+	height := max(1, sh*width/sw)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sh/height, max((y+1)*sh/height, y*sh/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sw/width, max((x+1)*sw/width, x*sw/width+1)
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r, g, b, a = r+int(p[0]), g+int(p[1]), b+int(p[2]), a+int(p[3])
+					n++
+				}
+			}
+			i := y*dst.Stride + x*4
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return dst
+}
+
+// coverObject is one file to store for an upload.
+type coverObject struct {
+	key         string
+	data        []byte
+	contentType string
+}
+
+// buildCoverObjects decodes data and returns the original plus one JPEG per
+// thumbnail width. Keys include a hash of the upload so every new cover gets
+// new URLs and old ones can stay cached.
+func buildCoverObjects(bookID int, data []byte, contentType string) ([]coverObject, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read image: %v", err)
+	}
+	if cfg.Width*cfg.Height > maxCoverPixels {
+		return nil, fmt.Errorf("image is too large (%dx%d), max %d pixels", cfg.Width, cfg.Height, maxCoverPixels)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read image: %v", err)
+	}
+
+	sum := sha256.Sum256(data)
+	dir := fmt.Sprintf("%d/%s", bookID, hex.EncodeToString(sum[:8]))
+	objects := []coverObject{{
+		key:         fmt.Sprintf("%s/original.%s", dir, coverExtensions[contentType]),
+		data:        data,
+		contentType: contentType,
+	}}
+
+	flat := flatten(img)
+	for _, t := range coverThumbnailWidths {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, resizeToWidth(flat, t.width), &jpeg.Options{Quality: 85}); err != nil {
+			return nil, err
+		}
+		objects = append(objects, coverObject{
+			key:         fmt.Sprintf("%s/w%d.jpg", dir, t.width),
+			data:        buf.Bytes(),
+			contentType: "image/jpeg",
+		})
+	}
+	return objects, nil
+}
+
+// deleteCoverObjects removes keys in the background. A failure only leaves
+// orphaned files behind, so it is logged and not reported to the client.
+func deleteCoverObjects(keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	go func() {
+		for _, key := range keys {
+			if err := covers.Delete(context.Background(), key); err != nil {
+				log.Printf("cover cleanup %s: %v", key, err)
+			}
+		}
+	}()
+}
+
+// ===================== Handlers =====================
+
+// @Summary Upload book cover
+// @Description Upload a JPEG, PNG or GIF cover (multipart field "cover"). The original is stored with small/medium/large JPEG thumbnails and coverImage is updated.
+// @Tags Books
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path int true "Book ID"
+// @Param cover formData file true "Cover image"
+// @Param If-Match header string false "ETag from GET /books/{id}"
+// @Success 200 {object} Book
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 412 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 415 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /books/{id}/cover [post]
+func uploadCover(c *gin.Context) {
+	id := c.Param("id")
+	maxBytes := coverMaxBytes()
+
+	// เผื่อที่ให้ header ของ multipart อีกเล็กน้อย
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+64<<10)
+	fileHeader, err := c.FormFile("cover")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("cover must be at most %d bytes", maxBytes)})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "multipart field \"cover\" is required"})
+		return
+	}
+	if fileHeader.Size > maxBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("cover must be at most %d bytes", maxBytes)})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// ไม่เชื่อ Content-Type ที่ client ส่งมา ดูจากเนื้อไฟล์จริง
+	contentType := http.DetectContentType(data)
+	if _, ok := coverExtensions[contentType]; !ok {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "cover must be a JPEG, PNG or GIF image, got " + contentType})
+		return
+	}
+
+	bookID, err := strconv.Atoi(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "book not found"})
+		return
+	}
+
+	// ย่อรูปก่อนเปิด transaction จะได้ไม่ล็อกแถวของหนังสือนาน
+	objects, err := buildCoverObjects(bookID, data, contentType)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	book, ok := lockBook(c, tx, id)
+	if !ok {
+		return
+	}
+
+	var stored []string
+	for _, obj := range objects {
+		if err := covers.Put(c.Request.Context(), obj.key, obj.data, obj.contentType); err != nil {
+			deleteCoverObjects(stored)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		stored = append(stored, obj.key)
+	}
+
+	oldKeys := coverKeys(book.CoverImage)
+	coverImage := coverURLPrefix() + objects[0].key
+	err = tx.QueryRow(`
+		UPDATE books SET cover_image = $1, updated_at = NOW(), version = version + 1
+		WHERE id = $2
+		RETURNING updated_at, version
+	`, coverImage, book.ID).Scan(&book.Updated_At, &book.Version)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		deleteCoverObjects(stored)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// อัปโหลดไฟล์เดิมซ้ำได้ key เดิม อย่าลบของที่เพิ่งเขียน
+	if oldKeys != nil && oldKeys[0] != objects[0].key {
+		deleteCoverObjects(oldKeys)
+	}
+
+	book.CoverImage = coverImage
+	book.CoverThumbnails = coverThumbnails(coverImage)
+	if book.Authors, err = bookAuthors(book.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("ETag", bookETag(book))
+	c.JSON(http.StatusOK, book)
+}
+
+// @Summary Get cover image
+// @Description Serve an uploaded cover or thumbnail. URLs are content-addressed and cached for a year.
+// @Tags Books
+// @Produce image/jpeg
+// @Produce image/png
+// @Produce image/gif
+// @Param key path string true "Object key, e.g. 12/ab34cd56ef78ab90/w320.jpg"
+// @Success 200 {file} file
+// @Success 304
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /covers/{key} [get]
+func getCover(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	etag := `"` + strings.ReplaceAll(key, "/", "-") + `"`
+	cacheControl := fmt.Sprintf("public, max-age=%d, immutable", coverCacheAge)
+
+	// key มี hash ของไฟล์อยู่แล้ว key เดิม = ไฟล์เดิมเสมอ ไม่ต้องอ่านจาก storage
+	if inm := c.GetHeader("If-None-Match"); inm != "" && matchETag(inm, etag, true) {
+		c.Header("ETag", etag)
+		c.Header("Cache-Control", cacheControl)
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	body, info, err := covers.Get(c.Request.Context(), key)
+	if errors.Is(err, errObjectNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "cover not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer body.Close()
+
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", cacheControl)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.DataFromReader(http.StatusOK, info.Size, info.ContentType, body, nil)
+}
@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestBookETagChangesWithCounters(t *testing.T) {
+	book := Book{ID: 7, Title: "Go", Author: "A", Version: 3, Rating: 4.5, Reviews: 10, StockQuantity: 2}
+	etag := bookETag(book)
+
+	changes := map[string]func(b *Book){
+		"rating":        func(b *Book) { b.Rating = 4.6 },
+		"reviews":       func(b *Book) { b.Reviews = 11 },
+		"stockQuantity": func(b *Book) { b.StockQuantity = 1 },
+		"version":       func(b *Book) { b.Version = 4 },
+	}
+	for field, change := range changes {
+		changed := book
+		change(&changed)
+		if bookETag(changed) == etag {
+			t.Errorf("ETag did not change with %s", field)
+		}
+	}
+	if bookETag(book) != etag {
+		t.Error("ETag is not stable for the same book")
+	}
+}
+
+func TestMatchBookVersion(t *testing.T) {
+	book := Book{ID: 7, Version: 3, Rating: 4.5}
+	counted := book
+	counted.Reviews = 99 // มีรีวิวใหม่หลังจาก client อ่าน ไม่ถือว่าแก้ไข
+
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{bookETag(book), true},
+		{bookETag(counted), true},
+		{`"7-3"`, true},
+		{"*", true},
+		{`"1-1-abc", ` + bookETag(book), true},
+		{`"7-2-abc"`, false},
+		{`"7-30-abc"`, false},
+		{`"17-3-abc"`, false},
+		{"W/" + bookETag(book), false},
+	}
+	for _, tt := range tests {
+		if got := matchBookVersion(tt.header, book); got != tt.want {
+			t.Errorf("matchBookVersion(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
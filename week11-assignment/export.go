@@ -0,0 +1,359 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportBatchSize คือจำนวนแถวต่อการ FETCH หนึ่งครั้งจาก server-side cursor
+const exportBatchSize = 500
+
+// bookExporter writes books in one export format.
+type bookExporter interface {
+	begin() error
+	write(b Book) error
+	// flush pushes everything written so far to the client.
+	flush() error
+	end() error
+}
+
+var exportContentTypes = map[string]string{
+	"csv":    "text/csv; charset=utf-8",
+	"ndjson": "application/x-ndjson",
+	"xml":    "application/xml; charset=utf-8",
+}
+
+func newBookExporter(format string, w io.Writer, flusher http.Flusher) bookExporter {
+	switch format {
+	case "csv":
+		return &csvExporter{w: csv.NewWriter(w), flusher: flusher}
+	case "ndjson":
+		return &ndjsonExporter{enc: json.NewEncoder(w), flusher: flusher}
+	default:
+		return &onixExporter{w: w, enc: xml.NewEncoder(w), flusher: flusher}
+	}
+}
+
+// ===================== CSV =====================
+
+var exportCSVHeader = []string{
+	"id", "title", "author", "isbn", "year", "price", "category", "cover_image",
+	"description", "rating", "reviews", "is_new", "discount", "original_price",
+	"pages", "language", "publisher", "created_at", "updated_at",
+}
+
+type csvExporter struct {
+	w       *csv.Writer
+	flusher http.Flusher
+}
+
+func (e *csvExporter) begin() error { return e.w.Write(exportCSVHeader) }
+
+func (e *csvExporter) write(b Book) error {
+	return e.w.Write([]string{
+		strconv.Itoa(b.ID), b.Title, b.Author, b.ISBN, strconv.Itoa(b.Year),
+		strconv.FormatFloat(b.Price, 'f', 2, 64), b.Category, b.CoverImage,
+		b.Description, strconv.FormatFloat(b.Rating, 'f', -1, 64), strconv.Itoa(b.Reviews),
+		strconv.FormatBool(b.IsNew), strconv.Itoa(b.Discount),
+		strconv.FormatFloat(b.OriginalPrice, 'f', 2, 64), strconv.Itoa(b.Pages),
+		b.Language, b.Publisher,
+		b.Created_At.Format(time.RFC3339), b.Updated_At.Format(time.RFC3339),
+	})
+}
+
+func (e *csvExporter) flush() error {
+	e.w.Flush()
+	e.flusher.Flush()
+	return e.w.Error()
+}
+
+func (e *csvExporter) end() error { return e.flush() }
+
+// ===================== NDJSON =====================
+
+type ndjsonExporter struct {
+	enc     *json.Encoder
+	flusher http.Flusher
+}
+
+func (e *ndjsonExporter) begin() error       { return nil }
+func (e *ndjsonExporter) write(b Book) error { return e.enc.Encode(b) }
+func (e *ndjsonExporter) flush() error       { e.flusher.Flush(); return nil }
+func (e *ndjsonExporter) end() error         { return e.flush() }
+
+// ===================== ONIX-lite XML =====================
+// ใช้เฉพาะส่วนที่ partner ต้องใช้จาก ONIX for Books 3.0 (reference tags)
+// code list: ProductIDType 15 = ISBN-13, 02 = ISBN-10, ContributorRole A01 = ผู้แต่ง,
+// PriceType 02 = ราคาขายปลีกรวมภาษี
+
+type onixProduct struct {
+	XMLName           xml.Name              `xml:"Product"`
+	RecordReference   string                `xml:"RecordReference"`
+	NotificationType  string                `xml:"NotificationType"`
+	ProductIdentifier *onixProductID        `xml:"ProductIdentifier,omitempty"`
+	Descriptive       onixDescriptiveDetail `xml:"DescriptiveDetail"`
+	Collateral        *onixCollateral       `xml:"CollateralDetail,omitempty"`
+	Publishing        onixPublishingDetail  `xml:"PublishingDetail"`
+	Supply            onixSupplyDetail      `xml:"ProductSupply>SupplyDetail"`
+}
+
+type onixProductID struct {
+	ProductIDType string `xml:"ProductIDType"`
+	IDValue       string `xml:"IDValue"`
+}
+
+type onixDescriptiveDetail struct {
+	TitleType    string            `xml:"TitleDetail>TitleType"`
+	TitleLevel   string            `xml:"TitleDetail>TitleElement>TitleElementLevel"`
+	TitleText    string            `xml:"TitleDetail>TitleElement>TitleText"`
+	Contributors []onixContributor `xml:"Contributor"`
+	Language     *onixLanguage     `xml:"Language,omitempty"`
+	Extent       *onixExtent       `xml:"Extent,omitempty"`
+	Subject      string            `xml:"Subject>SubjectHeadingText,omitempty"`
+}
+
+type onixContributor struct {
+	SequenceNumber  int    `xml:"SequenceNumber"`
+	ContributorRole string `xml:"ContributorRole"`
+	PersonName      string `xml:"PersonName"`
+}
+
+type onixLanguage struct {
+	LanguageRole string `xml:"LanguageRole"`
+	LanguageCode string `xml:"LanguageCode"`
+}
+
+type onixExtent struct {
+	ExtentType  string `xml:"ExtentType"`
+	ExtentValue int    `xml:"ExtentValue"`
+	ExtentUnit  string `xml:"ExtentUnit"`
+}
+
+type onixCollateral struct {
+	TextType        string `xml:"TextContent>TextType"`
+	ContentAudience string `xml:"TextContent>ContentAudience"`
+	Text            string `xml:"TextContent>Text"`
+}
+
+type onixPublishingDetail struct {
+	PublishingRole string       `xml:"Publisher>PublishingRole,omitempty"`
+	PublisherName  string       `xml:"Publisher>PublisherName,omitempty"`
+	Date           *onixPubDate `xml:"PublishingDate,omitempty"`
+}
+
+type onixPubDate struct {
+	PublishingDateRole string `xml:"PublishingDateRole"`
+	Date               onixDate
+}
+
+type onixDate struct {
+	XMLName    xml.Name `xml:"Date"`
+	DateFormat string   `xml:"dateformat,attr"`
+	Value      string   `xml:",chardata"`
+}
+
+type onixSupplyDetail struct {
+	SupplierName        string    `xml:"Supplier>SupplierName"`
+	ProductAvailability string    `xml:"ProductAvailability"`
+	Price               onixPrice `xml:"Price"`
+}
+
+type onixPrice struct {
+	PriceType    string `xml:"PriceType"`
+	PriceAmount  string `xml:"PriceAmount"`
+	CurrencyCode string `xml:"CurrencyCode"`
+}
+
+// onixLanguageCodes แปลงค่าใน books.language เป็น ISO 639-2/B
+var onixLanguageCodes = map[string]string{
+	"english": "eng", "en": "eng",
+	"thai": "tha", "th": "tha", "ไทย": "tha",
+	"japanese": "jpn", "chinese": "chi", "french": "fre", "german": "ger",
+}
+
+type onixExporter struct {
+	w       io.Writer
+	enc     *xml.Encoder
+	flusher http.Flusher
+}
+
+func (e *onixExporter) begin() error {
+	_, err := fmt.Fprintf(e.w, `%s<ONIXMessage release="3.0"><Header><Sender><SenderName>Bookstore</SenderName></Sender><SentDateTime>%s</SentDateTime></Header>`,
+		xml.Header, time.Now().UTC().Format("20060102T1504Z"))
+	return err
+}
+
+func (e *onixExporter) write(b Book) error {
+	p := onixProduct{
+		RecordReference:  fmt.Sprintf("bookstore-%d", b.ID),
+		NotificationType: "03",
+		Descriptive: onixDescriptiveDetail{
+			TitleType:  "01",
+			TitleLevel: "01",
+			TitleText:  b.Title,
+			Subject:    b.Category,
+		},
+		Publishing: onixPublishingDetail{PublisherName: b.Publisher},
+		Supply: onixSupplyDetail{
+			SupplierName:        "Bookstore",
+			ProductAvailability: "20",
+			Price: onixPrice{
+				PriceType:    "02",
+				PriceAmount:  strconv.FormatFloat(b.Price, 'f', 2, 64),
+				CurrencyCode: "THB",
+			},
+		},
+	}
+
+	isbn := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(b.ISBN))
+	switch len(isbn) {
+	case 13:
+		p.ProductIdentifier = &onixProductID{"15", isbn}
+	case 10:
+		p.ProductIdentifier = &onixProductID{"02", isbn}
+	}
+
+	for i, name := range splitAuthors(b.Author) {
+		p.Descriptive.Contributors = append(p.Descriptive.Contributors, onixContributor{i + 1, "A01", name})
+	}
+	if code, ok := onixLanguageCodes[strings.ToLower(strings.TrimSpace(b.Language))]; ok {
+		p.Descriptive.Language = &onixLanguage{"01", code}
+	}
+	if b.Pages > 0 {
+		p.Descriptive.Extent = &onixExtent{"00", b.Pages, "03"}
+	}
+	if b.Description != "" {
+		p.Collateral = &onixCollateral{"03", "00", b.Description}
+	}
+	if b.Publisher != "" {
+		p.Publishing.PublishingRole = "01"
+	}
+	if b.Year > 0 {
+		p.Publishing.Date = &onixPubDate{"01", onixDate{DateFormat: "05", Value: strconv.Itoa(b.Year)}}
+	}
+
+	return e.enc.Encode(p)
+}
+
+func (e *onixExporter) flush() error {
+	if err := e.enc.Flush(); err != nil {
+		return err
+	}
+	e.flusher.Flush()
+	return nil
+}
+
+func (e *onixExporter) end() error {
+	if err := e.enc.Flush(); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(e.w, "</ONIXMessage>\n"); err != nil {
+		return err
+	}
+	e.flusher.Flush()
+	return nil
+}
+
+// ===================== Handler =====================
+
+// @Summary Export books
+// @Description Stream the catalog as CSV, NDJSON or ONIX-lite XML. Accepts the same filters as GET /books.
+// @Tags Books
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Produce application/xml
+// @Param format query string false "csv, ndjson or xml (default csv)"
+// @Param category query string false "Filter by category slug"
+// @Success 200 {file} file
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/books/export [get]
+func exportBooks(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv, ndjson or xml"})
+		return
+	}
+
+	q := newBookQuery()
+	if err := applyBookFilters(c, q, "format"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// cursor ฝั่ง server ต้องอยู่ใน transaction, READ ONLY เพื่อให้ได้ snapshot เดียวตลอดการ export
+	tx, err := db.BeginTx(c.Request.Context(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DECLARE book_export NO SCROLL CURSOR FOR SELECT "+bookSelectColumns+
+		" FROM books"+q.whereClause()+" ORDER BY id", q.args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("books-%s.%s", time.Now().Format("20060102"), format)
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	// หลังจากนี้ส่ง header ไปแล้ว ถ้าเกิด error ทำได้แค่ log และตัดการเชื่อมต่อ
+	exporter := newBookExporter(format, c.Writer, c.Writer)
+	if err := streamBooks(tx, exporter); err != nil {
+		log.Printf("book export aborted: %v", err)
+		c.Abort()
+	}
+}
+
+// streamBooks FETCHes the book_export cursor batch by batch into exporter.
+func streamBooks(tx *sql.Tx, exporter bookExporter) error {
+	if err := exporter.begin(); err != nil {
+		return err
+	}
+	for {
+		rows, err := tx.Query(fmt.Sprintf("FETCH %d FROM book_export", exportBatchSize))
+		if err != nil {
+			return err
+		}
+
+		n := 0
+		for rows.Next() {
+			book, err := scanBook(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			if err := exporter.write(book); err != nil {
+				rows.Close()
+				return err
+			}
+			n++
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if n == 0 {
+			return exporter.end()
+		}
+		if err := exporter.flush(); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FacetBucket is one drill-down option. Filter holds the query parameters
+// the client adds to /books to narrow the listing to this bucket.
+type FacetBucket struct {
+	Value  string            `json:"value"`
+	Count  int               `json:"count"`
+	Filter map[string]string `json:"filter"`
+}
+
+type Facets map[string][]FacetBucket
+
+// priceRange คือช่วงราคาของ facet "price" (max = 0 หมายถึงไม่มีเพดาน)
+type priceRange struct {
+	label    string
+	min, max float64
+}
+
+var facetPriceRanges = []priceRange{
+	{"0-199", 0, 200},
+	{"200-399", 200, 400},
+	{"400-599", 400, 600},
+	{"600+", 600, 0},
+}
+
+// facetRatingMins are cumulative "N stars & up" bands.
+var facetRatingMins = []string{"4.5", "4", "3"}
+
+func priceBucketExpr() string {
+	var b strings.Builder
+	b.WriteString("CASE")
+	for _, r := range facetPriceRanges {
+		if r.max > 0 {
+			fmt.Fprintf(&b, " WHEN price < %g THEN '%s'", r.max, r.label)
+		} else {
+			fmt.Fprintf(&b, " ELSE '%s'", r.label)
+		}
+	}
+	b.WriteString(" END")
+	return b.String()
+}
+
+// whereWith returns q's WHERE clause with extra conditions appended.
+// The extra conditions must not bind new arguments.
+func whereWith(q *bookQuery, extra ...string) string {
+	conds := append(append([]string{}, q.where...), extra...)
+	if len(conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conds, " AND ")
+}
+
+// fetchFacets counts books matching q per category, publisher, language,
+// decade, rating band and price bucket in a single round trip.
+func fetchFacets(q *bookQuery) (Facets, error) {
+	groups := []string{
+		`SELECT 'category', LOWER(category), COUNT(*) FROM books` +
+			whereWith(q, "category IS NOT NULL", "category <> ''") + ` GROUP BY 2`,
+		`SELECT 'publisher', publisher, COUNT(*) FROM books` +
+			whereWith(q, "publisher IS NOT NULL", "publisher <> ''") + ` GROUP BY 2`,
+		`SELECT 'language', language, COUNT(*) FROM books` +
+			whereWith(q, "language IS NOT NULL", "language <> ''") + ` GROUP BY 2`,
+		`SELECT 'decade', (year / 10 * 10)::text, COUNT(*) FROM books` +
+			whereWith(q, "year IS NOT NULL", "year > 0") + ` GROUP BY 2`,
+		`SELECT 'rating', band.min::text, COUNT(*)
+		 FROM books CROSS JOIN (VALUES ` + ratingBandValues() + `) AS band(min)` +
+			whereWith(q, "COALESCE(rating, 0) >= band.min") + ` GROUP BY 2`,
+		`SELECT 'price', ` + priceBucketExpr() + `, COUNT(*) FROM books` +
+			whereWith(q) + ` GROUP BY 2`,
+	}
+
+	rows, err := db.Query(strings.Join(groups, "\nUNION ALL\n"), q.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	facets := Facets{
+		"category":  {},
+		"publisher": {},
+		"language":  {},
+		"decade":    {},
+		"rating":    {},
+		"price":     {},
+	}
+	for rows.Next() {
+		var name, value string
+		var count int
+		if err := rows.Scan(&name, &value, &count); err != nil {
+			return nil, err
+		}
+		facets[name] = append(facets[name], facetBucket(name, value, count))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sortFacets(facets)
+	return facets, nil
+}
+
+func ratingBandValues() string {
+	values := make([]string, len(facetRatingMins))
+	for i, v := range facetRatingMins {
+		values[i] = "(" + v + "::numeric)"
+	}
+	return strings.Join(values, ", ")
+}
+
+func facetBucket(name, value string, count int) FacetBucket {
+	b := FacetBucket{Value: value, Count: count, Filter: map[string]string{}}
+	switch name {
+	case "decade":
+		start, _ := strconv.Atoi(value)
+		b.Value = value + "s"
+		b.Filter["year_min"] = strconv.Itoa(start)
+		b.Filter["year_max"] = strconv.Itoa(start + 9)
+	case "rating":
+		// ::text ของ numeric อาจได้ "4.0" ให้ตัดให้ตรงกับค่าที่ประกาศไว้
+		f, _ := strconv.ParseFloat(value, 64)
+		b.Value = strconv.FormatFloat(f, 'f', -1, 64) + "+"
+		b.Filter["rating_min"] = strconv.FormatFloat(f, 'f', -1, 64)
+	case "price":
+		for _, r := range facetPriceRanges {
+			if r.label != value {
+				continue
+			}
+			b.Filter["price_min"] = strconv.FormatFloat(r.min, 'f', -1, 64)
+			if r.max > 0 {
+				b.Filter["price_max"] = strconv.FormatFloat(r.max-0.01, 'f', 2, 64)
+			}
+		}
+	default:
+		b.Filter[name] = value
+	}
+	return b
+}
+
+// sortFacets orders value facets by count and range facets by their range.
+func sortFacets(facets Facets) {
+	for name, buckets := range facets {
+		switch name {
+		case "decade":
+			sort.Slice(buckets, func(i, j int) bool {
+				a, _ := strconv.Atoi(buckets[i].Filter["year_min"])
+				b, _ := strconv.Atoi(buckets[j].Filter["year_min"])
+				return a < b
+			})
+		case "rating":
+			sort.Slice(buckets, func(i, j int) bool {
+				a, _ := strconv.ParseFloat(buckets[i].Filter["rating_min"], 64)
+				b, _ := strconv.ParseFloat(buckets[j].Filter["rating_min"], 64)
+				return a > b
+			})
+		case "price":
+			order := map[string]int{}
+			for i, r := range facetPriceRanges {
+				order[r.label] = i
+			}
+			sort.Slice(buckets, func(i, j int) bool { return order[buckets[i].Value] < order[buckets[j].Value] })
+		default:
+			sort.Slice(buckets, func(i, j int) bool {
+				if buckets[i].Count != buckets[j].Count {
+					return buckets[i].Count > buckets[j].Count
+				}
+				return buckets[i].Value < buckets[j].Value
+			})
+		}
+	}
+}
+
+// wantFacets reports whether the request asked for ?facets=true.
+func wantFacets(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid value for facets: %q", value)
+	}
+	return b, nil
+}
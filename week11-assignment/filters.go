@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bookFilter adds one condition to q for a single query parameter value.
+type bookFilter func(q *bookQuery, value string) error
+
+// bookFilters คือ filter ทั้งหมดที่ /books รองรับ ทุกตัวต่อกันด้วย AND
+var bookFilters = map[string]bookFilter{
+	// category รวมหมวดหมู่ย่อยทั้งหมดด้วย เช่น ?category=fiction ได้ทั้ง fiction และ classic-fiction
+	"category": func(q *bookQuery, v string) error {
+		q.add(`category_id IN (
+			WITH RECURSIVE tree AS (
+				SELECT id FROM categories WHERE slug = ` + q.arg(categorySlug(v)) + `
+				UNION ALL
+				SELECT c.id FROM categories c JOIN tree t ON c.parent_id = t.id
+			)
+			SELECT id FROM tree)`)
+		return nil
+	},
+	// author ค้นทั้งชื่อที่แสดงในหนังสือและชื่อแฝงในตาราง authors
+	"author": func(q *bookQuery, v string) error {
+		pattern := q.arg("%" + v + "%")
+		q.add(`(author ILIKE ` + pattern + ` OR id IN (
+			SELECT ba.book_id FROM book_authors ba JOIN authors a ON a.id = ba.author_id
+			WHERE a.name ILIKE ` + pattern + ` OR array_to_string(a.aliases, ' ') ILIKE ` + pattern + `))`)
+		return nil
+	},
+	"year_min":   intFilter("year >= %s"),
+	"year_max":   intFilter("year <= %s"),
+	"price_min":  floatFilter("price >= %s"),
+	"price_max":  floatFilter("price <= %s"),
+	"rating_min": floatFilter("COALESCE(rating, 0) >= %s"),
+	"is_new":     boolFilter("COALESCE(is_new, false) = %s"),
+	"has_discount": func(q *bookQuery, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		if b {
+			q.add("COALESCE(discount, 0) > 0")
+		} else {
+			q.add("COALESCE(discount, 0) = 0")
+		}
+		return nil
+	},
+	"in_stock": func(q *bookQuery, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		cond := "EXISTS (SELECT 1 FROM inventory WHERE inventory.book_id = books.id AND inventory.quantity > 0)"
+		if !b {
+			cond = "NOT " + cond
+		}
+		q.add(cond)
+		return nil
+	},
+	"language": func(q *bookQuery, v string) error {
+		q.add("LOWER(language) = LOWER(" + q.arg(v) + ")")
+		return nil
+	},
+	"publisher": func(q *bookQuery, v string) error {
+		q.add("LOWER(publisher) = LOWER(" + q.arg(v) + ")")
+		return nil
+	},
+}
+
+func intFilter(cond string) bookFilter {
+	return func(q *bookQuery, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		q.add(fmt.Sprintf(cond, q.arg(n)))
+		return nil
+	}
+}
+
+func floatFilter(cond string) bookFilter {
+	return func(q *bookQuery, v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return err
+		}
+		q.add(fmt.Sprintf(cond, q.arg(f)))
+		return nil
+	}
+}
+
+func boolFilter(cond string) bookFilter {
+	return func(q *bookQuery, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		q.add(fmt.Sprintf(cond, q.arg(b)))
+		return nil
+	}
+}
+
+// pageQueryParams are accepted by every paged endpoint and are not filters.
+var pageQueryParams = []string{"limit", "cursor", "sort", "order"}
+
+// applyBookFilters builds q from the request's query string. Any parameter
+// that is neither a known filter, a paging parameter nor listed in extra is
+// rejected so typos don't silently return the unfiltered catalog.
+func applyBookFilters(c *gin.Context, q *bookQuery, extra ...string) error {
+	allowed := map[string]bool{}
+	for _, name := range append(pageQueryParams, extra...) {
+		allowed[name] = true
+	}
+
+	params := c.Request.URL.Query()
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	// เรียงชื่อ parameter เพื่อให้ลำดับของ $n และข้อความ error คงที่
+	sort.Strings(names)
+
+	for _, name := range names {
+		if allowed[name] {
+			continue
+		}
+		filter, ok := bookFilters[name]
+		if !ok {
+			return fmt.Errorf("unknown filter: %s", name)
+		}
+		value := params.Get(name)
+		if value == "" {
+			continue
+		}
+		if err := filter(q, value); err != nil {
+			return fmt.Errorf("invalid value for %s: %q", name, value)
+		}
+	}
+
+	if err := checkRange(params, "year_min", "year_max"); err != nil {
+		return err
+	}
+	return checkRange(params, "price_min", "price_max")
+}
+
+func checkRange(params map[string][]string, minName, maxName string) error {
+	minV, okMin := params[minName]
+	maxV, okMax := params[maxName]
+	if !okMin || !okMax {
+		return nil
+	}
+	lo, err1 := strconv.ParseFloat(minV[0], 64)
+	hi, err2 := strconv.ParseFloat(maxV[0], 64)
+	if err1 == nil && err2 == nil && lo > hi {
+		return fmt.Errorf("%s must not be greater than %s", minName, maxName)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+var errInvalidISBN = errors.New("invalid isbn: must be a valid ISBN-10 or ISBN-13")
+
+// normalizeISBN strips separators, verifies the check digit and returns the
+// canonical ISBN-13. An empty input means "no ISBN" and returns "".
+func normalizeISBN(raw string) (string, error) {
+	isbn := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(raw)))
+	isbn = strings.TrimPrefix(isbn, "ISBN")
+	isbn = strings.TrimPrefix(isbn, ":")
+
+	switch len(isbn) {
+	case 0:
+		return "", nil
+	case 10:
+		if !validISBN10(isbn) {
+			return "", errInvalidISBN
+		}
+		// ISBN-10 -> ISBN-13: เติม 978 ข้างหน้าแล้วคำนวณ check digit ใหม่
+		body := "978" + isbn[:9]
+		return body + isbn13CheckDigit(body), nil
+	case 13:
+		if !isDigits(isbn) || (!strings.HasPrefix(isbn, "978") && !strings.HasPrefix(isbn, "979")) ||
+			isbn13CheckDigit(isbn[:12]) != isbn[12:] {
+			return "", errInvalidISBN
+		}
+		return isbn, nil
+	}
+	return "", errInvalidISBN
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// validISBN10 ตรวจ check digit แบบ mod 11 (ตัวสุดท้ายเป็น X แทน 10 ได้)
+func validISBN10(isbn string) bool {
+	if !isDigits(isbn[:9]) {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(isbn[i]-'0') * (10 - i)
+	}
+	switch last := isbn[9]; {
+	case last == 'X':
+		sum += 10
+	case last >= '0' && last <= '9':
+		sum += int(last - '0')
+	default:
+		return false
+	}
+	return sum%11 == 0
+}
+
+// isbn13CheckDigit computes the EAN-13 check digit for 12 digits.
+func isbn13CheckDigit(body string) string {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		d := int(body[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return fmt.Sprint((10 - sum%10) % 10)
+}
+
+// isISBNConflict reports whether err is a violation of the unique isbn index.
+func isISBNConflict(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "books_isbn_key"
+}
+
+// respondISBNConflict ตอบ 409 พร้อมบอกว่าหนังสือเล่มไหนใช้ ISBN นี้อยู่แล้ว
+func respondISBNConflict(c *gin.Context, isbn string) {
+	var id int
+	var trashed bool
+	err := db.QueryRow("SELECT id, deleted_at IS NOT NULL FROM books WHERE isbn = $1", isbn).Scan(&id, &trashed)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "isbn already exists", "isbn": isbn})
+		return
+	}
+	c.JSON(http.StatusConflict, gin.H{
+		"error": "isbn already exists",
+		"isbn":  isbn,
+		"existing_book": gin.H{
+			"id":      id,
+			"url":     fmt.Sprintf("/api/v1/books/%d", id),
+			"trashed": trashed,
+		},
+	})
+}
+
+// @Summary Get book by ISBN
+// @Description Look up a book by ISBN-10 or ISBN-13 (hyphens allowed)
+// @Tags Books
+// @Produce json
+// @Param isbn path string true "ISBN-10 or ISBN-13"
+// @Success 200 {object} Book
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/books/isbn/{isbn} [get]
+func getBookByISBN(c *gin.Context) {
+	isbn, err := normalizeISBN(c.Param("isbn"))
+	if err != nil || isbn == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidISBN.Error()})
+		return
+	}
+
+	book, err := scanBook(db.QueryRow("SELECT "+bookSelectColumns+" FROM books WHERE isbn = $1 AND deleted_at IS NULL", isbn))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "book not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if book.Authors, err = bookAuthors(book.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("ETag", bookETag(book))
+	c.JSON(http.StatusOK, book)
+}
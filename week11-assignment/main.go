@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"os"
 	"time"
@@ -21,28 +22,46 @@ type ErrorResponse struct {
 
 var db *sql.DB
 
+// Book keeps price and originalPrice as float64: this service only stores
+// and returns them (DECIMAL(10,2) reads back exactly as a two-decimal
+// float) and never sums or taxes them. Writes round them to the satang
+// with roundPrices; all arithmetic on money is done in week13-lab6 with
+// its integer-satang Money type.
 type Book struct {
-	ID            int       `json:"id"`
-	Title         string    `json:"title"`
-	Author        string    `json:"author"`
-	ISBN          string    `json:"isbn"`
-	Year          int       `json:"year"`
-	Price         float64   `json:"price"`
-	Category      string    `json:"category"`
-	CoverImage    string    `json:"coverImage,omitempty"`
-	Description   string    `json:"description,omitempty"`
-	Rating        float64   `json:"rating,omitempty"`
-	Reviews       int       `json:"reviews,omitempty"`
-	IsNew         bool      `json:"isNew,omitempty"`
-	Discount      int       `json:"discount,omitempty"`
-	OriginalPrice float64   `json:"originalPrice,omitempty"`
-	Created_At    time.Time `json:"created_at"`
-	Updated_At    time.Time `json:"updated_at"`
+	ID              int               `json:"id"`
+	Title           string            `json:"title" binding:"required"`
+	Author          string            `json:"author" binding:"required"`
+	ISBN            string            `json:"isbn" binding:"omitempty,isbn_any"`
+	Year            int               `json:"year" binding:"omitempty,min=1000,max_next_year"`
+	Price           float64           `json:"price" binding:"gte=0"`
+	Category        string            `json:"category"`
+	CoverImage      string            `json:"coverImage,omitempty" binding:"omitempty,url_or_path"`
+	CoverThumbnails map[string]string `json:"coverThumbnails,omitempty"` // เฉพาะปกที่อัปโหลด: small, medium, large
+	Description     string            `json:"description,omitempty"`
+	Rating          float64           `json:"rating,omitempty"`  // คำนวณจากตาราง reviews (week13-lab6) แก้ผ่าน API นี้ไม่ได้
+	Reviews         int               `json:"reviews,omitempty"` // เหมือน Rating
+	IsNew           bool              `json:"isNew,omitempty"`
+	Discount        int               `json:"discount,omitempty" binding:"gte=0,lte=100"`
+	OriginalPrice   float64           `json:"originalPrice,omitempty" binding:"gte=0"`
+	Pages           int               `json:"pages,omitempty" binding:"gte=0"`
+	Language        string            `json:"language,omitempty"`
+	Publisher       string            `json:"publisher,omitempty"`
+	PublisherID     int               `json:"publisherId,omitempty"`
+	StockQuantity   int               `json:"stockQuantity"` // จากตาราง inventory แก้ผ่าน /books/:id/stock ของ week13-lab6
+	Authors         []AuthorRef       `json:"authors,omitempty"`
+	Version         int               `json:"version,omitempty"`
+	Created_At      time.Time         `json:"created_at"`
+	Updated_At      time.Time         `json:"updated_at"`
 }
 
 type Category struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
+	ID        int    `json:"id"`
+	Slug      string `json:"slug"`
+	NameEN    string `json:"name_en"`
+	NameTH    string `json:"name_th,omitempty"`
+	ParentID  *int   `json:"parent_id,omitempty"`
+	SortOrder int    `json:"sort_order"`
+	BookCount int    `json:"book_count"`
 }
 
 func initDB() {
@@ -100,18 +119,20 @@ func getHealth(c *gin.Context) {
 }
 
 // @Summary Get all categories
-// @Description Get list of all book categories
+// @Description Get list of all book categories with the number of books in each
 // @Tags Categories
 // @Produce json
-// @Success 200 {array} string
+// @Success 200 {array} Category
 // @Failure 500 {object} ErrorResponse
 // @Router /api/v1/categories [get]
 func getCategories(c *gin.Context) {
 	rows, err := db.Query(`
-		SELECT DISTINCT category 
-		FROM books 
-		WHERE category IS NOT NULL AND category != ''
-		ORDER BY category
+		SELECT c.id, c.slug, c.name_en, COALESCE(c.name_th, ''), c.parent_id,
+		       COALESCE(c.sort_order, 0), COUNT(b.id)
+		FROM categories c
+		LEFT JOIN books b ON b.category_id = c.id AND b.deleted_at IS NULL
+		GROUP BY c.id
+		ORDER BY c.sort_order, c.name_en
 	`)
 
 	if err != nil {
@@ -120,10 +141,11 @@ func getCategories(c *gin.Context) {
 	}
 	defer rows.Close()
 
-	var categories []string
+	var categories []Category
 	for rows.Next() {
-		var category string
-		if err := rows.Scan(&category); err != nil {
+		var category Category
+		if err := rows.Scan(&category.ID, &category.Slug, &category.NameEN, &category.NameTH,
+			&category.ParentID, &category.SortOrder, &category.BookCount); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -131,72 +153,86 @@ func getCategories(c *gin.Context) {
 	}
 
 	if categories == nil {
-		categories = []string{}
+		categories = []Category{}
 	}
 
 	c.JSON(http.StatusOK, categories)
 }
 
 // @Summary Search books
-// @Description Search books by keyword in title or author
+// @Description Full-text search over title, author, description and publisher, ranked by relevance.
+// @Description Supports "quoted phrases", prefix* terms and Thai text.
 // @Tags Books
 // @Produce json
 // @Param q query string true "Search keyword"
-// @Success 200 {array} Book
+// @Param facets query bool false "Include facet counts for the current filters"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param cursor query string false "Cursor from previous page's next_cursor"
+// @Param sort query string false "relevance, price, rating, year, title, created_at (default relevance)"
+// @Param order query string false "asc or desc (default desc)"
+// @Success 200 {object} SearchPage
+// @Failure 400 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /api/v1/books/search [get]
 func searchBooks(c *gin.Context) {
 	keyword := c.Query("q")
-	
+
 	if keyword == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Search keyword is required"})
 		return
 	}
 
-	searchPattern := "%" + keyword + "%"
-	
-	rows, err := db.Query(`
-		SELECT id, title, author, isbn, year, price, category, 
-		       COALESCE(cover_image, '') as cover_image,
-		       COALESCE(description, '') as description,
-		       COALESCE(rating, 0) as rating,
-		       COALESCE(reviews, 0) as reviews,
-		       COALESCE(is_new, false) as is_new,
-		       COALESCE(discount, 0) as discount,
-		       COALESCE(original_price, 0) as original_price,
-		       created_at, updated_at
-		FROM books 
-		WHERE LOWER(title) LIKE LOWER($1) OR LOWER(author) LIKE LOWER($1)
-		ORDER BY created_at DESC
-	`, searchPattern)
+	tsquery := buildTSQuery(keyword)
+	if tsquery == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Search keyword has no searchable terms"})
+		return
+	}
+
+	withFacets, err := wantFacets(c.Query("facets"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
+	q := newBookQuery()
+	if err := applyBookFilters(c, q, "q", "facets"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tsq := "to_tsquery('english', " + q.arg(tsquery) + ")"
+	// นอกจาก search_vector ของหนังสือแล้ว ให้ค้นเจอจากชื่อแฝงของผู้แต่งด้วย เช่น "Uncle Bob"
+	q.add("(search_vector @@ " + tsq + ` OR id IN (
+		SELECT ba.book_id FROM book_authors ba JOIN authors a ON a.id = ba.author_id
+		WHERE ` + authorAliasVector + " @@ " + tsq + "))")
+
+	fields := withSortField(bookSortFields, "relevance", sortField{"ts_rank(search_vector, " + tsq + ")", "real"})
+	p, err := parsePageParams(c, fields, "relevance", "desc")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := fetchBookPage(q, p)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	defer rows.Close()
 
-	var books []Book
-	for rows.Next() {
-		var book Book
-		err := rows.Scan(
-			&book.ID, &book.Title, &book.Author, &book.ISBN, &book.Year, &book.Price,
-			&book.Category, &book.CoverImage, &book.Description, &book.Rating,
-			&book.Reviews, &book.IsNew, &book.Discount, &book.OriginalPrice,
-			&book.Created_At, &book.Updated_At,
-		)
-		if err != nil {
+	hits, err := searchHighlights(tsquery, page.Items)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := SearchPage{Items: hits, NextCursor: page.NextCursor, Total: page.Total}
+	if withFacets {
+		if result.Facets, err = fetchFacets(q); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		books = append(books, book)
-	}
-
-	if books == nil {
-		books = []Book{}
 	}
 
-	c.JSON(http.StatusOK, books)
+	c.JSON(http.StatusOK, result)
 }
 
 // @Summary Get featured books
@@ -207,18 +243,9 @@ func searchBooks(c *gin.Context) {
 // @Failure 500 {object} ErrorResponse
 // @Router /api/v1/books/featured [get]
 func getFeaturedBooks(c *gin.Context) {
-	rows, err := db.Query(`
-		SELECT id, title, author, isbn, year, price, category, 
-		       COALESCE(cover_image, '') as cover_image,
-		       COALESCE(description, '') as description,
-		       COALESCE(rating, 0) as rating,
-		       COALESCE(reviews, 0) as reviews,
-		       COALESCE(is_new, false) as is_new,
-		       COALESCE(discount, 0) as discount,
-		       COALESCE(original_price, 0) as original_price,
-		       created_at, updated_at
-		FROM books 
-		WHERE rating >= 4.0
+	rows, err := db.Query(`SELECT ` + bookSelectColumns + `
+		FROM books
+		WHERE rating >= 4.0 AND deleted_at IS NULL
 		ORDER BY rating DESC, reviews DESC
 		LIMIT 10
 	`)
@@ -231,13 +258,7 @@ func getFeaturedBooks(c *gin.Context) {
 
 	var books []Book
 	for rows.Next() {
-		var book Book
-		err := rows.Scan(
-			&book.ID, &book.Title, &book.Author, &book.ISBN, &book.Year, &book.Price,
-			&book.Category, &book.CoverImage, &book.Description, &book.Rating,
-			&book.Reviews, &book.IsNew, &book.Discount, &book.OriginalPrice,
-			&book.Created_At, &book.Updated_At,
-		)
+		book, err := scanBook(rows)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -261,18 +282,10 @@ func getFeaturedBooks(c *gin.Context) {
 // @Failure 500 {object} ErrorResponse
 // @Router /api/v1/books/new [get]
 func getNewBooks(c *gin.Context) {
-	rows, err := db.Query(`
-		SELECT id, title, author, isbn, year, price, category, 
-		       COALESCE(cover_image, '') as cover_image,
-		       COALESCE(description, '') as description,
-		       COALESCE(rating, 0) as rating,
-		       COALESCE(reviews, 0) as reviews,
-		       COALESCE(is_new, false) as is_new,
-		       COALESCE(discount, 0) as discount,
-		       COALESCE(original_price, 0) as original_price,
-		       created_at, updated_at
-		FROM books 
-		ORDER BY created_at DESC 
+	rows, err := db.Query(`SELECT ` + bookSelectColumns + `
+		FROM books
+		WHERE deleted_at IS NULL
+		ORDER BY created_at DESC
 		LIMIT 5
 	`)
 
@@ -284,13 +297,7 @@ func getNewBooks(c *gin.Context) {
 
 	var books []Book
 	for rows.Next() {
-		var book Book
-		err := rows.Scan(
-			&book.ID, &book.Title, &book.Author, &book.ISBN, &book.Year, &book.Price,
-			&book.Category, &book.CoverImage, &book.Description, &book.Rating,
-			&book.Reviews, &book.IsNew, &book.Discount, &book.OriginalPrice,
-			&book.Created_At, &book.Updated_At,
-		)
+		book, err := scanBook(rows)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -309,126 +316,91 @@ func getNewBooks(c *gin.Context) {
 // @Description Get books with discount
 // @Tags Books
 // @Produce json
-// @Success 200 {array} Book
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param cursor query string false "Cursor from previous page's next_cursor"
+// @Param sort query string false "price, rating, year, title, created_at, discount (default discount)"
+// @Param order query string false "asc or desc (default desc)"
+// @Success 200 {object} BookPage
+// @Failure 400 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /api/v1/books/discounted [get]
 func getDiscountedBooks(c *gin.Context) {
-	rows, err := db.Query(`
-		SELECT id, title, author, isbn, year, price, category, 
-		       COALESCE(cover_image, '') as cover_image,
-		       COALESCE(description, '') as description,
-		       COALESCE(rating, 0) as rating,
-		       COALESCE(reviews, 0) as reviews,
-		       COALESCE(is_new, false) as is_new,
-		       COALESCE(discount, 0) as discount,
-		       COALESCE(original_price, 0) as original_price,
-		       created_at, updated_at
-		FROM books 
-		WHERE discount > 0
-		ORDER BY discount DESC, created_at DESC
-	`)
-
+	p, err := parsePageParams(c, bookSortFields, "discount", "desc")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	defer rows.Close()
 
-	var books []Book
-	for rows.Next() {
-		var book Book
-		err := rows.Scan(
-			&book.ID, &book.Title, &book.Author, &book.ISBN, &book.Year, &book.Price,
-			&book.Category, &book.CoverImage, &book.Description, &book.Rating,
-			&book.Reviews, &book.IsNew, &book.Discount, &book.OriginalPrice,
-			&book.Created_At, &book.Updated_At,
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		books = append(books, book)
-	}
+	q := newBookQuery()
+	q.add("discount > 0")
 
-	if books == nil {
-		books = []Book{}
+	page, err := fetchBookPage(q, p)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	c.JSON(http.StatusOK, books)
+	c.JSON(http.StatusOK, page)
 }
 
 // @Summary Get all books
-// @Description Get all books or filter by category
+// @Description Get all books, optionally filtered. All filters are combined with AND.
 // @Tags Books
 // @Produce json
 // @Param category query string false "Filter by category"
-// @Success 200 {array} Book
+// @Param author query string false "Author name contains"
+// @Param year_min query int false "Published in or after year"
+// @Param year_max query int false "Published in or before year"
+// @Param price_min query number false "Minimum price"
+// @Param price_max query number false "Maximum price"
+// @Param rating_min query number false "Minimum rating"
+// @Param is_new query bool false "Only new (or not new) books"
+// @Param has_discount query bool false "Only discounted (or full price) books"
+// @Param language query string false "Filter by language"
+// @Param publisher query string false "Filter by publisher"
+// @Param in_stock query bool false "Only books in stock (or sold out)"
+// @Param facets query bool false "Include facet counts for the current filters"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param cursor query string false "Cursor from previous page's next_cursor"
+// @Param sort query string false "price, rating, year, title, created_at (default created_at)"
+// @Param order query string false "asc or desc (default desc)"
+// @Success 200 {object} BookPage
+// @Failure 400 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /api/v1/books [get]
 func getAllBooks(c *gin.Context) {
-	var rows *sql.Rows
-	var err error
-	
-	categoryQ := c.Query("category")
-	
-	if categoryQ == "" {
-		rows, err = db.Query(`
-			SELECT id, title, author, isbn, year, price, category, 
-			       COALESCE(cover_image, '') as cover_image,
-			       COALESCE(description, '') as description,
-			       COALESCE(rating, 0) as rating,
-			       COALESCE(reviews, 0) as reviews,
-			       COALESCE(is_new, false) as is_new,
-			       COALESCE(discount, 0) as discount,
-			       COALESCE(original_price, 0) as original_price,
-			       created_at, updated_at
-			FROM books
-			ORDER BY created_at DESC
-		`)
-	} else {
-		rows, err = db.Query(`
-			SELECT id, title, author, isbn, year, price, category, 
-			       COALESCE(cover_image, '') as cover_image,
-			       COALESCE(description, '') as description,
-			       COALESCE(rating, 0) as rating,
-			       COALESCE(reviews, 0) as reviews,
-			       COALESCE(is_new, false) as is_new,
-			       COALESCE(discount, 0) as discount,
-			       COALESCE(original_price, 0) as original_price,
-			       created_at, updated_at
-			FROM books 
-			WHERE LOWER(category) = LOWER($1)
-			ORDER BY created_at DESC
-		`, categoryQ)
+	p, err := parsePageParams(c, bookSortFields, "created_at", "desc")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
+	withFacets, err := wantFacets(c.Query("facets"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	q := newBookQuery()
+	if err := applyBookFilters(c, q, "facets"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := fetchBookPage(q, p)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	defer rows.Close()
 
-	var books []Book
-	for rows.Next() {
-		var book Book
-		err := rows.Scan(
-			&book.ID, &book.Title, &book.Author, &book.ISBN, &book.Year, &book.Price,
-			&book.Category, &book.CoverImage, &book.Description, &book.Rating,
-			&book.Reviews, &book.IsNew, &book.Discount, &book.OriginalPrice,
-			&book.Created_At, &book.Updated_At,
-		)
-		if err != nil {
+	if withFacets {
+		if page.Facets, err = fetchFacets(q); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		books = append(books, book)
 	}
 
-	if books == nil {
-		books = []Book{}
-	}
-
-	c.JSON(http.StatusOK, books)
+	c.JSON(http.StatusOK, page)
 }
 
 // @Summary Get book by ID
@@ -436,32 +408,16 @@ func getAllBooks(c *gin.Context) {
 // @Tags Books
 // @Produce json
 // @Param id path int true "Book ID"
+// @Param If-None-Match header string false "ETag from a previous response"
 // @Success 200 {object} Book
+// @Success 304 "Not modified"
 // @Failure 404 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /api/v1/books/{id} [get]
 func getBook(c *gin.Context) {
 	id := c.Param("id")
-	var book Book
-
-	err := db.QueryRow(`
-		SELECT id, title, author, isbn, year, price, category, 
-		       COALESCE(cover_image, '') as cover_image,
-		       COALESCE(description, '') as description,
-		       COALESCE(rating, 0) as rating,
-		       COALESCE(reviews, 0) as reviews,
-		       COALESCE(is_new, false) as is_new,
-		       COALESCE(discount, 0) as discount,
-		       COALESCE(original_price, 0) as original_price,
-		       created_at, updated_at
-		FROM books 
-		WHERE id = $1
-	`, id).Scan(
-		&book.ID, &book.Title, &book.Author, &book.ISBN, &book.Year, &book.Price,
-		&book.Category, &book.CoverImage, &book.Description, &book.Rating,
-		&book.Reviews, &book.IsNew, &book.Discount, &book.OriginalPrice,
-		&book.Created_At, &book.Updated_At,
-	)
+
+	book, err := scanBook(db.QueryRow("SELECT "+bookSelectColumns+" FROM books WHERE id = $1 AND deleted_at IS NULL", id))
 
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "book not found"})
@@ -471,6 +427,19 @@ func getBook(c *gin.Context) {
 		return
 	}
 
+	if book.Authors, err = bookAuthors(book.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// ETag คิดจากทุก field ที่ตอบกลับ (รวม rating, reviews ที่เปลี่ยนโดยไม่เพิ่ม version)
+	etag := bookETag(book)
+	c.Header("ETag", etag)
+	if match := c.GetHeader("If-None-Match"); match != "" && matchETag(match, etag, true) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
 	c.JSON(http.StatusOK, book)
 }
 
@@ -482,40 +451,84 @@ func getBook(c *gin.Context) {
 // @Param book body Book true "Book object"
 // @Success 201 {object} Book
 // @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} ValidationErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /api/v1/books [post]
 func createBook(c *gin.Context) {
 	var newBook Book
 
 	if err := c.ShouldBindJSON(&newBook); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	isbn, err := normalizeISBN(newBook.ISBN)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	newBook.ISBN = isbn
+
+	categoryID, err := resolveCategory(&newBook.Category)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	roundPrices(&newBook)
+	publisherID, err := resolvePublisher(tx, newBook.Publisher)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	var id int
-	var created_At, updated_At time.Time
-
-	err := db.QueryRow(`
-		INSERT INTO books (title, author, isbn, year, price, category, 
-		                   cover_image, description, rating, reviews, 
-		                   is_new, discount, original_price)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
-		RETURNING id, created_at, updated_at
+	err = tx.QueryRow(`
+		INSERT INTO books (title, author, isbn, year, price, category, category_id,
+		                   cover_image, description,
+		                   is_new, discount, original_price, pages, language, publisher, publisher_id)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		RETURNING id
 	`,
 		newBook.Title, newBook.Author, newBook.ISBN, newBook.Year, newBook.Price,
-		newBook.Category, newBook.CoverImage, newBook.Description, newBook.Rating,
-		newBook.Reviews, newBook.IsNew, newBook.Discount, newBook.OriginalPrice,
-	).Scan(&id, &created_At, &updated_At)
+		newBook.Category, categoryID, newBook.CoverImage, newBook.Description,
+		newBook.IsNew, newBook.Discount, newBook.OriginalPrice,
+		newBook.Pages, newBook.Language, newBook.Publisher, publisherID,
+	).Scan(&id)
 
-	if err != nil {
+	if isISBNConflict(err) {
+		respondISBNConflict(c, newBook.ISBN)
+		return
+	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	newBook.ID = id
-	newBook.Created_At = created_At
-	newBook.Updated_At = updated_At
+	if err := linkBookAuthors(tx, id, newBook.Author); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// อ่านกลับให้ได้ representation เดียวกับ GET (stockQuantity, publisherId, authors) ETag จะได้ตรงกัน
+	if newBook, err = loadBook(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
+	c.Header("ETag", bookETag(newBook))
 	c.JSON(http.StatusCreated, newBook)
 }
 
@@ -525,10 +538,14 @@ func createBook(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path int true "Book ID"
+// @Param If-Match header string false "ETag from GET /books/{id}"
 // @Param book body Book true "Book object"
 // @Success 200 {object} Book
 // @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 412 {object} ErrorResponse
+// @Failure 422 {object} ValidationErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /api/v1/books/{id} [put]
 func updateBook(c *gin.Context) {
@@ -536,66 +553,153 @@ func updateBook(c *gin.Context) {
 	var updateBook Book
 
 	if err := c.ShouldBindJSON(&updateBook); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	isbn, err := normalizeISBN(updateBook.ISBN)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	updateBook.ISBN = isbn
 
-	var ID int
-	var updatedAt time.Time
+	categoryID, err := resolveCategory(&updateBook.Category)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	err := db.QueryRow(`
-		UPDATE books
-		SET title = $1, author = $2, isbn = $3, year = $4, price = $5,
-		    category = $6, cover_image = $7, description = $8, rating = $9,
-		    reviews = $10, is_new = $11, discount = $12, original_price = $13
-		WHERE id = $14
-		RETURNING id, updated_at
-	`,
-		updateBook.Title, updateBook.Author, updateBook.ISBN, updateBook.Year,
-		updateBook.Price, updateBook.Category, updateBook.CoverImage,
-		updateBook.Description, updateBook.Rating, updateBook.Reviews,
-		updateBook.IsNew, updateBook.Discount, updateBook.OriginalPrice, id,
-	).Scan(&ID, &updatedAt)
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
 
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "book not found"})
+	if _, ok := lockBook(c, tx, id); !ok {
+		return
+	}
+
+	if err := saveBook(tx, id, &updateBook, categoryID); isISBNConflict(err) {
+		respondISBNConflict(c, updateBook.ISBN)
 		return
 	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	updateBook.ID = ID
-	updateBook.Updated_At = updatedAt
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if updateBook, err = loadBook(updateBook.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("ETag", bookETag(updateBook))
 	c.JSON(http.StatusOK, updateBook)
 }
 
+// roundPrices rounds price and originalPrice to two decimals, the precision
+// of the DECIMAL columns, so what is written is exactly what GET returns.
+func roundPrices(book *Book) {
+	book.Price = math.Round(book.Price*100) / 100
+	book.OriginalPrice = math.Round(book.OriginalPrice*100) / 100
+}
+
+// saveBook writes every editable column of book to row id inside tx and
+// refreshes book.ID, book.Updated_At, book.Version and the review counters.
+// It returns sql.ErrNoRows if the book is missing.
+func saveBook(tx *sql.Tx, id string, book *Book, categoryID *int) error {
+	roundPrices(book)
+	publisherID, err := resolvePublisher(tx, book.Publisher)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(`
+		UPDATE books
+		SET title = $1, author = $2, isbn = NULLIF($3, ''), year = $4, price = $5,
+		    category = $6, category_id = $7, cover_image = $8, description = $9,
+		    is_new = $10, discount = $11, original_price = $12,
+		    pages = $13, language = $14, publisher = $15, publisher_id = $16,
+		    updated_at = NOW(), version = version + 1
+		WHERE id = $17
+		RETURNING id, updated_at, version, COALESCE(rating, 0), COALESCE(reviews, 0)
+	`,
+		book.Title, book.Author, book.ISBN, book.Year,
+		book.Price, book.Category, categoryID, book.CoverImage,
+		book.Description, book.IsNew, book.Discount, book.OriginalPrice,
+		book.Pages, book.Language, book.Publisher, publisherID, id,
+	).Scan(&book.ID, &book.Updated_At, &book.Version, &book.Rating, &book.Reviews)
+	if err != nil {
+		return err
+	}
+
+	return linkBookAuthors(tx, book.ID, book.Author)
+}
+
+// loadBook reads book id with everything GET /books/:id returns, so write
+// responses carry the same representation (and ETag) as the next GET.
+func loadBook(id int) (Book, error) {
+	book, err := scanBook(db.QueryRow("SELECT "+bookSelectColumns+" FROM books WHERE id = $1", id))
+	if err != nil {
+		return book, err
+	}
+	book.Authors, err = bookAuthors(book.ID)
+	return book, err
+}
+
 // @Summary Delete a book
-// @Description Delete book by ID
+// @Description Move book to the trash (soft delete). It can be restored until the purge job removes it.
 // @Tags Books
 // @Produce json
 // @Param id path int true "Book ID"
+// @Param If-Match header string false "ETag from GET /books/{id}"
+// @Param Authorization header string false "Bearer access token from week13-lab6, recorded as the acting user"
 // @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
+// @Failure 412 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /api/v1/books/{id} [delete]
 func deleteBook(c *gin.Context) {
 	id := c.Param("id")
+	userID := c.GetInt("user_id")
 
-	result, err := db.Exec("DELETE FROM books WHERE id = $1", id)
+	tx, err := db.Begin()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
+	if err := setActingUser(tx, userID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+	if _, ok := lockBook(c, tx, id); !ok {
+		return
+	}
+
+	// soft delete: ย้ายเข้าถังขยะ แถวยังอยู่ให้ประวัติคำสั่งซื้อและ audit log อ้างอิงได้
+	// ลบถาวรโดย purge job ของ week13-lab6 เมื่อเกินระยะเวลาที่กำหนด
+	if _, err := tx.Exec("UPDATE books SET deleted_at = NOW(), version = version + 1 WHERE id = $1", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// action เดียวกับ week13-lab6 ให้ประวัติ delete/restore/purge ของถังขยะอยู่ครบใน audit_logs
+	if err := logAudit(tx, c, userID, "delete", "books", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -611,8 +715,13 @@ func main() {
 	initDB()
 	defer db.Close()
 
+	var err error
+	if covers, err = newCoverStorage(); err != nil {
+		log.Fatal("Failed to init cover storage:", err)
+	}
+
 	r := gin.Default()
-	
+
 	// CORS configuration
 	config := cors.DefaultConfig()
 	config.AllowAllOrigins = true
@@ -631,17 +740,27 @@ func main() {
 		api.GET("/categories", getCategories)
 
 		// Books
-		api.GET("/books", getAllBooks)                // Support ?category=fiction
-		api.GET("/books/search", searchBooks)         // ?q=keyword
-		api.GET("/books/featured", getFeaturedBooks)  // หนังสือแนะนำ
-		api.GET("/books/new", getNewBooks)            // หนังสือใหม่
+		api.GET("/books", getAllBooks)                   // Support ?category=fiction&price_max=300&limit=20&cursor=...&sort=price&order=asc
+		api.GET("/books/search", searchBooks)            // ?q=keyword
+		api.GET("/books/suggest", suggestBooks)          // ?q=gatbsy (autocomplete)
+		api.GET("/books/export", exportBooks)            // ?format=csv|ndjson|xml + filters เดียวกับ /books
+		api.GET("/books/featured", getFeaturedBooks)     // หนังสือแนะนำ
+		api.GET("/books/new", getNewBooks)               // หนังสือใหม่
 		api.GET("/books/discounted", getDiscountedBooks) // หนังสือลดราคา
+		api.GET("/books/isbn/:isbn", getBookByISBN)      // ISBN-10 หรือ ISBN-13 มีขีดได้
 		api.GET("/books/:id", getBook)
 		api.POST("/books", createBook)
 		api.PUT("/books/:id", updateBook)
-		api.DELETE("/books/:id", deleteBook)
+		api.PATCH("/books/:id", patchBook) // JSON Merge Patch (RFC 7396)
+		api.DELETE("/books/:id", optionalActingUser(), deleteBook)
+		api.POST("/books/:id/cover", uploadCover) // multipart field "cover"
+		api.GET("/covers/*key", getCover)
+
+		api.GET("/authors/:id", getAuthor)
+		api.GET("/authors/:id/books", getAuthorBooks)
+		api.GET("/publishers/:id/books", getPublisherBooks)
 	}
 
 	log.Println("Server starting on port 8080...")
 	r.Run(":8080")
-}
\ No newline at end of file
+}
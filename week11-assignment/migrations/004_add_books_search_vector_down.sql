@@ -0,0 +1,14 @@
+-- Rollback Migration: Remove full-text search from books table
+-- Version: 004
+-- Description: ลบคอลัมน์ search_vector, index และฟังก์ชัน thai_bigrams
+
+DROP INDEX IF EXISTS idx_books_search_vector;
+
+ALTER TABLE books DROP COLUMN IF EXISTS search_vector;
+
+DROP FUNCTION IF EXISTS thai_bigrams(TEXT);
+
+-- =============================================================================
+-- Rollback completed successfully!
+-- Table structure has been reverted to version 003
+-- =============================================================================
@@ -0,0 +1,48 @@
+-- Migration: Add full-text search to books table
+-- Version: 004
+-- Description: เพิ่มคอลัมน์ search_vector (tsvector) จาก title, author, description, publisher พร้อม GIN index
+
+-- =============================================================================
+-- STEP 1: Thai tokenizer helper
+-- =============================================================================
+
+-- ภาษาไทยไม่เว้นวรรคระหว่างคำ parser ของ PostgreSQL จึงตัดคำไม่ได้
+-- ใช้วิธีแตกข้อความไทยเป็น bigram (ตัวอักษรติดกันทีละ 2 ตัว) แล้วเข้ารหัสเป็น
+-- token ASCII เช่น "นว" -> "the19e27" เพื่อให้ parser มองเป็น 1 token เสมอ
+-- ฝั่ง Go (thaiBigrams ใน search.go) ต้องสร้าง token ด้วยกติกาเดียวกัน
+CREATE OR REPLACE FUNCTION thai_bigrams(txt TEXT) RETURNS TEXT AS $$
+    SELECT COALESCE(string_agg(
+        'th' || to_hex(ascii(substr(r.run[1], i, 1))) ||
+        CASE WHEN char_length(r.run[1]) > 1
+             THEN to_hex(ascii(substr(r.run[1], i + 1, 1)))
+             ELSE '' END,
+        ' ' ORDER BY r.ord, i), '')
+    FROM regexp_matches(COALESCE(txt, ''), '[ก-๛]+', 'g') WITH ORDINALITY AS r(run, ord),
+         generate_series(1, GREATEST(char_length(r.run[1]) - 1, 1)) AS i
+$$ LANGUAGE sql IMMUTABLE;
+
+-- =============================================================================
+-- STEP 2: Add search_vector column
+-- =============================================================================
+
+-- น้ำหนัก: A = title, B = author, C = description, D = publisher
+ALTER TABLE books ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', COALESCE(title, '')), 'A') ||
+        setweight(to_tsvector('english', COALESCE(author, '')), 'B') ||
+        setweight(to_tsvector('english', COALESCE(description, '')), 'C') ||
+        setweight(to_tsvector('english', COALESCE(publisher, '')), 'D') ||
+        setweight(to_tsvector('simple', thai_bigrams(COALESCE(title, '') || ' ' || COALESCE(description, ''))), 'C')
+    ) STORED;
+
+-- =============================================================================
+-- STEP 3: Create index
+-- =============================================================================
+
+CREATE INDEX IF NOT EXISTS idx_books_search_vector ON books USING GIN (search_vector);
+
+COMMENT ON COLUMN books.search_vector IS 'ข้อมูลสำหรับค้นหา full-text (title, author, description, publisher + bigram ภาษาไทย)';
+
+-- =============================================================================
+-- Migration completed successfully!
+-- =============================================================================
@@ -0,0 +1,11 @@
+-- Rollback Migration: Remove trigram indexes
+-- Version: 005
+-- Description: ลบ index สำหรับ autocomplete (ไม่ลบ extension pg_trgm เพราะอาจมีส่วนอื่นใช้อยู่)
+
+DROP INDEX IF EXISTS idx_books_title_trgm;
+DROP INDEX IF EXISTS idx_books_author_trgm;
+
+-- =============================================================================
+-- Rollback completed successfully!
+-- Table structure has been reverted to version 004
+-- =============================================================================
@@ -0,0 +1,22 @@
+-- Migration: Add trigram indexes for autocomplete
+-- Version: 005
+-- Description: เปิดใช้ pg_trgm และสร้าง GIN index บน title, author สำหรับ /books/suggest (ทนต่อการสะกดผิด)
+
+-- =============================================================================
+-- STEP 1: Enable extension
+-- =============================================================================
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- =============================================================================
+-- STEP 2: Create indexes
+-- =============================================================================
+
+-- ใช้ LOWER() ให้ตรงกับ expression ใน query เพื่อให้ planner เลือกใช้ index ได้
+CREATE INDEX IF NOT EXISTS idx_books_title_trgm ON books USING GIN (LOWER(title) gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS idx_books_author_trgm ON books USING GIN (LOWER(author) gin_trgm_ops);
+
+-- =============================================================================
+-- Migration completed successfully!
+-- =============================================================================
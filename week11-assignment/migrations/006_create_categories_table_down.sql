@@ -0,0 +1,14 @@
+-- Rollback Migration: Drop categories table
+-- Version: 006
+-- Description: ลบ books.category_id และตาราง categories (books.category ยังเก็บ slug ไว้เหมือนเดิม)
+
+DROP INDEX IF EXISTS idx_books_category_id;
+
+ALTER TABLE books DROP COLUMN IF EXISTS category_id;
+
+DROP TABLE IF EXISTS categories;
+
+-- =============================================================================
+-- Rollback completed successfully!
+-- Table structure has been reverted to version 005
+-- =============================================================================
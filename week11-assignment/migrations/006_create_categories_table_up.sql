@@ -0,0 +1,68 @@
+-- Migration: Create categories table
+-- Version: 006
+-- Description: แยกหมวดหมู่ออกเป็นตาราง categories (slug, ชื่อไทย/อังกฤษ, หมวดแม่, ลำดับการแสดงผล) และเชื่อม books ด้วย foreign key
+
+-- =============================================================================
+-- STEP 1: Create categories table
+-- =============================================================================
+
+CREATE TABLE IF NOT EXISTS categories (
+    id SERIAL PRIMARY KEY,
+    slug VARCHAR(50) UNIQUE NOT NULL,
+    name_en VARCHAR(100) NOT NULL,
+    name_th VARCHAR(100),
+    parent_id INTEGER REFERENCES categories(id) ON DELETE RESTRICT,
+    sort_order INTEGER DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    CONSTRAINT categories_slug_format CHECK (slug ~ '^[a-z0-9]+(-[a-z0-9]+)*$'),
+    CONSTRAINT categories_not_own_parent CHECK (parent_id IS NULL OR parent_id <> id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_categories_parent ON categories(parent_id);
+
+-- =============================================================================
+-- STEP 2: Backfill from existing books
+-- =============================================================================
+
+-- "Fiction", " fiction" และ "fiction" จะได้ slug เดียวกันคือ "fiction"
+INSERT INTO categories (slug, name_en)
+SELECT DISTINCT ON (slug) slug, name_en
+FROM (
+    SELECT TRIM(BOTH '-' FROM regexp_replace(LOWER(TRIM(category)), '[^a-z0-9]+', '-', 'g')) AS slug,
+           INITCAP(TRIM(category)) AS name_en
+    FROM books
+    WHERE category IS NOT NULL
+) c
+WHERE slug <> ''
+ORDER BY slug, name_en
+ON CONFLICT (slug) DO NOTHING;
+
+-- ชื่อภาษาไทยและลำดับของหมวดหมู่ที่มีใน seed data (003)
+UPDATE categories SET name_th = 'นวนิยาย', sort_order = 1 WHERE slug = 'fiction';
+UPDATE categories SET name_en = 'Non-Fiction', name_th = 'สารคดี', sort_order = 2 WHERE slug = 'non-fiction';
+UPDATE categories SET name_th = 'จิตวิทยา', sort_order = 3 WHERE slug = 'psychology';
+UPDATE categories SET name_th = 'ธุรกิจ', sort_order = 4 WHERE slug = 'business';
+UPDATE categories SET name_th = 'ประวัติศาสตร์', sort_order = 5 WHERE slug = 'history';
+UPDATE categories SET name_th = 'เทคโนโลยี', sort_order = 6 WHERE slug = 'technology';
+
+-- =============================================================================
+-- STEP 3: Link books to categories
+-- =============================================================================
+
+ALTER TABLE books ADD COLUMN IF NOT EXISTS category_id INTEGER REFERENCES categories(id) ON DELETE RESTRICT;
+
+UPDATE books b
+SET category_id = c.id,
+    category = c.slug
+FROM categories c
+WHERE c.slug = TRIM(BOTH '-' FROM regexp_replace(LOWER(TRIM(b.category)), '[^a-z0-9]+', '-', 'g'));
+
+CREATE INDEX IF NOT EXISTS idx_books_category_id ON books(category_id);
+
+COMMENT ON COLUMN books.category IS 'slug ของหมวดหมู่ (ซิงก์กับ categories.slug ผ่าน category_id)';
+COMMENT ON COLUMN books.category_id IS 'หมวดหมู่ของหนังสือ (FK ไปที่ categories)';
+
+-- =============================================================================
+-- Migration completed successfully!
+-- =============================================================================
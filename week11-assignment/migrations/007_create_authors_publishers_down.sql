@@ -0,0 +1,16 @@
+-- Rollback Migration: Drop authors and publishers tables
+-- Version: 007
+-- Description: ลบตาราง book_authors, authors, publishers (books.author และ books.publisher ยังเก็บชื่อไว้เหมือนเดิม)
+
+DROP INDEX IF EXISTS idx_books_publisher_id;
+
+ALTER TABLE books DROP COLUMN IF EXISTS publisher_id;
+
+DROP TABLE IF EXISTS book_authors;
+DROP TABLE IF EXISTS authors;
+DROP TABLE IF EXISTS publishers;
+
+-- =============================================================================
+-- Rollback completed successfully!
+-- Table structure has been reverted to version 006
+-- =============================================================================
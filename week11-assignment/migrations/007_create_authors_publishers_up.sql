@@ -0,0 +1,86 @@
+-- Migration: Create authors and publishers tables
+-- Version: 007
+-- Description: แยกผู้แต่งและสำนักพิมพ์ออกเป็นตารางของตัวเอง เชื่อม books กับ authors แบบ many-to-many (เรียงลำดับผู้แต่งได้)
+
+-- =============================================================================
+-- STEP 1: Create tables
+-- =============================================================================
+
+CREATE TABLE IF NOT EXISTS authors (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) UNIQUE NOT NULL,
+    aliases TEXT[] NOT NULL DEFAULT '{}',
+    bio TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS publishers (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) UNIQUE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- author_order: 1 = ผู้แต่งหลัก, 2 = ผู้แต่งร่วมคนที่สอง, ...
+CREATE TABLE IF NOT EXISTS book_authors (
+    book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    author_id INTEGER NOT NULL REFERENCES authors(id) ON DELETE RESTRICT,
+    author_order INTEGER NOT NULL DEFAULT 1,
+    PRIMARY KEY (book_id, author_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_book_authors_author ON book_authors(author_id);
+
+ALTER TABLE books ADD COLUMN IF NOT EXISTS publisher_id INTEGER REFERENCES publishers(id) ON DELETE RESTRICT;
+
+CREATE INDEX IF NOT EXISTS idx_books_publisher_id ON books(publisher_id);
+
+-- =============================================================================
+-- STEP 2: Backfill authors from books.author
+-- =============================================================================
+
+-- แยกชื่อผู้แต่งร่วมด้วย " and ", "," หรือ "&"
+-- เช่น 'Nuttachot Promrit and Sajjaporn Waijanya' -> 2 แถว
+-- กติกาเดียวกับ splitAuthors() ใน authors.go
+INSERT INTO authors (name)
+SELECT DISTINCT TRIM(a.name)
+FROM books, regexp_split_to_table(books.author, '\s+and\s+|\s*[,&]\s*', 'i') AS a(name)
+WHERE TRIM(a.name) <> ''
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO book_authors (book_id, author_id, author_order)
+SELECT b.id, au.id, MIN(a.ord)
+FROM books b
+CROSS JOIN LATERAL regexp_split_to_table(b.author, '\s+and\s+|\s*[,&]\s*', 'i') WITH ORDINALITY AS a(name, ord)
+JOIN authors au ON au.name = TRIM(a.name)
+GROUP BY b.id, au.id
+ON CONFLICT DO NOTHING;
+
+-- ชื่ออื่นที่ผู้อ่านมักใช้ค้นหา
+UPDATE authors SET aliases = ARRAY['Francis Scott Fitzgerald'] WHERE name = 'F. Scott Fitzgerald';
+UPDATE authors SET aliases = ARRAY['Eric Arthur Blair'] WHERE name = 'George Orwell';
+UPDATE authors SET aliases = ARRAY['Uncle Bob', 'Bob Martin'] WHERE name = 'Robert C. Martin';
+UPDATE authors SET aliases = ARRAY['ซุนวู', 'Sunzi'] WHERE name = 'Sun Tzu';
+
+-- =============================================================================
+-- STEP 3: Backfill publishers from books.publisher
+-- =============================================================================
+
+INSERT INTO publishers (name)
+SELECT DISTINCT TRIM(publisher)
+FROM books
+WHERE publisher IS NOT NULL AND TRIM(publisher) <> ''
+ON CONFLICT (name) DO NOTHING;
+
+UPDATE books b
+SET publisher_id = p.id
+FROM publishers p
+WHERE p.name = TRIM(b.publisher);
+
+COMMENT ON COLUMN authors.aliases IS 'ชื่ออื่นของผู้แต่ง (นามปากกา ชื่อจริง ชื่อภาษาไทย) ใช้ในการค้นหา';
+COMMENT ON COLUMN books.publisher_id IS 'สำนักพิมพ์ (FK ไปที่ publishers) books.publisher ยังเก็บชื่อไว้สำหรับแสดงผล';
+
+-- =============================================================================
+-- Migration completed successfully!
+-- =============================================================================
@@ -0,0 +1,10 @@
+-- Rollback Migration: Remove row version from books
+-- Version: 008
+-- Description: ลบคอลัมน์ version
+
+ALTER TABLE books DROP COLUMN IF EXISTS version;
+
+-- =============================================================================
+-- Rollback completed successfully!
+-- Table structure has been reverted to version 007
+-- =============================================================================
@@ -0,0 +1,13 @@
+-- Migration: Add row version to books
+-- Version: 008
+-- Description: เพิ่มคอลัมน์ version สำหรับ optimistic concurrency (ETag / If-Match) ทุกครั้งที่แก้ไขหนังสือต้องเพิ่มค่านี้
+
+-- =============================================================================
+-- STEP 1: Add column
+-- =============================================================================
+
+ALTER TABLE books ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+-- =============================================================================
+-- Migration completed successfully!
+-- =============================================================================
@@ -0,0 +1,12 @@
+-- Rollback Migration: Remove soft delete from books
+-- Version: 009
+-- Description: ลบคอลัมน์ deleted_at (หนังสือในถังขยะจะกลับมาแสดงผลทั้งหมด)
+
+DROP INDEX IF EXISTS idx_books_deleted_at;
+
+ALTER TABLE books DROP COLUMN IF EXISTS deleted_at;
+
+-- =============================================================================
+-- Rollback completed successfully!
+-- Table structure has been reverted to version 008
+-- =============================================================================
@@ -0,0 +1,22 @@
+-- Migration: Soft delete for books
+-- Version: 009
+-- Description: เพิ่ม deleted_at ให้การลบหนังสือเป็นการย้ายเข้าถังขยะ แถวยังอยู่ให้ประวัติคำสั่งซื้อและ audit_logs อ้างอิงได้
+
+-- =============================================================================
+-- STEP 1: Add column
+-- =============================================================================
+
+-- NULL = ยังขายอยู่, มีค่า = อยู่ในถังขยะตั้งแต่เวลานั้น
+-- isbn ยังคง UNIQUE รวมแถวในถังขยะ เพื่อให้ restore ได้เสมอโดยไม่ชนกับหนังสือเล่มใหม่
+ALTER TABLE books ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+-- =============================================================================
+-- STEP 2: Create indexes
+-- =============================================================================
+
+-- สำหรับหน้า trash และ purge job (แถวที่ถูกลบมีน้อย index จึงเล็ก)
+CREATE INDEX IF NOT EXISTS idx_books_deleted_at ON books(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- =============================================================================
+-- Migration completed successfully!
+-- =============================================================================
@@ -0,0 +1,12 @@
+-- Rollback Migration: Remove book revisions
+-- Version: 010
+-- Description: ลบ trigger และตาราง book_revisions (ประวัติทั้งหมดจะหายไป)
+
+DROP TRIGGER IF EXISTS trg_books_revision ON books;
+DROP FUNCTION IF EXISTS record_book_revision();
+DROP TABLE IF EXISTS book_revisions;
+
+-- =============================================================================
+-- Rollback completed successfully!
+-- Table structure has been reverted to version 009
+-- =============================================================================
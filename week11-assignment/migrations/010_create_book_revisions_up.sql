@@ -0,0 +1,86 @@
+-- Migration: Create book revisions
+-- Version: 010
+-- Description: เก็บ snapshot ก่อน/หลังของหนังสือทุกครั้งที่ create, update, delete ด้วย trigger
+--              ครอบคลุมทุก service ที่เขียนตาราง books (week11-assignment และ week13-lab6)
+
+-- =============================================================================
+-- STEP 1: Create table
+-- =============================================================================
+
+-- ไม่มี FK ไปที่ books เพราะประวัติต้องอยู่ต่อหลัง purge
+-- changed_by คือ users.id ของ week13-lab6 (NULL = ไม่ทราบผู้แก้ไข หรือเป็นงานของระบบ)
+CREATE TABLE IF NOT EXISTS book_revisions (
+    id BIGSERIAL PRIMARY KEY,
+    book_id INTEGER NOT NULL,
+    operation VARCHAR(20) NOT NULL CHECK (operation IN ('baseline', 'create', 'update', 'delete', 'restore', 'purge')),
+    before JSONB,
+    after JSONB,
+    changed_by INTEGER,
+    changed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_book_revisions_book ON book_revisions(book_id, changed_at);
+
+-- =============================================================================
+-- STEP 2: Create trigger
+-- =============================================================================
+
+-- ผู้แก้ไขส่งมาทาง SELECT set_config('app.user_id', '<id>', true) ภายใน transaction เดียวกัน
+-- soft delete / restore คือ UPDATE ที่ deleted_at เปลี่ยน, purge คือ DELETE จริง
+CREATE OR REPLACE FUNCTION record_book_revision() RETURNS TRIGGER AS $$
+DECLARE
+    op TEXT;
+    target_id INTEGER;
+    before_row JSONB;
+    after_row JSONB;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        op := 'create';
+        target_id := NEW.id;
+        after_row := to_jsonb(NEW) - 'search_vector';
+    ELSIF TG_OP = 'DELETE' THEN
+        op := 'purge';
+        target_id := OLD.id;
+        before_row := to_jsonb(OLD) - 'search_vector';
+    ELSE
+        target_id := NEW.id;
+        before_row := to_jsonb(OLD) - 'search_vector';
+        after_row := to_jsonb(NEW) - 'search_vector';
+        IF before_row = after_row THEN
+            RETURN NULL;
+        END IF;
+        IF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+            op := 'delete';
+        ELSIF OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+            op := 'restore';
+        ELSE
+            op := 'update';
+        END IF;
+    END IF;
+
+    INSERT INTO book_revisions (book_id, operation, before, after, changed_by)
+    VALUES (target_id, op, before_row, after_row,
+            NULLIF(current_setting('app.user_id', true), '')::INTEGER);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_books_revision ON books;
+
+CREATE TRIGGER trg_books_revision
+    AFTER INSERT OR UPDATE OR DELETE ON books
+    FOR EACH ROW EXECUTE FUNCTION record_book_revision();
+
+-- =============================================================================
+-- STEP 3: Baseline snapshot of existing books
+-- =============================================================================
+
+-- หนังสือที่มีอยู่ก่อน migration นี้ไม่มีประวัติเก่า ใช้สถานะปัจจุบันเป็นจุดเริ่มต้น ณ เวลาแก้ไขล่าสุด
+INSERT INTO book_revisions (book_id, operation, after, changed_at)
+SELECT id, 'baseline', to_jsonb(b) - 'search_vector', COALESCE(updated_at, created_at, NOW())
+FROM books b
+WHERE NOT EXISTS (SELECT 1 FROM book_revisions r WHERE r.book_id = b.id);
+
+-- =============================================================================
+-- Migration completed successfully!
+-- =============================================================================
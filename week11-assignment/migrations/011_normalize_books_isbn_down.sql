@@ -0,0 +1,8 @@
+-- Rollback Migration: Normalize ISBNs to ISBN-13
+-- Version: 011
+-- Description: ไม่มีการเปลี่ยนโครงสร้างตาราง ISBN ที่ normalize แล้วยังคงเป็น ISBN-13 (ใช้งานได้ทั้งสองเวอร์ชัน)
+
+-- =============================================================================
+-- Rollback completed successfully!
+-- Table structure has been reverted to version 010
+-- =============================================================================
@@ -0,0 +1,34 @@
+-- Migration: Normalize ISBNs to ISBN-13
+-- Version: 011
+-- Description: เก็บ ISBN ในรูปแบบ ISBN-13 ไม่มีขีด (แบบเดียวกับ normalizeISBN() ใน isbn.go) และ ISBN ว่างเป็น NULL
+
+-- =============================================================================
+-- STEP 1: Fix seed data typos
+-- =============================================================================
+
+-- check digit ใน 003_seed_books_data.sql ผิด 3 เล่ม (ค่าที่ถูกต้องตามปกหนังสือจริง)
+UPDATE books SET isbn = '9781590302255' WHERE isbn = '978-1-59030-225-6';
+UPDATE books SET isbn = '9780132350884' WHERE isbn = '978-0-13-235088-2';
+UPDATE books SET isbn = '9781612680194' WHERE isbn = '978-1-61268-019-0';
+
+-- =============================================================================
+-- STEP 2: Normalize
+-- =============================================================================
+
+-- ตัดขีดและช่องว่าง, ค่าว่างเป็น NULL (UNIQUE ยอมให้ NULL ซ้ำได้ แต่ '' ซ้ำไม่ได้)
+UPDATE books
+SET isbn = NULLIF(UPPER(REGEXP_REPLACE(isbn, '[\s-]', '', 'g')), '')
+WHERE isbn IS DISTINCT FROM NULLIF(UPPER(REGEXP_REPLACE(isbn, '[\s-]', '', 'g')), '');
+
+-- ISBN-10 -> ISBN-13: 978 + 9 หลักแรก + check digit ใหม่ (EAN-13)
+UPDATE books b
+SET isbn = body || ((10 - (
+        SELECT SUM(SUBSTRING(body FROM i FOR 1)::INTEGER * CASE WHEN i % 2 = 0 THEN 3 ELSE 1 END)
+        FROM generate_series(1, 12) AS i
+    ) % 10) % 10)::TEXT
+FROM (SELECT id, '978' || LEFT(isbn, 9) AS body FROM books WHERE isbn ~ '^[0-9]{9}[0-9X]$') AS t
+WHERE b.id = t.id;
+
+-- =============================================================================
+-- Migration completed successfully!
+-- =============================================================================
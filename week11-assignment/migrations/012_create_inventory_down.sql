@@ -0,0 +1,12 @@
+-- Rollback Migration: Drop inventory
+-- Version: 012
+-- Description: ลบตาราง inventory (ข้อมูลสต็อกทั้งหมดจะหายไป)
+
+DROP INDEX IF EXISTS idx_inventory_in_stock;
+
+DROP TABLE IF EXISTS inventory;
+
+-- =============================================================================
+-- Rollback completed successfully!
+-- Table structure has been reverted to version 011
+-- =============================================================================
@@ -0,0 +1,29 @@
+-- Migration: Inventory
+-- Version: 012
+-- Description: เพิ่มตาราง inventory เก็บจำนวนสต็อกของหนังสือแต่ละเล่ม (ประวัติการเคลื่อนไหวอยู่ใน week13-lab6 migration8)
+
+-- =============================================================================
+-- STEP 1: Create table
+-- =============================================================================
+
+-- แยกจาก books เพื่อให้การตัดสต็อกไม่เปลี่ยน version (If-Match) และไม่สร้าง book_revisions
+-- ETag ของ GET ยังเปลี่ยนตามสต็อกเพราะคิดจากทั้ง representation (bookETag ใน etag.go)
+-- หนังสือที่ยังไม่มีแถวในตารางนี้ถือว่าสต็อกเป็น 0
+-- RESTRICT: purge job ของ week13-lab6 ลบแถวที่สต็อกเป็น 0 เอง และไม่ purge เล่มที่ยังมีของอยู่
+CREATE TABLE IF NOT EXISTS inventory (
+    book_id INTEGER PRIMARY KEY REFERENCES books(id) ON DELETE RESTRICT,
+    quantity INTEGER NOT NULL DEFAULT 0 CHECK (quantity >= 0),
+    low_stock_threshold INTEGER CHECK (low_stock_threshold >= 0),  -- NULL = ใช้ค่า LOW_STOCK_THRESHOLD ของระบบ
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- =============================================================================
+-- STEP 2: Create indexes
+-- =============================================================================
+
+-- สำหรับ ?in_stock=true
+CREATE INDEX IF NOT EXISTS idx_inventory_in_stock ON inventory(book_id) WHERE quantity > 0;
+
+-- =============================================================================
+-- Migration completed successfully!
+-- =============================================================================
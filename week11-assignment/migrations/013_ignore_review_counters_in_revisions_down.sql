@@ -0,0 +1,46 @@
+-- Rollback Migration: Ignore review counters in book revisions
+-- Version: 013
+-- Description: กลับไปใช้ record_book_revision ของ 010 (เก็บ revision ทุกครั้งที่แถวเปลี่ยน รวมถึง rating/reviews)
+
+CREATE OR REPLACE FUNCTION record_book_revision() RETURNS TRIGGER AS $$
+DECLARE
+    op TEXT;
+    target_id INTEGER;
+    before_row JSONB;
+    after_row JSONB;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        op := 'create';
+        target_id := NEW.id;
+        after_row := to_jsonb(NEW) - 'search_vector';
+    ELSIF TG_OP = 'DELETE' THEN
+        op := 'purge';
+        target_id := OLD.id;
+        before_row := to_jsonb(OLD) - 'search_vector';
+    ELSE
+        target_id := NEW.id;
+        before_row := to_jsonb(OLD) - 'search_vector';
+        after_row := to_jsonb(NEW) - 'search_vector';
+        IF before_row = after_row THEN
+            RETURN NULL;
+        END IF;
+        IF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+            op := 'delete';
+        ELSIF OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+            op := 'restore';
+        ELSE
+            op := 'update';
+        END IF;
+    END IF;
+
+    INSERT INTO book_revisions (book_id, operation, before, after, changed_by)
+    VALUES (target_id, op, before_row, after_row,
+            NULLIF(current_setting('app.user_id', true), '')::INTEGER);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- =============================================================================
+-- Rollback completed successfully!
+-- Table structure has been reverted to version 012
+-- =============================================================================
@@ -0,0 +1,52 @@
+-- Migration: Ignore review counters in book revisions
+-- Version: 013
+-- Description: books.rating / books.reviews คำนวณใหม่ทุกครั้งที่มีรีวิว (week13-lab6 migration7)
+--              การเปลี่ยนเฉพาะสองค่านี้ไม่ใช่การแก้ไขหนังสือ ไม่ต้องเก็บเป็น revision
+
+-- =============================================================================
+-- STEP 1: Replace trigger function
+-- =============================================================================
+
+-- trigger trg_books_revision จาก 010 เรียกฟังก์ชันนี้อยู่แล้ว แทนที่แค่ตัวฟังก์ชัน
+CREATE OR REPLACE FUNCTION record_book_revision() RETURNS TRIGGER AS $$
+DECLARE
+    op TEXT;
+    target_id INTEGER;
+    before_row JSONB;
+    after_row JSONB;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        op := 'create';
+        target_id := NEW.id;
+        after_row := to_jsonb(NEW) - 'search_vector';
+    ELSIF TG_OP = 'DELETE' THEN
+        op := 'purge';
+        target_id := OLD.id;
+        before_row := to_jsonb(OLD) - 'search_vector';
+    ELSE
+        target_id := NEW.id;
+        before_row := to_jsonb(OLD) - 'search_vector';
+        after_row := to_jsonb(NEW) - 'search_vector';
+        -- rating/reviews เป็นค่าสรุปจากรีวิว ถ้าเปลี่ยนแค่สองค่านี้ไม่ใช่การแก้ไขหนังสือ
+        IF before_row - 'rating' - 'reviews' = after_row - 'rating' - 'reviews' THEN
+            RETURN NULL;
+        END IF;
+        IF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+            op := 'delete';
+        ELSIF OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+            op := 'restore';
+        ELSE
+            op := 'update';
+        END IF;
+    END IF;
+
+    INSERT INTO book_revisions (book_id, operation, before, after, changed_by)
+    VALUES (target_id, op, before_row, after_row,
+            NULLIF(current_setting('app.user_id', true), '')::INTEGER);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- =============================================================================
+-- Migration completed successfully!
+-- =============================================================================
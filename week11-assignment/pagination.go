@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// bookSelectColumns คือรายการคอลัมน์มาตรฐานที่ต้อง Scan ด้วย scanBook
+const bookSelectColumns = `
+	id, title, author, COALESCE(isbn, '') as isbn, COALESCE(year, 0) as year, price,
+	COALESCE(category, '') as category,
+	COALESCE(cover_image, '') as cover_image,
+	COALESCE(description, '') as description,
+	COALESCE(rating, 0) as rating,
+	COALESCE(reviews, 0) as reviews,
+	COALESCE(is_new, false) as is_new,
+	COALESCE(discount, 0) as discount,
+	COALESCE(original_price, 0) as original_price,
+	COALESCE(pages, 0) as pages,
+	COALESCE(language, '') as language,
+	COALESCE(publisher, '') as publisher,
+	COALESCE(publisher_id, 0) as publisher_id,
+	COALESCE((SELECT quantity FROM inventory WHERE inventory.book_id = books.id), 0) as stock_quantity,
+	version,
+	created_at, updated_at`
+
+// BookPage is the paged envelope returned by the book listing endpoints.
+type BookPage struct {
+	Items      []Book `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Total      int    `json:"total"`
+	Facets     Facets `json:"facets,omitempty"`
+}
+
+// sortField describes one sortable column: the SQL expression used in
+// ORDER BY and the type the cursor value is cast back to.
+type sortField struct {
+	expr string
+	cast string
+}
+
+var bookSortFields = map[string]sortField{
+	"price":      {"price", "numeric"},
+	"rating":     {"COALESCE(rating, 0)", "numeric"},
+	"year":       {"COALESCE(year, 0)", "integer"},
+	"title":      {"title", "text"},
+	"discount":   {"COALESCE(discount, 0)", "integer"},
+	"created_at": {"created_at", "timestamptz"},
+}
+
+// withSortField returns a copy of fields with one extra request-specific
+// sort (e.g. search relevance, whose expression binds the query text).
+func withSortField(fields map[string]sortField, name string, f sortField) map[string]sortField {
+	out := make(map[string]sortField, len(fields)+1)
+	for k, v := range fields {
+		out[k] = v
+	}
+	out[name] = f
+	return out
+}
+
+// bookCursor ตำแหน่งของแถวสุดท้ายในหน้าก่อนหน้า (keyset) เข้ารหัสเป็น base64 ให้ client
+type bookCursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+func encodeCursor(cur bookCursor) string {
+	raw, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string) (*bookCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var cur bookCursor
+	if err := json.Unmarshal(raw, &cur); err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	return &cur, nil
+}
+
+type pageParams struct {
+	Limit  int
+	Sort   string
+	Order  string
+	Field  sortField
+	Cursor *bookCursor
+}
+
+// parsePageParams reads ?limit, ?cursor, ?sort and ?order from the request.
+// sort must be one of fields.
+func parsePageParams(c *gin.Context, fields map[string]sortField, defaultSort, defaultOrder string) (pageParams, error) {
+	p := pageParams{
+		Limit: defaultPageLimit,
+		Sort:  c.DefaultQuery("sort", defaultSort),
+		Order: strings.ToLower(c.DefaultQuery("order", defaultOrder)),
+	}
+
+	if limitQ := c.Query("limit"); limitQ != "" {
+		limit, err := strconv.Atoi(limitQ)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return p, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+		p.Limit = limit
+	}
+
+	field, ok := fields[p.Sort]
+	if !ok {
+		return p, fmt.Errorf("unsupported sort field: %s", p.Sort)
+	}
+	p.Field = field
+	if p.Order != "asc" && p.Order != "desc" {
+		return p, errors.New("order must be asc or desc")
+	}
+
+	if cursorQ := c.Query("cursor"); cursorQ != "" {
+		cur, err := decodeCursor(cursorQ)
+		if err != nil {
+			return p, err
+		}
+		// cursor ต้องมาจากการเรียงลำดับเดียวกันเท่านั้น
+		if cur.Sort != p.Sort || cur.Order != p.Order {
+			return p, errors.New("cursor does not match sort order")
+		}
+		p.Cursor = cur
+	}
+
+	return p, nil
+}
+
+// bookQuery collects WHERE conditions and their bound arguments.
+type bookQuery struct {
+	where []string
+	args  []interface{}
+}
+
+// newBookQuery starts a query over the live catalog (books in the trash excluded).
+func newBookQuery() *bookQuery {
+	return &bookQuery{where: []string{"deleted_at IS NULL"}}
+}
+
+// arg binds v and returns its positional placeholder ($1, $2, ...).
+func (q *bookQuery) arg(v interface{}) string {
+	q.args = append(q.args, v)
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+func (q *bookQuery) add(cond string) {
+	q.where = append(q.where, cond)
+}
+
+func (q *bookQuery) whereClause() string {
+	if len(q.where) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(q.where, " AND ")
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanBook(row rowScanner) (Book, error) {
+	var book Book
+	err := row.Scan(bookScanDest(&book)...)
+	book.CoverThumbnails = coverThumbnails(book.CoverImage)
+	return book, err
+}
+
+// bookScanDest returns the Scan destinations matching bookSelectColumns.
+func bookScanDest(book *Book) []interface{} {
+	return []interface{}{
+		&book.ID, &book.Title, &book.Author, &book.ISBN, &book.Year, &book.Price,
+		&book.Category, &book.CoverImage, &book.Description, &book.Rating,
+		&book.Reviews, &book.IsNew, &book.Discount, &book.OriginalPrice,
+		&book.Pages, &book.Language, &book.Publisher, &book.PublisherID, &book.StockQuantity, &book.Version,
+		&book.Created_At, &book.Updated_At,
+	}
+}
+
+// fetchBookPage runs q with keyset pagination and returns one page plus the
+// total number of rows matching q (ignoring the cursor).
+func fetchBookPage(q *bookQuery, p pageParams) (BookPage, error) {
+	page := BookPage{Items: []Book{}}
+
+	if err := db.QueryRow("SELECT COUNT(*) FROM books"+q.whereClause(), q.args...).Scan(&page.Total); err != nil {
+		return page, err
+	}
+
+	field := p.Field
+	dir, op := "ASC", ">"
+	if p.Order == "desc" {
+		dir, op = "DESC", "<"
+	}
+
+	// copy เพื่อไม่ให้เงื่อนไขของ cursor ไปปนกับ query ที่ใช้นับ total
+	pq := &bookQuery{
+		where: append([]string{}, q.where...),
+		args:  append([]interface{}{}, q.args...),
+	}
+	if p.Cursor != nil {
+		pq.add(fmt.Sprintf("(%s, id) %s (%s::%s, %s)",
+			field.expr, op, pq.arg(p.Cursor.Value), field.cast, pq.arg(p.Cursor.ID)))
+	}
+
+	// ดึงเกินมา 1 แถวเพื่อดูว่ายังมีหน้าถัดไปหรือไม่
+	// และดึงค่าที่ใช้เรียงออกมาเป็น text เพื่อเก็บลง cursor ได้ตรงตามที่ database เห็น
+	query := fmt.Sprintf("SELECT %s, (%s)::text FROM books%s ORDER BY %s %s, id %s LIMIT %s",
+		bookSelectColumns, field.expr, pq.whereClause(), field.expr, dir, dir, pq.arg(p.Limit+1))
+
+	rows, err := db.Query(query, pq.args...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var book Book
+		var key string
+		if err := rows.Scan(append(bookScanDest(&book), &key)...); err != nil {
+			return page, err
+		}
+		book.CoverThumbnails = coverThumbnails(book.CoverImage)
+		page.Items = append(page.Items, book)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+
+	if len(page.Items) > p.Limit {
+		page.Items = page.Items[:p.Limit]
+		page.NextCursor = encodeCursor(bookCursor{
+			Sort:  p.Sort,
+			Order: p.Order,
+			Value: keys[p.Limit-1],
+			ID:    page.Items[p.Limit-1].ID,
+		})
+	}
+
+	return page, nil
+}
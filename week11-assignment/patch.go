@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// patchField describes one Book field that PATCH may change.
+type patchField struct {
+	// field returns a pointer to the Book field, used to clear it on null.
+	field func(b *Book) interface{}
+	// required fields cannot be removed with null.
+	required bool
+}
+
+// patchableFields ใช้ชื่อตาม json tag ของ Book ฟิลด์ที่ไม่อยู่ในนี้ (id, created_at, ...) แก้ไม่ได้
+// กฎการตรวจค่าอยู่ที่ binding tag ของ Book
+var patchableFields = map[string]patchField{
+	"title":         {func(b *Book) interface{} { return &b.Title }, true},
+	"author":        {func(b *Book) interface{} { return &b.Author }, true},
+	"isbn":          {func(b *Book) interface{} { return &b.ISBN }, false},
+	"year":          {func(b *Book) interface{} { return &b.Year }, false},
+	"price":         {func(b *Book) interface{} { return &b.Price }, true},
+	"category":      {func(b *Book) interface{} { return &b.Category }, false},
+	"coverImage":    {func(b *Book) interface{} { return &b.CoverImage }, false},
+	"description":   {func(b *Book) interface{} { return &b.Description }, false},
+	"isNew":         {func(b *Book) interface{} { return &b.IsNew }, false},
+	"discount":      {func(b *Book) interface{} { return &b.Discount }, false},
+	"originalPrice": {func(b *Book) interface{} { return &b.OriginalPrice }, false},
+	"pages":         {func(b *Book) interface{} { return &b.Pages }, false},
+	"language":      {func(b *Book) interface{} { return &b.Language }, false},
+	"publisher":     {func(b *Book) interface{} { return &b.Publisher }, false},
+}
+
+// applyMergePatch applies an RFC 7396 merge patch to book. Only the members
+// present in patch change; null clears an optional field. Bad members are
+// collected as FieldErrors; err is set only when patch isn't a JSON object.
+func applyMergePatch(book *Book, patch []byte) (fields []FieldError, err error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &members); err != nil || members == nil {
+		return nil, errors.New("patch must be a JSON object")
+	}
+
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var patched []string
+	for _, name := range names {
+		raw := members[name]
+		f, ok := patchableFields[name]
+		if !ok {
+			fields = append(fields, FieldError{Field: name, Code: "read_only", Message: "cannot be patched"})
+			continue
+		}
+		if string(bytes.TrimSpace(raw)) == "null" {
+			if f.required {
+				fields = append(fields, FieldError{Field: name, Code: "required", Message: "is required"})
+				continue
+			}
+			v := reflect.ValueOf(f.field(book)).Elem()
+			v.Set(reflect.Zero(v.Type()))
+			continue
+		}
+		if err := json.Unmarshal(raw, f.field(book)); err != nil {
+			fields = append(fields, typeFieldError(name, reflect.TypeOf(f.field(book)).Elem()))
+			continue
+		}
+		patched = append(patched, name)
+	}
+
+	// ตรวจเฉพาะฟิลด์ที่ส่งมา ข้อมูลเก่าที่ไม่ผ่านกฎใหม่ (เช่น year ติดลบ) จะไม่ขวางการแก้ฟิลด์อื่น
+	if verr := validateBookFields(book, patched); verr != nil {
+		more, _ := fieldErrors(verr)
+		fields = append(fields, more...)
+	}
+	return fields, nil
+}
+
+// @Summary Partially update a book
+// @Description Update only the supplied fields (JSON Merge Patch, RFC 7396). null clears an optional field.
+// @Tags Books
+// @Accept json
+// @Produce json
+// @Param id path int true "Book ID"
+// @Param If-Match header string false "ETag from GET /books/{id}"
+// @Param patch body object true "Fields to change, e.g. {\"price\": 299}"
+// @Success 200 {object} Book
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 412 {object} ErrorResponse
+// @Failure 415 {object} ErrorResponse
+// @Failure 422 {object} ValidationErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/books/{id} [patch]
+func patchBook(c *gin.Context) {
+	id := c.Param("id")
+
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if mediaType != "application/merge-patch+json" && mediaType != "application/json" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be application/merge-patch+json"})
+		return
+	}
+
+	patch, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	book, ok := lockBook(c, tx, id)
+	if !ok {
+		return
+	}
+
+	fields, err := applyMergePatch(&book, patch)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(fields) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, ValidationErrorResponse{Error: "validation failed", Fields: fields})
+		return
+	}
+	if book.ISBN, err = normalizeISBN(book.ISBN); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	categoryID, err := resolveCategory(&book.Category)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := saveBook(tx, id, &book, categoryID); isISBNConflict(err) {
+		respondISBNConflict(c, book.ISBN)
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// อ่านกลับอีกครั้งเพื่อให้ได้ representation เดียวกับ GET (publisherId, authors)
+	if book, err = loadBook(book.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("ETag", bookETag(book))
+	c.JSON(http.StatusOK, book)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/lib/pq"
+)
+
+// SearchHit is a book returned by /books/search with its relevance score
+// and highlighted snippets (matches wrapped in <mark>...</mark>).
+type SearchHit struct {
+	Book
+	Rank       float64       `json:"rank"`
+	Highlights BookHighlight `json:"highlights"`
+}
+
+type BookHighlight struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+type SearchPage struct {
+	Items      []SearchHit `json:"items"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	Total      int         `json:"total"`
+	Facets     Facets      `json:"facets,omitempty"`
+}
+
+const headlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, ShortWord=2"
+
+func isThai(r rune) bool {
+	return r >= 0x0E01 && r <= 0x0E5B
+}
+
+// searchWords splits text into runs of Thai or non-Thai letters/digits.
+// Everything else (spaces, punctuation, tsquery operators) is a separator,
+// so user input can never inject tsquery syntax.
+func searchWords(text string) []string {
+	var words []string
+	var cur []rune
+	thai := false
+	flush := func() {
+		if len(cur) > 0 {
+			words = append(words, string(cur))
+			cur = cur[:0]
+		}
+	}
+	for _, r := range text {
+		switch {
+		case isThai(r):
+			if !thai {
+				flush()
+			}
+			thai = true
+			cur = append(cur, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if thai {
+				flush()
+			}
+			thai = false
+			cur = append(cur, unicode.ToLower(r))
+		default:
+			flush()
+		}
+	}
+	flush()
+	return words
+}
+
+// thaiBigrams mirrors the thai_bigrams() SQL function from migration 004.
+func thaiBigrams(word string) []string {
+	runes := []rune(word)
+	if len(runes) == 1 {
+		return []string{fmt.Sprintf("th%x", runes[0])}
+	}
+	grams := make([]string, 0, len(runes)-1)
+	for i := 0; i < len(runes)-1; i++ {
+		grams = append(grams, fmt.Sprintf("th%x%x", runes[i], runes[i+1]))
+	}
+	return grams
+}
+
+// phraseTerm turns text into lexemes that must appear next to each other.
+func phraseTerm(text string) (term string, lexemes int) {
+	var parts []string
+	for _, w := range searchWords(text) {
+		if isThai([]rune(w)[0]) {
+			parts = append(parts, thaiBigrams(w)...)
+		} else {
+			parts = append(parts, w)
+		}
+	}
+	if len(parts) > 1 {
+		return "(" + strings.Join(parts, " <-> ") + ")", len(parts)
+	}
+	return strings.Join(parts, ""), len(parts)
+}
+
+// buildTSQuery converts the user's keyword into to_tsquery('english', ...) syntax.
+//
+//	gatsby great      -> gatsby & great
+//	"great gatsby"    -> (great <-> gatsby)      phrase
+//	gats*             -> gats:*                  prefix
+//	ความฝัน            -> (thXX <-> thXX <-> ...) Thai bigrams
+func buildTSQuery(keyword string) string {
+	var terms []string
+	for i, part := range strings.Split(keyword, `"`) {
+		// ส่วนที่อยู่ระหว่างเครื่องหมาย " คือ phrase
+		if i%2 == 1 {
+			if term, _ := phraseTerm(part); term != "" {
+				terms = append(terms, term)
+			}
+			continue
+		}
+		for _, field := range strings.Fields(part) {
+			prefix := strings.HasSuffix(field, "*")
+			term, n := phraseTerm(strings.TrimRight(field, "*"))
+			if term == "" {
+				continue
+			}
+			if prefix && n == 1 {
+				term += ":*"
+			}
+			terms = append(terms, term)
+		}
+	}
+	return strings.Join(terms, " & ")
+}
+
+// searchHighlights loads rank and ts_headline snippets for the given books.
+func searchHighlights(tsquery string, books []Book) ([]SearchHit, error) {
+	hits := make([]SearchHit, len(books))
+	if len(books) == 0 {
+		return hits, nil
+	}
+
+	ids := make([]int64, len(books))
+	index := make(map[int]int, len(books))
+	for i, b := range books {
+		hits[i].Book = b
+		ids[i] = int64(b.ID)
+		index[b.ID] = i
+	}
+
+	rows, err := db.Query(`
+		SELECT id,
+		       ts_rank(search_vector, query),
+		       ts_headline('english', title, query, $2),
+		       ts_headline('english', COALESCE(description, ''), query, $2)
+		FROM books, to_tsquery('english', $1) AS query
+		WHERE id = ANY($3)
+	`, tsquery, headlineOptions, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var h SearchHit
+		if err := rows.Scan(&id, &h.Rank, &h.Highlights.Title, &h.Highlights.Description); err != nil {
+			return nil, err
+		}
+		i := index[id]
+		hits[i].Rank = h.Rank
+		hits[i].Highlights = h.Highlights
+	}
+	return hits, rows.Err()
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var errObjectNotFound = errors.New("object not found")
+
+// objectInfo describes a stored object when it is read back.
+type objectInfo struct {
+	ContentType string
+	Size        int64
+}
+
+// coverStorage stores cover images by key (e.g. "12/ab34.../w320.jpg").
+// Keys are content-addressed, so an object is never overwritten with
+// different bytes and can be cached forever.
+type coverStorage interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, objectInfo, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// newCoverStorage เลือก backend จาก COVER_STORAGE (local หรือ s3)
+func newCoverStorage() (coverStorage, error) {
+	switch backend := getEnv("COVER_STORAGE", "local"); backend {
+	case "local":
+		return newLocalStorage(getEnv("COVER_DIR", "./uploads/covers"))
+	case "s3":
+		s := &s3Storage{
+			endpoint:  strings.TrimRight(getEnv("S3_ENDPOINT", "https://s3.amazonaws.com"), "/"),
+			region:    getEnv("S3_REGION", "us-east-1"),
+			bucket:    os.Getenv("S3_BUCKET"),
+			accessKey: os.Getenv("S3_ACCESS_KEY"),
+			secretKey: os.Getenv("S3_SECRET_KEY"),
+			client:    &http.Client{Timeout: 30 * time.Second},
+		}
+		if s.bucket == "" || s.accessKey == "" || s.secretKey == "" {
+			return nil, errors.New("S3_BUCKET, S3_ACCESS_KEY and S3_SECRET_KEY are required when COVER_STORAGE=s3")
+		}
+		if err := s.ensureBucket(context.Background()); err != nil {
+			return nil, err
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown COVER_STORAGE %q, expected local or s3", backend)
+	}
+}
+
+// ===================== Local filesystem =====================
+
+type localStorage struct {
+	root string
+}
+
+func newLocalStorage(root string) (*localStorage, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &localStorage{root: root}, nil
+}
+
+// path กัน key แบบ ../ หลุดออกนอก root
+func (s *localStorage) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean == "/" || clean != "/"+key {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(clean)), nil
+}
+
+func (s *localStorage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	// เขียนไฟล์ชั่วคราวก่อนแล้ว rename เพื่อไม่ให้ใครอ่านไฟล์ที่เขียนไม่ครบ
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (s *localStorage) Get(ctx context.Context, key string) (io.ReadCloser, objectInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, objectInfo{}, errObjectNotFound
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, objectInfo{}, errObjectNotFound
+	} else if err != nil {
+		return nil, objectInfo{}, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, objectInfo{}, err
+	}
+	return f, objectInfo{ContentType: mime.TypeByExtension(path.Ext(key)), Size: stat.Size()}, nil
+}
+
+func (s *localStorage) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	// ลบโฟลเดอร์ที่ว่างแล้ว (Remove ไม่ลบโฟลเดอร์ที่ยังมีไฟล์)
+	for dir := filepath.Dir(p); dir != filepath.Clean(s.root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// ===================== S3-compatible =====================
+
+// s3Storage talks to S3 or any S3-compatible server (MinIO, R2, ...) using
+// path-style URLs and AWS Signature Version 4.
+type s3Storage struct {
+	endpoint  string
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+func (s *s3Storage) objectURL(key string) string {
+	return s.endpoint + "/" + s.bucket + "/" + s3EscapePath(key)
+}
+
+// ensureBucket checks the bucket with HEAD and creates it only when it is
+// missing (handy for MinIO in docker-compose). Credentials limited to
+// object access get 403 on HEAD; that isn't fatal, the first upload will
+// tell whether they work.
+func (s *s3Storage) ensureBucket(ctx context.Context) error {
+	resp, err := s.do(ctx, http.MethodHead, s.endpoint+"/"+s.bucket, nil, "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusForbidden:
+		log.Printf("s3: no permission to check bucket %q, assuming it exists", s.bucket)
+		return nil
+	case http.StatusNotFound:
+		return s.createBucket(ctx)
+	}
+	return fmt.Errorf("s3 HEAD /%s: %s", s.bucket, resp.Status)
+}
+
+// createBucket สร้าง bucket ใน region ที่ตั้งไว้ นอก us-east-1 ต้องส่ง LocationConstraint ไปด้วย
+func (s *s3Storage) createBucket(ctx context.Context) error {
+	var body []byte
+	if s.region != "us-east-1" {
+		body = []byte(`<CreateBucketConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/">` +
+			`<LocationConstraint>` + s.region + `</LocationConstraint></CreateBucketConfiguration>`)
+	}
+	resp, err := s.do(ctx, http.MethodPut, s.endpoint+"/"+s.bucket, body, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	// instance อื่นสร้างไปก่อนระหว่าง HEAD กับ PUT ถือว่าใช้ได้ แต่ชื่อที่บัญชีอื่นเป็นเจ้าของ (BucketAlreadyExists) ใช้ไม่ได้
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode == http.StatusConflict && strings.Contains(string(msg), "BucketAlreadyOwnedByYou") {
+		return nil
+	}
+	return fmt.Errorf("s3 PUT /%s: %s %s", s.bucket, resp.Status, strings.TrimSpace(string(msg)))
+}
+
+func (s *s3Storage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	resp, err := s.do(ctx, http.MethodPut, s.objectURL(key), data, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+func (s *s3Storage) Get(ctx context.Context, key string) (io.ReadCloser, objectInfo, error) {
+	resp, err := s.do(ctx, http.MethodGet, s.objectURL(key), nil, "")
+	if err != nil {
+		return nil, objectInfo{}, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, objectInfo{ContentType: resp.Header.Get("Content-Type"), Size: resp.ContentLength}, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, objectInfo{}, errObjectNotFound
+	}
+	defer resp.Body.Close()
+	return nil, objectInfo{}, s3Error(resp)
+}
+
+func (s *s3Storage) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, s.objectURL(key), nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+func (s *s3Storage) do(ctx context.Context, method, rawURL string, body []byte, contentType string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	signV4(req, body, s.accessKey, s.secretKey, s.region, time.Now())
+	return s.client.Do(req)
+}
+
+func s3Error(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 %s %s: %s %s", resp.Request.Method, resp.Request.URL.Path, resp.Status, strings.TrimSpace(string(msg)))
+}
+
+// s3EscapePath escapes each path segment the way SigV4 canonical URIs expect.
+func s3EscapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, seg := range segments {
+		segments[i] = s3Escape(seg)
+	}
+	return strings.Join(segments, "/")
+}
+
+// s3Escape is RFC 3986 percent-encoding: only A-Z a-z 0-9 - _ . ~ stay as is.
+func s3Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// signV4 adds the AWS Signature Version 4 headers (x-amz-date,
+// x-amz-content-sha256, Authorization) for service s3 to req.
+func signV4(req *http.Request, body []byte, accessKey, secretKey, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	// canonical headers: host + ทุก header ที่ตั้งไว้ เรียงตามชื่อตัวพิมพ์เล็ก
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalURI := req.URL.EscapedPath()
+	if canonicalURI == "" {
+		canonicalURI = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func canonicalQuery(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vs := append([]string(nil), values[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, s3Escape(k)+"="+s3Escape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSuggestLimit = 8
+	maxSuggestLimit     = 20
+	// word_similarity ขั้นต่ำ ค่า default ของ pg_trgm (0.6) เข้มเกินไปสำหรับคำที่พิมพ์สลับตัว เช่น "gatbsy"
+	suggestSimilarityThreshold = "0.3"
+)
+
+// Suggestion is one type-ahead completion.
+type Suggestion struct {
+	Type   string  `json:"type"` // "title" หรือ "author"
+	Text   string  `json:"text"`
+	BookID int     `json:"book_id,omitempty"`
+	Score  float64 `json:"score"`
+}
+
+// @Summary Autocomplete titles and authors
+// @Description Typo-tolerant completions ranked by trigram similarity and popularity
+// @Tags Books
+// @Produce json
+// @Param q query string true "Partial title or author"
+// @Param limit query int false "Number of suggestions (default 8, max 20)"
+// @Success 200 {array} Suggestion
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/books/suggest [get]
+func suggestBooks(c *gin.Context) {
+	keyword := strings.ToLower(strings.TrimSpace(c.Query("q")))
+
+	limit := defaultSuggestLimit
+	if limitQ := c.Query("limit"); limitQ != "" {
+		n, err := strconv.Atoi(limitQ)
+		if err != nil || n < 1 || n > maxSuggestLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 20"})
+			return
+		}
+		limit = n
+	}
+
+	// 1 ตัวอักษรยังไม่มี trigram พอให้เทียบ ส่งรายการว่างกลับไปเลย
+	if utf8.RuneCountInString(keyword) < 2 {
+		c.JSON(http.StatusOK, []Suggestion{})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	// SET LOCAL มีผลเฉพาะใน transaction นี้ ไม่กระทบ connection อื่นใน pool
+	if _, err := tx.Exec("SET LOCAL pg_trgm.word_similarity_threshold = " + suggestSimilarityThreshold); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// score = ความคล้าย 80% + rating 10% + จำนวนรีวิว (log scale) 10%
+	rows, err := tx.Query(`
+		SELECT kind, value, book_id,
+		       sim * 0.8 + rating / 5 * 0.1 + LEAST(LN(1 + reviews) / LN(1001), 1) * 0.1 AS score
+		FROM (
+			SELECT 'title' AS kind, title AS value, MIN(id) AS book_id,
+			       MAX(word_similarity($1, LOWER(title))) AS sim,
+			       MAX(COALESCE(rating, 0)) AS rating,
+			       SUM(COALESCE(reviews, 0)) AS reviews
+			FROM books
+			WHERE $1 <% LOWER(title) AND deleted_at IS NULL
+			GROUP BY title
+			UNION ALL
+			SELECT 'author', author, 0,
+			       MAX(word_similarity($1, LOWER(author))),
+			       MAX(COALESCE(rating, 0)),
+			       SUM(COALESCE(reviews, 0))
+			FROM books
+			WHERE $1 <% LOWER(author) AND deleted_at IS NULL
+			GROUP BY author
+		) s
+		ORDER BY score DESC, value
+		LIMIT $2
+	`, keyword, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	suggestions := []Suggestion{}
+	for rows.Next() {
+		var s Suggestion
+		if err := rows.Scan(&s.Type, &s.Text, &s.BookID, &s.Score); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		suggestions = append(suggestions, s)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// ให้ browser cache ได้สั้น ๆ เพราะ SearchBar เรียกทุกครั้งที่พิมพ์
+	c.Header("Cache-Control", "public, max-age=60")
+	c.JSON(http.StatusOK, suggestions)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError is one failing field in a 422 response. Code is the rule name
+// from the binding tag (required, gte, lte, isbn, ...) for clients to switch on.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+type ValidationErrorResponse struct {
+	Error  string       `json:"error"`
+	Fields []FieldError `json:"fields"`
+}
+
+// กฎเพิ่มเติมที่ validator ไม่มีให้ ใช้ใน binding tag ของ Book
+func init() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+
+	// ใช้ชื่อตาม json tag ใน error เพื่อให้ตรงกับ field ที่ client ส่งมา
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+
+	v.RegisterValidation("isbn_any", func(fl validator.FieldLevel) bool {
+		_, err := normalizeISBN(fl.Field().String())
+		return err == nil
+	})
+	v.RegisterValidation("url_or_path", func(fl validator.FieldLevel) bool {
+		return isURLOrPath(fl.Field().String())
+	})
+	v.RegisterValidation("max_next_year", func(fl validator.FieldLevel) bool {
+		return fl.Field().Int() <= int64(time.Now().Year()+1)
+	})
+}
+
+// isURLOrPath accepts an absolute http(s) URL or a site path such as /images/books/x.jpg.
+func isURLOrPath(s string) bool {
+	if strings.HasPrefix(s, "/") && !strings.HasPrefix(s, "//") {
+		u, err := url.Parse(s)
+		return err == nil && u.Host == ""
+	}
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func fieldErrorMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "min", "gte":
+		return "must be at least " + fe.Param()
+	case "max", "lte":
+		return "must be at most " + fe.Param()
+	case "max_next_year":
+		return "must not be later than " + strconv.Itoa(time.Now().Year()+1)
+	case "isbn_any":
+		return "must be a valid ISBN-10 or ISBN-13"
+	case "url_or_path":
+		return "must be an http(s) URL or a path starting with /"
+	}
+	return "is invalid (" + fe.Tag() + ")"
+}
+
+// typeFieldError reports a JSON value of the wrong type for field.
+func typeFieldError(field string, t reflect.Type) FieldError {
+	name := t.String()
+	switch t.Kind() {
+	case reflect.Int, reflect.Int64, reflect.Float64:
+		name = "number"
+	case reflect.Bool:
+		name = "boolean"
+	case reflect.String:
+		name = "string"
+	}
+	return FieldError{Field: field, Code: "type", Param: name, Message: "must be a " + name}
+}
+
+// fieldErrors converts binding errors into FieldErrors. ok is false when
+// err is not a validation problem (e.g. malformed JSON).
+func fieldErrors(err error) (fields []FieldError, ok bool) {
+	var verrs validator.ValidationErrors
+	if errors.As(err, &verrs) {
+		for _, fe := range verrs {
+			fields = append(fields, FieldError{
+				Field:   fe.Field(),
+				Code:    fe.Tag(),
+				Param:   fe.Param(),
+				Message: fieldErrorMessage(fe),
+			})
+		}
+		return fields, true
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return []FieldError{typeFieldError(typeErr.Field, typeErr.Type)}, true
+	}
+	return nil, false
+}
+
+// respondBindError ตอบ 422 พร้อมรายการ field ที่ผิด หรือ 400 ถ้า body อ่านไม่ได้เลย
+func respondBindError(c *gin.Context, err error) {
+	if fields, ok := fieldErrors(err); ok {
+		c.JSON(http.StatusUnprocessableEntity, ValidationErrorResponse{Error: "validation failed", Fields: fields})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+// validateBookFields runs Book's binding rules for the given json fields only.
+func validateBookFields(book *Book, jsonNames []string) error {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return nil
+	}
+
+	t := reflect.TypeOf(*book)
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		for _, name := range jsonNames {
+			if tag == name {
+				names = append(names, t.Field(i).Name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return v.StructPartial(book, names...)
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===================== Cart Models =====================
+type Cart struct {
+	Token         string     `json:"token,omitempty"` // เฉพาะ guest cart ส่งกลับมาใน X-Cart-Token
+	Items         []CartItem `json:"items"`
+	ItemCount     int        `json:"item_count"`
+	Subtotal      Money      `json:"subtotal"`
+	TotalDiscount Money      `json:"total_discount"` // ส่วนลดเทียบกับ original_price
+	HasIssues     bool       `json:"has_issues"`     // มีรายการที่ต้องให้ลูกค้าตรวจก่อน checkout
+	UpdatedAt     *time.Time `json:"updated_at,omitempty"`
+}
+
+type CartItem struct {
+	BookID        int      `json:"book_id"`
+	Title         string   `json:"title"`
+	Author        string   `json:"author"`
+	CoverImage    string   `json:"cover_image,omitempty"`
+	Quantity      int      `json:"quantity"`
+	UnitPrice     Money    `json:"unit_price"` // ราคาปัจจุบันของ books.price
+	OriginalPrice Money    `json:"original_price,omitempty"`
+	Discount      int      `json:"discount,omitempty"`
+	LineTotal     Money    `json:"line_total"`
+	PreviousPrice *Money   `json:"previous_price,omitempty"` // ราคาตอนหยิบใส่ cart ถ้าเปลี่ยนไปแล้ว
+	Available     int      `json:"available"`
+	Issues        []string `json:"issues,omitempty"` // price_changed, out_of_stock, insufficient_stock, unavailable
+}
+
+type CartItemRequest struct {
+	BookID   int `json:"book_id" binding:"required,gt=0"`
+	Quantity int `json:"quantity" binding:"required,min=1,max=99"`
+}
+
+type CartQuantityRequest struct {
+	Quantity int `json:"quantity" binding:"required,min=1,max=99"`
+}
+
+const (
+	maxCartQuantity = 99
+	cartTokenHeader = "X-Cart-Token"
+)
+
+func newCartToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// resolveCart returns the cart id for the request: the user's cart when
+// authMiddleware set user_id, otherwise the guest cart named by X-Cart-Token.
+// With create=false a missing cart returns 0 so reads don't create rows.
+// New guest carts get a fresh token in the X-Cart-Token response header;
+// tokens are never taken from the client so they can't be guessed.
+func resolveCart(c *gin.Context, create bool) (int, string, error) {
+	var id int
+	if userID := c.GetInt("user_id"); userID != 0 {
+		err := db.QueryRow("SELECT id FROM carts WHERE user_id = $1", userID).Scan(&id)
+		if err == sql.ErrNoRows && create {
+			err = db.QueryRow(`
+				INSERT INTO carts (user_id) VALUES ($1)
+				ON CONFLICT (user_id) DO UPDATE SET updated_at = carts.updated_at
+				RETURNING id
+			`, userID).Scan(&id)
+		}
+		if err == sql.ErrNoRows {
+			return 0, "", nil
+		}
+		return id, "", err
+	}
+
+	token := c.GetHeader(cartTokenHeader)
+	if token != "" {
+		err := db.QueryRow("SELECT id FROM carts WHERE token = $1 AND user_id IS NULL", token).Scan(&id)
+		if err == nil {
+			return id, token, nil
+		} else if err != sql.ErrNoRows {
+			return 0, "", err
+		}
+	}
+	if !create {
+		return 0, "", nil
+	}
+
+	token, err := newCartToken()
+	if err != nil {
+		return 0, "", err
+	}
+	if err := db.QueryRow("INSERT INTO carts (token) VALUES ($1) RETURNING id", token).Scan(&id); err != nil {
+		return 0, "", err
+	}
+	c.Header(cartTokenHeader, token)
+	return id, token, nil
+}
+
+// loadCart re-prices every line from books and inventory. Nothing is
+// written, so the flags stay until the customer changes the line.
+func loadCart(cartID int, token string) (Cart, error) {
+	cart := Cart{Token: token, Items: []CartItem{}}
+	if cartID == 0 {
+		return cart, nil
+	}
+
+	if err := db.QueryRow("SELECT updated_at FROM carts WHERE id = $1", cartID).Scan(&cart.UpdatedAt); err != nil {
+		return cart, err
+	}
+
+	rows, err := db.Query(`
+		SELECT b.id, b.title, b.author, COALESCE(b.cover_image, ''), ci.quantity,
+		       b.price, COALESCE(b.original_price, 0), COALESCE(b.discount, 0), ci.seen_price,
+		       COALESCE(i.quantity, 0), b.deleted_at IS NOT NULL
+		FROM cart_items ci
+		JOIN books b ON b.id = ci.book_id
+		LEFT JOIN inventory i ON i.book_id = b.id
+		WHERE ci.cart_id = $1
+		ORDER BY ci.added_at, b.id
+	`, cartID)
+	if err != nil {
+		return cart, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item CartItem
+		var seenPrice Money
+		var trashed bool
+		if err := rows.Scan(&item.BookID, &item.Title, &item.Author, &item.CoverImage, &item.Quantity,
+			&item.UnitPrice, &item.OriginalPrice, &item.Discount, &seenPrice,
+			&item.Available, &trashed); err != nil {
+			return cart, err
+		}
+
+		switch {
+		case trashed:
+			item.Issues = append(item.Issues, "unavailable")
+		case item.Available == 0:
+			item.Issues = append(item.Issues, "out_of_stock")
+		case item.Quantity > item.Available:
+			item.Issues = append(item.Issues, "insufficient_stock")
+		}
+		if seenPrice != item.UnitPrice {
+			previous := seenPrice
+			item.PreviousPrice = &previous
+			item.Issues = append(item.Issues, "price_changed")
+		}
+
+		item.LineTotal = item.UnitPrice.Mul(item.Quantity)
+		// หนังสือที่ถูกลบแล้วไม่นับรวมในยอด จนกว่าลูกค้าจะเอาออกเอง
+		if !trashed {
+			cart.ItemCount += item.Quantity
+			cart.Subtotal += item.LineTotal
+			if item.OriginalPrice > item.UnitPrice {
+				cart.TotalDiscount += (item.OriginalPrice - item.UnitPrice).Mul(item.Quantity)
+			}
+		}
+		if len(item.Issues) > 0 {
+			cart.HasIssues = true
+		}
+		cart.Items = append(cart.Items, item)
+	}
+
+	return cart, rows.Err()
+}
+
+func respondCart(c *gin.Context, status, cartID int, token string) {
+	cart, err := loadCart(cartID, token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(status, cart)
+}
+
+func touchCart(tx *sql.Tx, cartID int) error {
+	_, err := tx.Exec("UPDATE carts SET updated_at = NOW() WHERE id = $1", cartID)
+	return err
+}
+
+// setCartQuantity เพิ่ม (add=true) หรือกำหนดจำนวนของหนังสือใน cart และอัปเดต seen_price เป็นราคาปัจจุบัน
+// คืน status code และข้อความเมื่อทำไม่ได้
+func setCartQuantity(cartID, bookID, quantity int, add bool) (int, gin.H) {
+	tx, err := db.Begin()
+	if err != nil {
+		return http.StatusInternalServerError, gin.H{"error": err.Error()}
+	}
+	defer tx.Rollback()
+
+	var price Money
+	var available int
+	err = tx.QueryRow(`
+		SELECT b.price, COALESCE(i.quantity, 0)
+		FROM books b LEFT JOIN inventory i ON i.book_id = b.id
+		WHERE b.id = $1 AND b.deleted_at IS NULL
+	`, bookID).Scan(&price, &available)
+	if err == sql.ErrNoRows {
+		return http.StatusNotFound, gin.H{"error": "book not found"}
+	} else if err != nil {
+		return http.StatusInternalServerError, gin.H{"error": err.Error()}
+	}
+
+	var current int
+	err = tx.QueryRow("SELECT quantity FROM cart_items WHERE cart_id = $1 AND book_id = $2 FOR UPDATE", cartID, bookID).Scan(&current)
+	if err != nil && err != sql.ErrNoRows {
+		return http.StatusInternalServerError, gin.H{"error": err.Error()}
+	}
+	if err == sql.ErrNoRows && !add {
+		return http.StatusNotFound, gin.H{"error": "book is not in the cart"}
+	}
+
+	if add {
+		quantity += current
+	}
+	if quantity > maxCartQuantity {
+		return http.StatusUnprocessableEntity, gin.H{"error": "validation failed", "fields": []FieldError{{
+			Field: "quantity", Code: "max", Param: strconv.Itoa(maxCartQuantity),
+			Message: "must be at most " + strconv.Itoa(maxCartQuantity) + " per book",
+		}}}
+	}
+	// เช็คสต็อกตอนเพิ่มเท่านั้น ถ้าสต็อกหมดทีหลังจะถูก flag ตอนอ่าน cart แทน
+	if quantity > current && quantity > available {
+		return http.StatusConflict, gin.H{"error": "insufficient stock", "available": available, "requested": quantity}
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO cart_items (cart_id, book_id, quantity, seen_price) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (cart_id, book_id) DO UPDATE
+		SET quantity = EXCLUDED.quantity, seen_price = EXCLUDED.seen_price, updated_at = NOW()
+	`, cartID, bookID, quantity, price)
+	if err == nil {
+		err = touchCart(tx, cartID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		return http.StatusInternalServerError, gin.H{"error": err.Error()}
+	}
+	return 0, nil
+}
+
+// mergeGuestCart ย้ายของใน guest cart เข้า cart ของ user ตอน login แล้วลบ guest cart ทิ้ง
+// หนังสือที่มีอยู่แล้วทั้งสองฝั่งจะรวมจำนวนกัน (ไม่เกิน maxCartQuantity)
+func mergeGuestCart(userID int, token string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var guestID int
+	err = tx.QueryRow("SELECT id FROM carts WHERE token = $1 AND user_id IS NULL FOR UPDATE", token).Scan(&guestID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	var cartID int
+	err = tx.QueryRow(`
+		INSERT INTO carts (user_id) VALUES ($1)
+		ON CONFLICT (user_id) DO UPDATE SET updated_at = NOW()
+		RETURNING id
+	`, userID).Scan(&cartID)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO cart_items (cart_id, book_id, quantity, seen_price, added_at)
+		SELECT $1, book_id, quantity, seen_price, added_at FROM cart_items WHERE cart_id = $2
+		ON CONFLICT (cart_id, book_id) DO UPDATE
+		SET quantity = LEAST(cart_items.quantity + EXCLUDED.quantity, $3),
+		    seen_price = EXCLUDED.seen_price,
+		    updated_at = NOW()
+	`, cartID, guestID, maxCartQuantity)
+	if err != nil {
+		return 0, err
+	}
+	merged, _ := result.RowsAffected()
+
+	if _, err := tx.Exec("DELETE FROM carts WHERE id = $1", guestID); err != nil {
+		return 0, err
+	}
+	return int(merged), tx.Commit()
+}
+
+// ===================== Cart Handlers =====================
+// ใช้ได้ทั้ง /cart (login แล้ว) และ /guest/cart (ส่ง X-Cart-Token)
+
+// @Summary Get cart
+// @Description Lines are re-priced from the current book price on every read. Items whose price changed, ran out of stock or were removed from the catalog are flagged in issues.
+// @Tags Cart
+// @Produce json
+// @Success 200 {object} Cart
+// @Failure 500 {object} ErrorResponse
+// @Router /cart [get]
+// @security ApiKeyAuth
+func getCart(c *gin.Context) {
+	cartID, token, err := resolveCart(c, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	respondCart(c, http.StatusOK, cartID, token)
+}
+
+// @Summary Add item to cart
+// @Description Adds quantity to the line if the book is already in the cart
+// @Tags Cart
+// @Accept json
+// @Produce json
+// @Param item body CartItemRequest true "Book and quantity"
+// @Success 200 {object} Cart
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} ValidationErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /cart/items [post]
+// @security ApiKeyAuth
+func addCartItem(c *gin.Context) {
+	var req CartItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	cartID, token, err := resolveCart(c, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if status, body := setCartQuantity(cartID, req.BookID, req.Quantity, true); status != 0 {
+		c.JSON(status, body)
+		return
+	}
+	respondCart(c, http.StatusOK, cartID, token)
+}
+
+// @Summary Change item quantity
+// @Tags Cart
+// @Accept json
+// @Produce json
+// @Param book_id path int true "Book ID"
+// @Param quantity body CartQuantityRequest true "New quantity"
+// @Success 200 {object} Cart
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} ValidationErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /cart/items/{book_id} [put]
+// @security ApiKeyAuth
+func updateCartItem(c *gin.Context) {
+	bookID, err := strconv.Atoi(c.Param("book_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "book is not in the cart"})
+		return
+	}
+	var req CartQuantityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	cartID, token, err := resolveCart(c, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if cartID == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "book is not in the cart"})
+		return
+	}
+	if status, body := setCartQuantity(cartID, bookID, req.Quantity, false); status != 0 {
+		c.JSON(status, body)
+		return
+	}
+	respondCart(c, http.StatusOK, cartID, token)
+}
+
+// @Summary Remove item from cart
+// @Tags Cart
+// @Produce json
+// @Param book_id path int true "Book ID"
+// @Success 200 {object} Cart
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /cart/items/{book_id} [delete]
+// @security ApiKeyAuth
+func removeCartItem(c *gin.Context) {
+	bookID, err := strconv.Atoi(c.Param("book_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "book is not in the cart"})
+		return
+	}
+
+	cartID, token, err := resolveCart(c, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM cart_items WHERE cart_id = $1 AND book_id = $2", cartID, bookID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "book is not in the cart"})
+		return
+	}
+	db.Exec("UPDATE carts SET updated_at = NOW() WHERE id = $1", cartID)
+
+	respondCart(c, http.StatusOK, cartID, token)
+}
+
+// @Summary Clear cart
+// @Tags Cart
+// @Produce json
+// @Success 200 {object} Cart
+// @Failure 500 {object} ErrorResponse
+// @Router /cart [delete]
+// @security ApiKeyAuth
+func clearCart(c *gin.Context) {
+	cartID, token, err := resolveCart(c, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if cartID != 0 {
+		if _, err := db.Exec("DELETE FROM cart_items WHERE cart_id = $1", cartID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		db.Exec("UPDATE carts SET updated_at = NOW() WHERE id = $1", cartID)
+	}
+
+	respondCart(c, http.StatusOK, cartID, token)
+}
+
+// ===================== Guest Cart Cleanup =====================
+// guestCartRetention อ่านจาก GUEST_CART_RETENTION_DAYS (ค่าเริ่มต้น 30 วัน)
+func guestCartRetention() time.Duration {
+	days, err := strconv.Atoi(getEnv("GUEST_CART_RETENTION_DAYS", "30"))
+	if err != nil || days < 1 {
+		log.Printf("invalid GUEST_CART_RETENTION_DAYS, using 30 days")
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// startGuestCartCleaner deletes guest carts nobody touched within the
+// retention, once at startup and then every hour.
+func startGuestCartCleaner() {
+	retention := guestCartRetention()
+	go func() {
+		for {
+			result, err := db.Exec("DELETE FROM carts WHERE user_id IS NULL AND updated_at < $1", time.Now().Add(-retention))
+			if err != nil {
+				log.Printf("guest cart cleanup failed: %v", err)
+			} else if n, _ := result.RowsAffected(); n > 0 {
+				log.Printf("deleted %d abandoned guest carts", n)
+			}
+			time.Sleep(time.Hour)
+		}
+	}()
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// ===================== Category Model =====================
+type Category struct {
+	ID        int       `json:"id"`
+	Slug      string    `json:"slug"`
+	NameEN    string    `json:"name_en"`
+	NameTH    string    `json:"name_th,omitempty"`
+	ParentID  *int      `json:"parent_id,omitempty"`
+	SortOrder int       `json:"sort_order"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type CategoryRequest struct {
+	Slug      string `json:"slug" binding:"required"`
+	NameEN    string `json:"name_en" binding:"required"`
+	NameTH    string `json:"name_th"`
+	ParentID  *int   `json:"parent_id"`
+	SortOrder int    `json:"sort_order"`
+}
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// validateCategoryParent ตรวจว่า parent มีอยู่จริง และไม่ทำให้เกิดวงวน (category เป็นลูกของตัวเอง)
+func validateCategoryParent(categoryID int, parentID *int) (int, string) {
+	if parentID == nil {
+		return 0, ""
+	}
+	if *parentID == categoryID {
+		return http.StatusBadRequest, "category cannot be its own parent"
+	}
+
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM categories WHERE id = $1)", *parentID).Scan(&exists); err != nil {
+		return http.StatusInternalServerError, "internal server error"
+	}
+	if !exists {
+		return http.StatusBadRequest, "parent category not found"
+	}
+
+	if categoryID == 0 {
+		return 0, ""
+	}
+
+	// ไล่จาก parent ใหม่ขึ้นไปจนถึง root ถ้าเจอ category ตัวเองแปลว่าเป็นวงวน
+	var cycle bool
+	err := db.QueryRow(`
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id FROM categories WHERE id = $1
+			UNION ALL
+			SELECT c.id, c.parent_id FROM categories c JOIN ancestors a ON c.id = a.parent_id
+		)
+		SELECT EXISTS(SELECT 1 FROM ancestors WHERE id = $2)
+	`, *parentID, categoryID).Scan(&cycle)
+	if err != nil {
+		return http.StatusInternalServerError, "internal server error"
+	}
+	if cycle {
+		return http.StatusBadRequest, "parent category would create a cycle"
+	}
+	return 0, ""
+}
+
+// ===================== Category Handlers =====================
+// @Summary List categories
+// @Description List all categories (admin view)
+// @Tags Categories
+// @Produce json
+// @Success 200 {array} Category
+// @Failure 500 {object} ErrorResponse
+// @Router /categories [get]
+// @security ApiKeyAuth
+func listCategories(c *gin.Context) {
+	rows, err := db.Query(`
+		SELECT id, slug, name_en, COALESCE(name_th, ''), parent_id, COALESCE(sort_order, 0), created_at, updated_at
+		FROM categories
+		ORDER BY sort_order, name_en
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	categories := []Category{}
+	for rows.Next() {
+		var cat Category
+		if err := rows.Scan(&cat.ID, &cat.Slug, &cat.NameEN, &cat.NameTH, &cat.ParentID,
+			&cat.SortOrder, &cat.CreatedAt, &cat.UpdatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		categories = append(categories, cat)
+	}
+
+	c.JSON(http.StatusOK, categories)
+}
+
+// @Summary Create category
+// @Tags Categories
+// @Accept json
+// @Produce json
+// @Param category body CategoryRequest true "Category"
+// @Success 201 {object} Category
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /categories [post]
+// @security ApiKeyAuth
+func createCategory(c *gin.Context) {
+	var req CategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !slugPattern.MatchString(req.Slug) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "slug must be lowercase letters, digits and hyphens"})
+		return
+	}
+	if status, msg := validateCategoryParent(0, req.ParentID); status != 0 {
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+
+	cat := Category{Slug: req.Slug, NameEN: req.NameEN, NameTH: req.NameTH, ParentID: req.ParentID, SortOrder: req.SortOrder}
+	err := db.QueryRow(`
+		INSERT INTO categories (slug, name_en, name_th, parent_id, sort_order)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5)
+		RETURNING id, created_at, updated_at
+	`, req.Slug, req.NameEN, req.NameTH, req.ParentID, req.SortOrder).Scan(&cat.ID, &cat.CreatedAt, &cat.UpdatedAt)
+
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "category slug already exists"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	logAudit(userID, "create", "categories", cat.ID, gin.H{
+		"slug":    cat.Slug,
+		"name_en": cat.NameEN,
+	}, c)
+
+	c.JSON(http.StatusCreated, cat)
+}
+
+// @Summary Update category
+// @Tags Categories
+// @Accept json
+// @Produce json
+// @Param id path int true "Category ID"
+// @Param category body CategoryRequest true "Category"
+// @Success 200 {object} Category
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /categories/{id} [put]
+// @security ApiKeyAuth
+func updateCategory(c *gin.Context) {
+	var id int
+	if err := db.QueryRow("SELECT id FROM categories WHERE id = $1", c.Param("id")).Scan(&id); err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "category not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req CategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !slugPattern.MatchString(req.Slug) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "slug must be lowercase letters, digits and hyphens"})
+		return
+	}
+	if status, msg := validateCategoryParent(id, req.ParentID); status != 0 {
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	// การเปลี่ยน slug จะแก้ books.category ด้วย ให้ book_revisions รู้ว่าใครเป็นผู้แก้
+	if err := setActingUser(tx, c.GetInt("user_id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	cat := Category{ID: id, Slug: req.Slug, NameEN: req.NameEN, NameTH: req.NameTH, ParentID: req.ParentID, SortOrder: req.SortOrder}
+	err = tx.QueryRow(`
+		UPDATE categories
+		SET slug = $1, name_en = $2, name_th = NULLIF($3, ''), parent_id = $4, sort_order = $5, updated_at = NOW()
+		WHERE id = $6
+		RETURNING created_at, updated_at
+	`, req.Slug, req.NameEN, req.NameTH, req.ParentID, req.SortOrder, id).Scan(&cat.CreatedAt, &cat.UpdatedAt)
+
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "category slug already exists"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// books.category เก็บ slug ไว้ด้วย ต้องซิงก์ให้ตรงกันเมื่อเปลี่ยน slug (และเพิ่ม version ให้ ETag เปลี่ยนตาม)
+	if _, err := tx.Exec(`
+		UPDATE books SET category = $1, version = version + 1
+		WHERE category_id = $2 AND category IS DISTINCT FROM $1
+	`, req.Slug, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	logAudit(userID, "update", "categories", id, gin.H{
+		"slug":      cat.Slug,
+		"name_en":   cat.NameEN,
+		"parent_id": cat.ParentID,
+	}, c)
+
+	c.JSON(http.StatusOK, cat)
+}
+
+// @Summary Delete category
+// @Description Delete a category that has no books and no subcategories
+// @Tags Categories
+// @Produce json
+// @Param id path int true "Category ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /categories/{id} [delete]
+// @security ApiKeyAuth
+func deleteCategory(c *gin.Context) {
+	id := c.Param("id")
+
+	var books, children int
+	err := db.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM books WHERE category_id = $1),
+			(SELECT COUNT(*) FROM categories WHERE parent_id = $1)
+	`, id).Scan(&books, &children)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if books > 0 || children > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":         "category is still in use",
+			"books":         books,
+			"subcategories": children,
+		})
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM categories WHERE id = $1", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "category not found"})
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	logAudit(userID, "delete", "categories", id, nil, c)
+
+	c.JSON(http.StatusOK, gin.H{"message": "category deleted successfully"})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===================== ETag / If-Match =====================
+// รูปแบบเดียวกับ week11-assignment (etag.go): "id-version-hash"
+// ETag ที่ได้จาก service ไหนก็ใช้เป็น If-Match กับอีก service ได้ เพราะเทียบแค่ id กับ version
+
+var errBookModified = errors.New("book has been modified by someone else")
+
+// bookETag derives the ETag of a book from its row version plus a hash of
+// the representation, so the tag changes whenever the response would.
+func bookETag(book Book) string {
+	body, _ := json.Marshal(book)
+	sum := fnv.New64a()
+	sum.Write(body)
+	return fmt.Sprintf(`"%d-%d-%x"`, book.ID, book.Version, sum.Sum64())
+}
+
+// matchBookVersion reports whether an If-Match header names version of
+// book id. Weak tags never match.
+func matchBookVersion(header string, id, version int) bool {
+	prefix := fmt.Sprintf(`"%d-%d-`, id, version)
+	plain := fmt.Sprintf(`"%d-%d"`, id, version)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == plain || strings.HasPrefix(tag, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchETag reports whether etag appears in an If-Match / If-None-Match
+// header value. If-Match uses strong comparison, so weak tags (W/"...")
+// only match when weak is true.
+func matchETag(header, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// lockBookVersion locks book id within tx and checks it against the
+// If-Match header, like checkIfMatch in week11: no header means no check.
+// It returns sql.ErrNoRows for a missing book and errBookModified, with
+// the current book, when the version has moved on.
+func lockBookVersion(tx *sql.Tx, id, ifMatch string) (Book, error) {
+	var book Book
+	err := tx.QueryRow("SELECT id, title, author, version FROM books WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", id).
+		Scan(&book.ID, &book.Title, &book.Author, &book.Version)
+	if err != nil {
+		return book, err
+	}
+	if ifMatch != "" && !matchBookVersion(ifMatch, book.ID, book.Version) {
+		return book, errBookModified
+	}
+	return book, nil
+}
+
+// respondBookModified ตอบ 412 พร้อม ETag ปัจจุบันให้ client โหลดใหม่แล้วลองอีกครั้ง
+func respondBookModified(c *gin.Context, current Book) {
+	c.Header("ETag", bookETag(current))
+	c.JSON(http.StatusPreconditionFailed, gin.H{"error": errBookModified.Error()})
+}
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestMatchBookVersion(t *testing.T) {
+	book := Book{ID: 7, Title: "Go", Author: "A", Version: 3}
+
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{bookETag(book), true},
+		{`"7-3-0123456789abcdef"`, true}, // ETag จาก week11 (representation ต่างกัน version เดียวกัน)
+		{`"7-3"`, true},
+		{"*", true},
+		{`"1-1-abc", ` + bookETag(book), true},
+		{`"7-2-abc"`, false},
+		{`"7-30-abc"`, false},
+		{`"17-3-abc"`, false},
+		{"W/" + bookETag(book), false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := matchBookVersion(tt.header, book.ID, book.Version); got != tt.want {
+			t.Errorf("matchBookVersion(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestMatchETag(t *testing.T) {
+	etag := `"7-3-0123456789abcdef"`
+	tests := []struct {
+		header string
+		weak   bool
+		want   bool
+	}{
+		{etag, true, true},
+		{"W/" + etag, true, true},
+		{"W/" + etag, false, false},
+		{`"1-1-abc", ` + etag, true, true},
+		{"*", true, true},
+		{`"7-3-fedcba9876543210"`, true, false}, // rating หรือสต็อกเปลี่ยน ต้องได้ 200 ใหม่
+		{`"7-3"`, true, false},
+	}
+	for _, tt := range tests {
+		if got := matchETag(tt.header, etag, tt.weak); got != tt.want {
+			t.Errorf("matchETag(%q, weak=%v) = %v, want %v", tt.header, tt.weak, got, tt.want)
+		}
+	}
+}
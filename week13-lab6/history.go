@@ -0,0 +1,174 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===================== Book Revision Model =====================
+type BookRevision struct {
+	ID                int64         `json:"id"`
+	Operation         string        `json:"operation"`
+	ChangedBy         *int          `json:"changed_by"`
+	ChangedByUsername string        `json:"changed_by_username,omitempty"`
+	ChangedAt         time.Time     `json:"changed_at"`
+	Changes           []FieldChange `json:"changes"`
+}
+
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// revisionNoiseFields เปลี่ยนทุกครั้งที่แก้ไข หรือเป็นค่าสรุปจากรีวิว (migration7) ไม่ต้องแสดงใน diff
+var revisionNoiseFields = map[string]bool{"updated_at": true, "version": true, "rating": true, "reviews": true}
+
+// setActingUser บอก trigger record_book_revision (week11 migration 010) ว่าใครเป็นผู้แก้ไข
+// มีผลเฉพาะใน transaction นี้ userID 0 (งานเบื้องหลัง ไม่มีผู้ใช้) ส่งเป็นค่าว่าง ให้ trigger บันทึก changed_by เป็น NULL
+func setActingUser(tx *sql.Tx, userID int) error {
+	value := ""
+	if userID != 0 {
+		value = strconv.Itoa(userID)
+	}
+	_, err := tx.Exec("SELECT set_config('app.user_id', $1, true)", value)
+	return err
+}
+
+// withActingUser runs fn in a transaction whose book revisions are
+// attributed to userID. fn's error is returned unchanged (e.g. sql.ErrNoRows).
+func withActingUser(userID int, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setActingUser(tx, userID); err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// diffSnapshots lists the fields that differ between two row snapshots.
+// A nil snapshot (before a create, after a purge) counts as all-null.
+func diffSnapshots(before, after map[string]interface{}) []FieldChange {
+	fields := map[string]bool{}
+	for k := range before {
+		fields[k] = true
+	}
+	for k := range after {
+		fields[k] = true
+	}
+
+	names := make([]string, 0, len(fields))
+	for k := range fields {
+		if !revisionNoiseFields[k] {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+
+	changes := []FieldChange{}
+	for _, name := range names {
+		from, to := before[name], after[name]
+		if !reflect.DeepEqual(from, to) {
+			changes = append(changes, FieldChange{Field: name, From: from, To: to})
+		}
+	}
+	return changes
+}
+
+// ===================== Book History Handlers =====================
+// @Summary Get book history
+// @Description List every revision of a book (oldest first) with field-level changes
+// @Tags Books
+// @Produce json
+// @Param id path int true "Book ID"
+// @Success 200 {array} BookRevision
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /books/{id}/history [get]
+// @security ApiKeyAuth
+func getBookHistory(c *gin.Context) {
+	rows, err := db.Query(`
+		SELECT r.id, r.operation, r.changed_by, COALESCE(u.username, ''), r.changed_at, r.before, r.after
+		FROM book_revisions r
+		LEFT JOIN users u ON u.id = r.changed_by
+		WHERE r.book_id = $1
+		ORDER BY r.changed_at, r.id
+	`, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	revisions := []BookRevision{}
+	for rows.Next() {
+		var rev BookRevision
+		var beforeJSON, afterJSON []byte
+		if err := rows.Scan(&rev.ID, &rev.Operation, &rev.ChangedBy, &rev.ChangedByUsername,
+			&rev.ChangedAt, &beforeJSON, &afterJSON); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var before, after map[string]interface{}
+		if beforeJSON != nil {
+			json.Unmarshal(beforeJSON, &before)
+		}
+		if afterJSON != nil {
+			json.Unmarshal(afterJSON, &after)
+		}
+		rev.Changes = diffSnapshots(before, after)
+		revisions = append(revisions, rev)
+	}
+
+	if len(revisions) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "book not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, revisions)
+}
+
+// getBookAsOf ตอบ GET /books/:id?as_of=... ด้วย snapshot ล่าสุดก่อนเวลานั้น (คอลัมน์ตามตาราง books)
+func getBookAsOf(c *gin.Context, asOf string) {
+	at, err := time.Parse(time.RFC3339, asOf)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "as_of must be an RFC 3339 timestamp, e.g. 2025-01-07T09:00:00+07:00"})
+		return
+	}
+
+	var operation string
+	var snapshot []byte
+	err = db.QueryRow(`
+		SELECT operation, after
+		FROM book_revisions
+		WHERE book_id = $1 AND changed_at <= $2
+		ORDER BY changed_at DESC, id DESC
+		LIMIT 1
+	`, c.Param("id"), at).Scan(&operation, &snapshot)
+
+	// ยังไม่ถูกสร้าง หรืออยู่ในถังขยะ/ถูก purge ไปแล้ว ณ เวลานั้น
+	if err == sql.ErrNoRows || operation == "delete" || operation == "purge" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "book did not exist at that time"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, json.RawMessage(snapshot))
+}
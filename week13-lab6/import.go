@@ -0,0 +1,601 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===================== Import Models =====================
+type ImportReport struct {
+	DryRun         bool              `json:"dry_run"`
+	Created        int               `json:"created"`
+	Updated        int               `json:"updated"`
+	Rejected       int               `json:"rejected"`
+	IgnoredColumns []string          `json:"ignored_columns,omitempty"`
+	Rows           []ImportRowResult `json:"rows"`
+}
+
+type ImportRowResult struct {
+	Line   int          `json:"line"`
+	Status string       `json:"status"` // created, updated, rejected
+	BookID int          `json:"book_id,omitempty"`
+	ISBN   string       `json:"isbn,omitempty"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// importRow คือหนึ่งแถวจากไฟล์ หลัง map ชื่อคอลัมน์แล้ว เก็บเฉพาะคอลัมน์ที่มีในไฟล์
+type importRow struct {
+	line   int
+	fields map[string]string
+}
+
+const (
+	maxImportBytes = 10 << 20 // 10 MB
+	maxImportRows  = 10000
+)
+
+// importColumns maps normalized header names to books columns.
+var importColumns = map[string]string{
+	"title":          "title",
+	"name":           "title",
+	"author":         "author",
+	"authors":        "author",
+	"isbn":           "isbn",
+	"year":           "year",
+	"price":          "price",
+	"category":       "category",
+	"description":    "description",
+	"cover_image":    "cover_image",
+	"coverimage":     "cover_image",
+	"pages":          "pages",
+	"language":       "language",
+	"publisher":      "publisher",
+	"original_price": "original_price",
+	"originalprice":  "original_price",
+	"discount":       "discount",
+}
+
+var importRequiredColumns = []string{"title", "author", "price"}
+
+// importBook holds the typed values of one row so the same binding rules as
+// Book apply. Only the columns present in the file are validated.
+type importBook struct {
+	Title         string `json:"title"`
+	Author        string `json:"author"`
+	ISBN          string `json:"isbn" binding:"omitempty,isbn_any"`
+	Year          int    `json:"year" binding:"omitempty,min=1000,max_next_year"`
+	Price         Money  `json:"price" binding:"gte=0"`
+	CoverImage    string `json:"cover_image" binding:"omitempty,url_or_path"`
+	Pages         int    `json:"pages" binding:"gte=0"`
+	OriginalPrice Money  `json:"original_price" binding:"gte=0"`
+	Discount      int    `json:"discount" binding:"gte=0,lte=100"`
+}
+
+// importRowError is a row rejected by the database step, reported as a FieldError.
+type importRowError struct {
+	FieldError
+}
+
+func (e *importRowError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+var importHeaderSeparators = regexp.MustCompile(`[\s\-]+`)
+
+func normalizeImportHeader(name string) string {
+	return importHeaderSeparators.ReplaceAllString(strings.ToLower(strings.TrimSpace(name)), "_")
+}
+
+// parseImportMapping อ่าน ?map=Book Name:title&map=ผู้แต่ง:author สำหรับไฟล์ที่ใช้ชื่อคอลัมน์ของตัวเอง
+func parseImportMapping(values []string) (map[string]string, error) {
+	mapping := map[string]string{}
+	for _, v := range values {
+		from, to, ok := strings.Cut(v, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid map %q, expected source:column", v)
+		}
+		column, known := importColumns[normalizeImportHeader(to)]
+		if !known {
+			return nil, fmt.Errorf("invalid map %q: unknown column %s", v, to)
+		}
+		mapping[normalizeImportHeader(from)] = column
+	}
+	return mapping, nil
+}
+
+// resolveImportColumn returns the books column for a file header, or "".
+func resolveImportColumn(header string, mapping map[string]string) string {
+	name := normalizeImportHeader(header)
+	if column, ok := mapping[name]; ok {
+		return column
+	}
+	return importColumns[name]
+}
+
+// ===================== Import Parsers =====================
+func parseImportCSV(r io.Reader, mapping map[string]string) ([]importRow, []string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot read CSV header: %v", err)
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff") // BOM จาก Excel
+	}
+
+	columns := make([]string, len(header))
+	var ignored []string
+	for i, h := range header {
+		if columns[i] = resolveImportColumn(h, mapping); columns[i] == "" {
+			ignored = append(ignored, h)
+		}
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid CSV: %v", err)
+		}
+		line, _ := reader.FieldPos(0)
+		row := importRow{line: line, fields: map[string]string{}}
+		for i, value := range record {
+			if i < len(columns) && columns[i] != "" {
+				row.fields[columns[i]] = strings.TrimSpace(value)
+			}
+		}
+		rows = append(rows, row)
+		if len(rows) > maxImportRows {
+			return nil, nil, fmt.Errorf("too many rows (max %d)", maxImportRows)
+		}
+	}
+	return rows, ignored, nil
+}
+
+func parseImportNDJSON(r io.Reader, mapping map[string]string) ([]importRow, []string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxImportBytes)
+
+	var rows []importRow
+	ignoredSet := map[string]bool{}
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		row := importRow{line: line, fields: map[string]string{}}
+		var object map[string]interface{}
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.UseNumber()
+		if err := decoder.Decode(&object); err != nil {
+			// เก็บเป็นแถวว่าง ให้ไปถูก reject พร้อมเลขบรรทัดตอน validate
+			row.fields["_error"] = "invalid JSON: " + err.Error()
+			rows = append(rows, row)
+			continue
+		}
+		for key, value := range object {
+			column := resolveImportColumn(key, mapping)
+			if column == "" {
+				ignoredSet[key] = true
+				continue
+			}
+			if value != nil {
+				row.fields[column] = strings.TrimSpace(fmt.Sprint(value))
+			}
+		}
+		rows = append(rows, row)
+		if len(rows) > maxImportRows {
+			return nil, nil, fmt.Errorf("too many rows (max %d)", maxImportRows)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("invalid NDJSON: %v", err)
+	}
+
+	ignored := make([]string, 0, len(ignoredSet))
+	for key := range ignoredSet {
+		ignored = append(ignored, key)
+	}
+	sort.Strings(ignored)
+	return rows, ignored, nil
+}
+
+// ===================== Import Validation =====================
+// validateImportRow แปลงค่าเป็นชนิดที่ตรงกับคอลัมน์ใน books และคืนรายการข้อผิดพลาดทั้งหมดของแถว
+func validateImportRow(row importRow) (map[string]interface{}, []FieldError) {
+	if msg, ok := row.fields["_error"]; ok {
+		return nil, []FieldError{{Code: "json", Message: msg}}
+	}
+
+	values := map[string]interface{}{}
+	var errs []FieldError
+
+	// แถวที่ไม่มีคอลัมน์ title/author/price ใช้ได้เฉพาะตอนอัปเดตด้วย ISBN (ตรวจใน upsertImportRow)
+	for _, required := range importRequiredColumns {
+		if raw, ok := row.fields[required]; ok && raw == "" {
+			errs = append(errs, FieldError{Field: required, Code: "required", Message: "is required"})
+		}
+	}
+
+	var book importBook
+	var present []string
+	for column, raw := range row.fields {
+		if raw == "" {
+			values[column] = nil
+			continue
+		}
+		switch column {
+		case "year", "pages", "discount":
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				errs = append(errs, FieldError{Field: column, Code: "type", Param: "integer", Message: "must be a whole number"})
+				continue
+			}
+			switch column {
+			case "year":
+				book.Year = n
+			case "pages":
+				book.Pages = n
+			case "discount":
+				book.Discount = n
+			}
+			values[column] = n
+		case "price", "original_price":
+			m, err := parseMoney(raw)
+			if err != nil {
+				errs = append(errs, FieldError{Field: column, Code: "type", Param: "number", Message: "must be a number"})
+				continue
+			}
+			if column == "price" {
+				book.Price = m
+			} else {
+				book.OriginalPrice = m
+			}
+			values[column] = m
+		case "isbn":
+			// เก็บเป็น ISBN-13 เสมอ
+			book.ISBN = raw
+			if isbn, err := normalizeISBN(raw); err == nil {
+				values[column] = isbn
+			}
+		case "cover_image":
+			book.CoverImage = raw
+			values[column] = raw
+		default:
+			values[column] = raw
+		}
+		present = append(present, column)
+	}
+
+	if fields, ok := fieldErrors(validateFields(&book, present)); ok {
+		errs = append(errs, fields...)
+	}
+
+	sort.Slice(errs, func(i, j int) bool {
+		if errs[i].Field != errs[j].Field {
+			return errs[i].Field < errs[j].Field
+		}
+		return errs[i].Code < errs[j].Code
+	})
+	return values, errs
+}
+
+// ===================== Import Writer =====================
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// categorySlug ต้องตรงกับ categorySlug ใน week11-assignment/categories.go
+func categorySlug(name string) string {
+	return strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(strings.TrimSpace(name)), "-"), "-")
+}
+
+// authorSeparator ต้องตรงกับ week11-assignment/authors.go และ migration 007
+var authorSeparator = regexp.MustCompile(`(?i)\s+and\s+|\s*[,&]\s*`)
+
+// linkBookAuthors rebuilds book_authors like the catalog service does on
+// create/update.
+func linkBookAuthors(tx *sql.Tx, bookID int) error {
+	var author string
+	if err := tx.QueryRow("SELECT author FROM books WHERE id = $1", bookID).Scan(&author); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM book_authors WHERE book_id = $1", bookID); err != nil {
+		return err
+	}
+	order := 0
+	for _, name := range authorSeparator.Split(author, -1) {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		order++
+		_, err := tx.Exec(`
+			WITH a AS (
+				INSERT INTO authors (name) VALUES ($1)
+				ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+				RETURNING id
+			)
+			INSERT INTO book_authors (book_id, author_id, author_order)
+			SELECT $2, id, $3 FROM a
+			ON CONFLICT DO NOTHING
+		`, name, bookID, order)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolvePublisher returns the id of the named publisher, adding it if it
+// is new, or nil for an empty name, like week11-assignment/authors.go.
+func resolvePublisher(tx *sql.Tx, publisher string) (interface{}, error) {
+	if publisher = strings.TrimSpace(publisher); publisher == "" {
+		return nil, nil
+	}
+	var id int
+	err := tx.QueryRow(`
+		INSERT INTO publishers (name) VALUES ($1)
+		ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+		RETURNING id
+	`, publisher).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+// upsertImportRow inserts values as a new book, or updates the book with the
+// same ISBN (only the columns present in the file). It returns "created" or "updated".
+func upsertImportRow(tx *sql.Tx, values map[string]interface{}) (string, int, error) {
+	if category, ok := values["category"]; ok {
+		if category == nil {
+			values["category_id"] = nil
+		} else {
+			slug := categorySlug(category.(string))
+			var categoryID int
+			err := tx.QueryRow("SELECT id FROM categories WHERE slug = $1", slug).Scan(&categoryID)
+			if err == sql.ErrNoRows {
+				return "", 0, &importRowError{FieldError{Field: "category", Code: "unknown_category",
+					Param: category.(string), Message: "does not match any category"}}
+			} else if err != nil {
+				return "", 0, err
+			}
+			values["category"] = slug
+			values["category_id"] = categoryID
+		}
+	}
+
+	// publisher_id เขียนในคำสั่งเดียวกับคอลัมน์อื่น ประวัติจะได้มีแถวเดียวต่อการนำเข้าหนึ่งแถว
+	if publisher, ok := values["publisher"]; ok {
+		name, _ := publisher.(string)
+		publisherID, err := resolvePublisher(tx, name)
+		if err != nil {
+			return "", 0, err
+		}
+		values["publisher_id"] = publisherID
+	}
+
+	columns := make([]string, 0, len(values))
+	for column := range values {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	args := make([]interface{}, len(columns))
+	for i, column := range columns {
+		args[i] = values[column]
+	}
+
+	var existingID int
+	var trashed bool
+	if isbn := values["isbn"]; isbn != nil {
+		err := tx.QueryRow("SELECT id, deleted_at IS NOT NULL FROM books WHERE isbn = $1 FOR UPDATE", isbn).Scan(&existingID, &trashed)
+		if err != nil && err != sql.ErrNoRows {
+			return "", 0, err
+		}
+	}
+	if trashed {
+		return "", 0, &importRowError{FieldError{Field: "isbn", Code: "trashed",
+			Message: "belongs to a book in the trash, restore it first"}}
+	}
+
+	if existingID == 0 {
+		for _, required := range importRequiredColumns {
+			if values[required] == nil {
+				return "", 0, &importRowError{FieldError{Field: required, Code: "required",
+					Message: "is required for a new book"}}
+			}
+		}
+	}
+
+	var id int
+	status := "created"
+	if existingID != 0 {
+		status = "updated"
+		sets := make([]string, len(columns))
+		for i, column := range columns {
+			sets[i] = fmt.Sprintf("%s = $%d", column, i+1)
+		}
+		query := fmt.Sprintf("UPDATE books SET %s, updated_at = NOW(), version = version + 1 WHERE id = $%d RETURNING id",
+			strings.Join(sets, ", "), len(columns)+1)
+		if err := tx.QueryRow(query, append(args, existingID)...).Scan(&id); err != nil {
+			return "", 0, err
+		}
+	} else {
+		placeholders := make([]string, len(columns))
+		for i := range columns {
+			placeholders[i] = fmt.Sprintf("$%d", i+1)
+		}
+		query := fmt.Sprintf("INSERT INTO books (%s) VALUES (%s) RETURNING id",
+			strings.Join(columns, ", "), strings.Join(placeholders, ", "))
+		if err := tx.QueryRow(query, args...).Scan(&id); err != nil {
+			return "", 0, err
+		}
+	}
+
+	if _, hasAuthor := values["author"]; status == "created" || hasAuthor {
+		if err := linkBookAuthors(tx, id); err != nil {
+			return "", 0, err
+		}
+	}
+	return status, id, nil
+}
+
+// importChunk writes rows in one transaction. Each row runs inside a
+// savepoint so a database error rejects only that row. A dry run rolls back.
+func importChunk(userID int, rows []importRow, dryRun bool, report *ImportReport) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setActingUser(tx, userID); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		result := ImportRowResult{Line: row.line, ISBN: row.fields["isbn"]}
+
+		values, errs := validateImportRow(row)
+		if len(errs) == 0 {
+			if _, err := tx.Exec("SAVEPOINT import_row"); err != nil {
+				return err
+			}
+			status, id, err := upsertImportRow(tx, values)
+			if err != nil {
+				if _, rbErr := tx.Exec("ROLLBACK TO SAVEPOINT import_row"); rbErr != nil {
+					return rbErr
+				}
+				var rowErr *importRowError
+				if errors.As(err, &rowErr) {
+					errs = append(errs, rowErr.FieldError)
+				} else {
+					errs = append(errs, FieldError{Code: "database", Message: err.Error()})
+				}
+			} else {
+				result.Status, result.BookID = status, id
+			}
+		}
+
+		if len(errs) > 0 {
+			result.Status, result.Errors = "rejected", errs
+			report.Rejected++
+		} else if result.Status == "created" {
+			report.Created++
+		} else {
+			report.Updated++
+		}
+		report.Rows = append(report.Rows, result)
+	}
+
+	if dryRun {
+		return nil
+	}
+	return tx.Commit()
+}
+
+// ===================== Import Handler =====================
+// @Summary Import books
+// @Description Bulk create or update books from CSV (header row required) or NDJSON. Rows are matched by ISBN.
+// @Tags Books
+// @Accept text/csv
+// @Accept application/x-ndjson
+// @Produce json
+// @Param dry_run query bool false "Validate and report without saving"
+// @Param chunk_size query int false "Commit every N rows (default 0 = one transaction)"
+// @Param map query []string false "Column mapping source:column, e.g. Book Name:title" collectionFormat(multi)
+// @Success 200 {object} ImportReport
+// @Failure 400 {object} ErrorResponse
+// @Failure 415 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /books/import [post]
+// @security ApiKeyAuth
+func importBooks(c *gin.Context) {
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dry_run must be true or false"})
+		return
+	}
+	chunkSize, err := strconv.Atoi(c.DefaultQuery("chunk_size", "0"))
+	if err != nil || chunkSize < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "chunk_size must be a non-negative number"})
+		return
+	}
+	mapping, err := parseImportMapping(c.QueryArray("map"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+
+	var rows []importRow
+	var ignored []string
+	switch mediaType {
+	case "text/csv":
+		rows, ignored, err = parseImportCSV(body, mapping)
+	case "application/x-ndjson", "application/jsonl":
+		rows, ignored, err = parseImportNDJSON(body, mapping)
+	default:
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be text/csv or application/x-ndjson"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if chunkSize == 0 {
+		chunkSize = len(rows)
+	}
+
+	report := ImportReport{DryRun: dryRun, IgnoredColumns: ignored, Rows: []ImportRowResult{}}
+	userID := c.GetInt("user_id")
+	for start := 0; start < len(rows); start += chunkSize {
+		end := start + chunkSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		committed := report
+		if err := importChunk(userID, rows[start:end], dryRun, &report); err != nil {
+			// chunk นี้ rollback ไปแล้ว แต่ chunk ก่อนหน้า commit ไปแล้ว แจ้งให้รู้ว่าหยุดที่บรรทัดไหน
+			report = committed
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":          err.Error(),
+				"failed_at_line": rows[start].line,
+				"report":         report,
+			})
+			return
+		}
+	}
+
+	if !dryRun {
+		logAudit(userID, "import", "books", nil, gin.H{
+			"created":  report.Created,
+			"updated":  report.Updated,
+			"rejected": report.Rejected,
+		}, c)
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===================== Inventory Models =====================
+type StockLevel struct {
+	BookID            int        `json:"book_id"`
+	Title             string     `json:"title"`
+	Quantity          int        `json:"quantity"`
+	LowStockThreshold int        `json:"low_stock_threshold"`          // ค่าที่ใช้จริง (ของเล่มนี้ หรือค่าของระบบ)
+	ThresholdOverride *int       `json:"threshold_override,omitempty"` // NULL = ใช้ LOW_STOCK_THRESHOLD
+	LowStock          bool       `json:"low_stock"`
+	UpdatedAt         *time.Time `json:"updated_at,omitempty"`
+}
+
+type StockMovement struct {
+	ID           int       `json:"id"`
+	BookID       int       `json:"book_id"`
+	Type         string    `json:"type"`     // receive, sell, adjust, return
+	Quantity     int       `json:"quantity"` // บวก = เข้า, ลบ = ออก
+	BalanceAfter int       `json:"balance_after"`
+	Reason       string    `json:"reason,omitempty"`
+	Reference    string    `json:"reference,omitempty"`
+	UserID       *int      `json:"user_id,omitempty"`
+	Username     string    `json:"username,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type StockMovementRequest struct {
+	Type      string `json:"type" binding:"required,oneof=receive sell adjust return"`
+	Quantity  int    `json:"quantity" binding:"required,ne=0"` // adjust ใส่ค่าติดลบได้ ประเภทอื่นใส่จำนวนชิ้น (บวก)
+	Reason    string `json:"reason" binding:"max=500"`
+	Reference string `json:"reference" binding:"max=100"`
+}
+
+type StockSettingsRequest struct {
+	LowStockThreshold *int `json:"low_stock_threshold" binding:"omitempty,gte=0"` // null = ใช้ค่าของระบบ
+}
+
+type StockMovementPage struct {
+	Items      []StockMovement `json:"items"`
+	NextBefore int             `json:"next_before,omitempty"` // ส่งเป็น ?before= เพื่อดูหน้าถัดไป
+}
+
+// insufficientStockError is returned by recordStockMovement when a movement
+// would take the quantity below zero.
+type insufficientStockError struct {
+	BookID    int
+	Available int
+	Requested int
+}
+
+func (e *insufficientStockError) Error() string {
+	return fmt.Sprintf("insufficient stock for book %d: %d available, %d requested", e.BookID, e.Available, e.Requested)
+}
+
+// lowStockThreshold อ่านจาก LOW_STOCK_THRESHOLD (ค่าเริ่มต้น 5 เล่ม)
+func lowStockThreshold() int {
+	n, err := strconv.Atoi(getEnv("LOW_STOCK_THRESHOLD", "5"))
+	if err != nil || n < 0 {
+		log.Printf("invalid LOW_STOCK_THRESHOLD, using 5")
+		n = 5
+	}
+	return n
+}
+
+// ===================== Stock Ledger =====================
+// movementDelta แปลงจำนวนใน request เป็นค่าที่บวก/ลบกับสต็อก
+func movementDelta(movementType string, quantity int) int {
+	if movementType == "sell" {
+		return -quantity
+	}
+	return quantity
+}
+
+// recordStockMovement applies delta to the book's stock and appends it to
+// the ledger inside tx. The inventory row is locked by the UPDATE, so
+// concurrent movements of the same book are applied one at a time. It
+// returns sql.ErrNoRows for a missing book and *insufficientStockError when
+// the stock would go negative.
+func recordStockMovement(tx *sql.Tx, userID, bookID int, movementType string, delta int, reason, reference string) (StockMovement, error) {
+	m := StockMovement{BookID: bookID, Type: movementType, Quantity: delta, Reason: reason, Reference: reference}
+
+	var id int
+	if err := tx.QueryRow("SELECT id FROM books WHERE id = $1 AND deleted_at IS NULL", bookID).Scan(&id); err != nil {
+		return m, err
+	}
+	if _, err := tx.Exec("INSERT INTO inventory (book_id) VALUES ($1) ON CONFLICT (book_id) DO NOTHING", bookID); err != nil {
+		return m, err
+	}
+
+	err := tx.QueryRow(`
+		UPDATE inventory SET quantity = quantity + $2, updated_at = NOW()
+		WHERE book_id = $1 AND quantity + $2 >= 0
+		RETURNING quantity
+	`, bookID, delta).Scan(&m.BalanceAfter)
+	if err == sql.ErrNoRows {
+		stockErr := &insufficientStockError{BookID: bookID, Requested: -delta}
+		if err := tx.QueryRow("SELECT quantity FROM inventory WHERE book_id = $1", bookID).Scan(&stockErr.Available); err != nil {
+			return m, err
+		}
+		return m, stockErr
+	} else if err != nil {
+		return m, err
+	}
+
+	var user interface{}
+	if userID != 0 {
+		user = userID
+		m.UserID = &userID
+	}
+	err = tx.QueryRow(`
+		INSERT INTO stock_movements (book_id, movement_type, quantity, balance_after, reason, reference, user_id)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7)
+		RETURNING id, created_at
+	`, bookID, movementType, delta, m.BalanceAfter, reason, reference, user).Scan(&m.ID, &m.CreatedAt)
+	return m, err
+}
+
+// logStockMovement บันทึก audit ของการเคลื่อนไหวสต็อก ทุกที่ที่เรียก recordStockMovement ต้องเรียกหลัง commit
+func logStockMovement(userID int, m StockMovement, c *gin.Context) {
+	logAudit(userID, "stock_"+m.Type, "books", m.BookID, gin.H{
+		"movement_id":   m.ID,
+		"quantity":      m.Quantity,
+		"balance_after": m.BalanceAfter,
+		"reason":        m.Reason,
+		"reference":     m.Reference,
+	}, c)
+}
+
+func getStockLevel(bookID int) (StockLevel, error) {
+	s := StockLevel{BookID: bookID}
+	err := db.QueryRow(`
+		SELECT b.id, b.title, COALESCE(i.quantity, 0), i.low_stock_threshold, i.updated_at
+		FROM books b
+		LEFT JOIN inventory i ON i.book_id = b.id
+		WHERE b.id = $1 AND b.deleted_at IS NULL
+	`, bookID).Scan(&s.BookID, &s.Title, &s.Quantity, &s.ThresholdOverride, &s.UpdatedAt)
+	if err != nil {
+		return s, err
+	}
+	s.LowStockThreshold = lowStockThreshold()
+	if s.ThresholdOverride != nil {
+		s.LowStockThreshold = *s.ThresholdOverride
+	}
+	s.LowStock = s.Quantity <= s.LowStockThreshold
+	return s, nil
+}
+
+// ===================== Inventory Handlers =====================
+// @Summary Get stock level
+// @Tags Inventory
+// @Produce json
+// @Param id path int true "Book ID"
+// @Success 200 {object} StockLevel
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /books/{id}/stock [get]
+// @security ApiKeyAuth
+func getStock(c *gin.Context) {
+	bookID, ok := parseBookID(c)
+	if !ok {
+		return
+	}
+
+	level, err := getStockLevel(bookID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "book not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, level)
+}
+
+// @Summary Update stock settings
+// @Description Set the book's low-stock threshold, or null to use LOW_STOCK_THRESHOLD
+// @Tags Inventory
+// @Accept json
+// @Produce json
+// @Param id path int true "Book ID"
+// @Param settings body StockSettingsRequest true "Settings"
+// @Success 200 {object} StockLevel
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ValidationErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /books/{id}/stock [put]
+// @security ApiKeyAuth
+func updateStockSettings(c *gin.Context) {
+	bookID, ok := parseBookID(c)
+	if !ok {
+		return
+	}
+	var req StockSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO inventory (book_id, low_stock_threshold)
+		SELECT id, $2 FROM books WHERE id = $1 AND deleted_at IS NULL
+		ON CONFLICT (book_id) DO UPDATE SET low_stock_threshold = EXCLUDED.low_stock_threshold, updated_at = NOW()
+	`, bookID, req.LowStockThreshold)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "book not found"})
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	logAudit(userID, "update", "inventory", bookID, gin.H{
+		"low_stock_threshold": req.LowStockThreshold,
+	}, c)
+
+	level, err := getStockLevel(bookID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, level)
+}
+
+// @Summary Record a stock movement
+// @Description receive/return add stock, sell removes it, adjust takes a signed quantity and needs a reason (e.g. stock count, damage)
+// @Tags Inventory
+// @Accept json
+// @Produce json
+// @Param id path int true "Book ID"
+// @Param movement body StockMovementRequest true "Movement"
+// @Success 201 {object} StockMovement
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} ValidationErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /books/{id}/stock/movements [post]
+// @security ApiKeyAuth
+func createStockMovement(c *gin.Context) {
+	bookID, ok := parseBookID(c)
+	if !ok {
+		return
+	}
+	var req StockMovementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	var fields []FieldError
+	if req.Type != "adjust" && req.Quantity < 0 {
+		fields = append(fields, FieldError{Field: "quantity", Code: "gt", Param: "0",
+			Message: "must be positive for " + req.Type + ", use adjust for corrections"})
+	}
+	if req.Type == "adjust" && req.Reason == "" {
+		fields = append(fields, FieldError{Field: "reason", Code: "required", Message: "is required for adjust"})
+	}
+	if len(fields) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, ValidationErrorResponse{Error: "validation failed", Fields: fields})
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	var movement StockMovement
+	err := withActingUser(userID, func(tx *sql.Tx) error {
+		var err error
+		movement, err = recordStockMovement(tx, userID, bookID, req.Type,
+			movementDelta(req.Type, req.Quantity), req.Reason, req.Reference)
+		return err
+	})
+
+	var stockErr *insufficientStockError
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "book not found"})
+		return
+	} else if errors.As(err, &stockErr) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":     "insufficient stock",
+			"available": stockErr.Available,
+			"requested": stockErr.Requested,
+		})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	movement.Username = c.GetString("username")
+	logStockMovement(userID, movement, c)
+
+	c.JSON(http.StatusCreated, movement)
+}
+
+// @Summary List stock movements
+// @Description Ledger of a book's stock changes, newest first
+// @Tags Inventory
+// @Produce json
+// @Param id path int true "Book ID"
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param before query int false "next_before from the previous page"
+// @Success 200 {object} StockMovementPage
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /books/{id}/stock/movements [get]
+// @security ApiKeyAuth
+func listStockMovements(c *gin.Context) {
+	bookID, ok := parseBookID(c)
+	if !ok {
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 200"})
+		return
+	}
+	before, err := strconv.Atoi(c.DefaultQuery("before", "0"))
+	if err != nil || before < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "before must be a movement id"})
+		return
+	}
+
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM books WHERE id = $1)", bookID).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "book not found"})
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT m.id, m.book_id, m.movement_type, m.quantity, m.balance_after,
+		       COALESCE(m.reason, ''), COALESCE(m.reference, ''), m.user_id, COALESCE(u.username, ''), m.created_at
+		FROM stock_movements m
+		LEFT JOIN users u ON u.id = m.user_id
+		WHERE m.book_id = $1 AND ($2 = 0 OR m.id < $2)
+		ORDER BY m.id DESC
+		LIMIT $3
+	`, bookID, before, limit+1)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	page := StockMovementPage{Items: []StockMovement{}}
+	for rows.Next() {
+		var m StockMovement
+		if err := rows.Scan(&m.ID, &m.BookID, &m.Type, &m.Quantity, &m.BalanceAfter,
+			&m.Reason, &m.Reference, &m.UserID, &m.Username, &m.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		page.Items = append(page.Items, m)
+	}
+
+	if len(page.Items) > limit {
+		page.Items = page.Items[:limit]
+		page.NextBefore = page.Items[limit-1].ID
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// @Summary List low-stock books
+// @Description Books whose stock is at or below their threshold (per-book override or LOW_STOCK_THRESHOLD), lowest first
+// @Tags Inventory
+// @Produce json
+// @Param threshold query int false "Use this threshold for every book instead"
+// @Success 200 {array} StockLevel
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /inventory/low-stock [get]
+// @security ApiKeyAuth
+func listLowStock(c *gin.Context) {
+	defaultThreshold := lowStockThreshold()
+	var forced interface{}
+	if v := c.Query("threshold"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "threshold must be a non-negative number"})
+			return
+		}
+		forced = n
+	}
+
+	// หนังสือที่ไม่มีแถวใน inventory มีสต็อก 0 จึงถูกนับเป็น low stock ด้วย
+	rows, err := db.Query(`
+		SELECT b.id, b.title, COALESCE(i.quantity, 0), i.low_stock_threshold,
+		       COALESCE($1::int, i.low_stock_threshold, $2::int), i.updated_at
+		FROM books b
+		LEFT JOIN inventory i ON i.book_id = b.id
+		WHERE b.deleted_at IS NULL
+		  AND COALESCE(i.quantity, 0) <= COALESCE($1::int, i.low_stock_threshold, $2::int)
+		ORDER BY COALESCE(i.quantity, 0), b.title
+	`, forced, defaultThreshold)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	levels := []StockLevel{}
+	for rows.Next() {
+		var s StockLevel
+		if err := rows.Scan(&s.BookID, &s.Title, &s.Quantity, &s.ThresholdOverride,
+			&s.LowStockThreshold, &s.UpdatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		s.LowStock = true
+		levels = append(levels, s)
+	}
+
+	c.JSON(http.StatusOK, levels)
+}
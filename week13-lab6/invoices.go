@@ -0,0 +1,400 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===================== Invoice Models =====================
+// InvoiceParty คือผู้ขายหรือผู้ซื้อในใบกำกับภาษี ใช้รับข้อมูลผู้ซื้อตอนสั่งซื้อด้วย
+type InvoiceParty struct {
+	Name    string `json:"name" binding:"required,max=200"`
+	TaxID   string `json:"tax_id" binding:"required,thai_tax_id"`
+	Branch  string `json:"branch" binding:"omitempty,len=5,numeric"` // 00000 = สำนักงานใหญ่ (ค่าเริ่มต้น)
+	Address string `json:"address" binding:"required,max=500"`
+}
+
+// Invoice คือใบกำกับภาษีที่ออกแล้ว เก็บทั้งฉบับไว้ใน invoices.document
+// แก้ข้อมูลร้านหรือสินค้าทีหลังก็ไม่เปลี่ยนเอกสารเดิม
+type Invoice struct {
+	Number           string        `json:"invoice_number"` // เช่น INV-2026-000001 เรียงต่อกันไม่ข้ามเลขภายในปี
+	Type             string        `json:"type"`           // full = เต็มรูป (มีเลขผู้เสียภาษีผู้ซื้อ), abbreviated = อย่างย่อ
+	OrderID          int           `json:"order_id"`
+	IssuedAt         time.Time     `json:"issued_at"`
+	Seller           InvoiceParty  `json:"seller"`
+	Buyer            *InvoiceParty `json:"buyer,omitempty"`
+	Lines            []InvoiceLine `json:"lines"`
+	Subtotal         Money         `json:"subtotal"`
+	Discount         Money         `json:"discount"`
+	NetAmount        Money         `json:"net_amount"` // มูลค่าก่อน VAT (ฐานภาษี)
+	VATRate          float64       `json:"vat_rate"`
+	VAT              Money         `json:"vat"`
+	Total            Money         `json:"total"` // ยอดรวม VAT ที่ลูกค้าจ่าย
+	PricesIncludeVAT bool          `json:"prices_include_vat"`
+	Currency         string        `json:"currency"`
+}
+
+type InvoiceLine struct {
+	No          int    `json:"no"`
+	Description string `json:"description"`
+	ISBN        string `json:"isbn,omitempty"`
+	Quantity    int    `json:"quantity"`
+	UnitPrice   Money  `json:"unit_price"`
+	Discount    Money  `json:"discount"`
+	Amount      Money  `json:"amount"` // หลังหักส่วนลด
+}
+
+const headOfficeBranch = "00000"
+
+// เวลาประเทศไทย ใช้ทั้งวันที่บนเอกสารและปีของเลขที่ใบกำกับภาษี
+var invoiceZone = time.FixedZone("ICT", 7*60*60)
+
+// validThaiTaxID ตรวจเลขประจำตัวผู้เสียภาษี 13 หลัก หลักสุดท้ายเป็น check digit แบบ mod 11
+func validThaiTaxID(id string) bool {
+	if len(id) != 13 || !isDigits(id) {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 12; i++ {
+		sum += int(id[i]-'0') * (13 - i)
+	}
+	return int(id[12]-'0') == (11-sum%11)%10
+}
+
+// invoiceSeller อ่านข้อมูลร้านจาก SELLER_NAME, SELLER_TAX_ID, SELLER_BRANCH และ SELLER_ADDRESS
+func invoiceSeller() InvoiceParty {
+	return InvoiceParty{
+		Name:    getEnv("SELLER_NAME", "Bookstore"),
+		TaxID:   getEnv("SELLER_TAX_ID", ""),
+		Branch:  getEnv("SELLER_BRANCH", headOfficeBranch),
+		Address: getEnv("SELLER_ADDRESS", ""),
+	}
+}
+
+// buildInvoice makes the invoice document for o without a number. The
+// amounts come from the order as it was priced, VAT rate included, so an
+// invoice issued after VAT_RATE changes still matches what was paid.
+func buildInvoice(o Order, items []OrderItem, seller InvoiceParty, issuedAt time.Time) Invoice {
+	inv := Invoice{
+		Type:             "abbreviated",
+		OrderID:          o.ID,
+		IssuedAt:         issuedAt,
+		Seller:           seller,
+		Buyer:            o.Buyer,
+		Lines:            make([]InvoiceLine, 0, len(items)),
+		Subtotal:         o.Subtotal,
+		Discount:         o.Discount,
+		NetAmount:        o.Total - o.VAT,
+		VATRate:          o.VATRate,
+		VAT:              o.VAT,
+		Total:            o.Total,
+		PricesIncludeVAT: o.PricesIncludeVAT,
+		Currency:         paymentCurrency(),
+	}
+	if o.Buyer != nil {
+		inv.Type = "full"
+	}
+	for i, item := range items {
+		inv.Lines = append(inv.Lines, InvoiceLine{
+			No:          i + 1,
+			Description: item.Title,
+			ISBN:        item.ISBN,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice,
+			Discount:    item.Discount,
+			Amount:      item.LineTotal - item.Discount,
+		})
+	}
+	return inv
+}
+
+// issueInvoice ออกใบกำกับภาษีของ order ใน tx ถ้ายังไม่เคยออก
+// เลขที่มาจาก invoice_sequences ซึ่งถูกล็อกจนจบ tx ถ้า tx rollback เลขนั้นก็ไม่ถูกใช้ เลขจึงไม่ข้าม
+func issueInvoice(tx *sql.Tx, orderID int) error {
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM invoices WHERE order_id = $1)", orderID).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	o, err := scanOrder(tx.QueryRow(orderSelect+" WHERE o.id = $1", orderID))
+	if err != nil {
+		return err
+	}
+	items, err := loadOrderItems(tx, orderID)
+	if err != nil {
+		return err
+	}
+	inv := buildInvoice(o, items, invoiceSeller(), time.Now())
+
+	year := inv.IssuedAt.In(invoiceZone).Year()
+	var seq int
+	err = tx.QueryRow(`
+		INSERT INTO invoice_sequences (year, last_number) VALUES ($1, 1)
+		ON CONFLICT (year) DO UPDATE SET last_number = invoice_sequences.last_number + 1
+		RETURNING last_number
+	`, year).Scan(&seq)
+	if err != nil {
+		return err
+	}
+	inv.Number = fmt.Sprintf("%s-%d-%06d", getEnv("INVOICE_PREFIX", "INV"), year, seq)
+
+	document, err := json.Marshal(inv)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO invoices (order_id, invoice_number, issued_at, total, vat_amount, document)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, orderID, inv.Number, inv.IssuedAt, inv.Total, inv.VAT, document)
+	return err
+}
+
+// loadInvoice อ่านใบกำกับภาษีของ order ownerID = 0 คือ order ของใครก็ได้
+func loadInvoice(orderID, ownerID int) (Invoice, error) {
+	var inv Invoice
+	var document []byte
+	err := db.QueryRow(`
+		SELECT i.document
+		FROM invoices i
+		JOIN orders o ON o.id = i.order_id
+		WHERE i.order_id = $1 AND ($2 = 0 OR o.user_id = $2)
+	`, orderID, ownerID).Scan(&document)
+	if err != nil {
+		return inv, err
+	}
+	err = json.Unmarshal(document, &inv)
+	return inv, err
+}
+
+// ===================== Invoice PDF =====================
+// renderInvoicePDF วาดใบกำกับภาษีลง A4 ถ้าฟอนต์มีภาษาไทยหัวข้อจะเป็นภาษาไทย ไม่งั้นเป็นภาษาอังกฤษ
+// รายการเยอะจะขึ้นหน้าใหม่พร้อมหัวตาราง ทุกหน้ามีเลขที่ใบกำกับภาษีและเลขหน้าที่ท้ายหน้า
+func renderInvoicePDF(inv Invoice) []byte {
+	doc := newPDFDocument(documentFont())
+	thai := doc.font.hasGlyphs("ใบกำกับภาษีอย่างย่อ")
+	label := func(th, en string) string {
+		if thai {
+			return th
+		}
+		return en
+	}
+	branch := func(b string) string {
+		if b == "" || b == headOfficeBranch {
+			return label("สำนักงานใหญ่", "Head office")
+		}
+		return label("สาขาที่ ", "Branch ") + b
+	}
+
+	const (
+		left   = 42.0
+		right  = pdfPageWidth - 42
+		top    = pdfPageHeight - 42
+		bottom = 60.0
+		line   = 13.0
+	)
+
+	title := "TAX INVOICE"
+	if inv.Type == "abbreviated" {
+		title = "ABBREVIATED TAX INVOICE"
+	}
+	if thai {
+		if inv.Type == "abbreviated" {
+			title = "ใบกำกับภาษีอย่างย่อ / " + title
+		} else {
+			title = "ใบกำกับภาษี / " + title
+		}
+	}
+
+	y := top
+	doc.text(left, y-4, 16, title)
+	doc.textRight(right, y, 9, label("เลขที่ ", "No. ")+inv.Number)
+	doc.textRight(right, y-line, 9, label("วันที่ ", "Date ")+inv.IssuedAt.In(invoiceZone).Format("02/01/2006"))
+	doc.textRight(right, y-2*line, 9, label("คำสั่งซื้อ ", "Order ")+"#"+strconv.Itoa(inv.OrderID))
+	y -= 3*line + 14
+
+	// ผู้ขายอยู่ซ้าย ผู้ซื้ออยู่ขวา
+	party := func(x, y, width float64, heading string, p InvoiceParty) float64 {
+		doc.text(x, y, 9, heading)
+		y -= line
+		for _, s := range doc.wrap(p.Name, 10, width) {
+			doc.text(x, y, 10, s)
+			y -= line
+		}
+		for _, s := range doc.wrap(p.Address, 9, width) {
+			doc.text(x, y, 9, s)
+			y -= line
+		}
+		if p.TaxID != "" {
+			doc.text(x, y, 9, label("เลขประจำตัวผู้เสียภาษี ", "Tax ID ")+p.TaxID+"  "+branch(p.Branch))
+			y -= line
+		}
+		return y
+	}
+	sellerEnd := party(left, y, 250, label("ผู้ขาย", "Seller"), inv.Seller)
+	if inv.Buyer != nil {
+		if buyerEnd := party(310, y, right-310, label("ผู้ซื้อ", "Buyer"), *inv.Buyer); buyerEnd < sellerEnd {
+			sellerEnd = buyerEnd
+		}
+	}
+	y = sellerEnd - 10
+
+	// คอลัมน์ตาราง: ลำดับ, รายการ, จำนวน, ราคาต่อหน่วย, ส่วนลด, จำนวนเงิน (ตัวเลขชิดขวา)
+	const (
+		colDesc     = left + 30
+		colQty      = 370.0
+		colUnit     = 440.0
+		colDiscount = 495.0
+	)
+	tableHeader := func() {
+		doc.line(left, y+line-2, right, y+line-2, 0.8)
+		doc.text(left, y, 9, label("ลำดับ", "No."))
+		doc.text(colDesc, y, 9, label("รายการ", "Description"))
+		doc.textRight(colQty, y, 9, label("จำนวน", "Qty"))
+		doc.textRight(colUnit, y, 9, label("ราคาต่อหน่วย", "Unit price"))
+		doc.textRight(colDiscount, y, 9, label("ส่วนลด", "Discount"))
+		doc.textRight(right, y, 9, label("จำนวนเงิน", "Amount"))
+		doc.line(left, y-5, right, y-5, 0.8)
+		y -= line + 6
+	}
+	continuePage := func() {
+		doc.newPage()
+		y = top
+		doc.text(left, y, 10, title+" "+inv.Number)
+		y -= 2 * line
+	}
+
+	tableHeader()
+	for _, l := range inv.Lines {
+		if y < bottom+line {
+			continuePage()
+			tableHeader()
+		}
+		doc.text(left, y, 9, strconv.Itoa(l.No))
+		doc.text(colDesc, y, 9, doc.fit(l.Description, 9, colQty-colDesc-40))
+		doc.textRight(colQty, y, 9, strconv.Itoa(l.Quantity))
+		doc.textRight(colUnit, y, 9, l.UnitPrice.Format())
+		if l.Discount != 0 {
+			doc.textRight(colDiscount, y, 9, l.Discount.Format())
+		}
+		doc.textRight(right, y, 9, l.Amount.Format())
+		y -= line
+	}
+	doc.line(left, y+line-5, right, y+line-5, 0.8)
+
+	// ยอดรวมต้องอยู่หน้าเดียวกันทั้งก้อน
+	totals := [][2]string{{label("รวมเป็นเงิน", "Subtotal"), inv.Subtotal.Format()}}
+	if inv.Discount != 0 {
+		totals = append(totals, [2]string{label("ส่วนลด", "Discount"), "-" + inv.Discount.Format()})
+	}
+	totals = append(totals,
+		[2]string{label("มูลค่าสินค้าก่อนภาษี", "Value before VAT"), inv.NetAmount.Format()},
+		[2]string{label("ภาษีมูลค่าเพิ่ม ", "VAT ") + strconv.FormatFloat(inv.VATRate, 'f', -1, 64) + "%", inv.VAT.Format()},
+	)
+	if y-float64(len(totals)+3)*line < bottom {
+		continuePage()
+	}
+	y -= 6
+	for _, t := range totals {
+		doc.textRight(colDiscount, y, 9, t[0])
+		doc.textRight(right, y, 9, t[1])
+		y -= line
+	}
+	y -= 4
+	doc.textRight(colDiscount, y, 11, label("จำนวนเงินรวมทั้งสิ้น", "Total")+" ("+inv.Currency+")")
+	doc.textRight(right, y, 11, inv.Total.Format())
+	if inv.PricesIncludeVAT {
+		doc.text(left, y, 8, label("ราคาสินค้ารวมภาษีมูลค่าเพิ่มแล้ว", "Prices include VAT"))
+	}
+
+	for i := range doc.pages {
+		doc.setPage(i)
+		doc.text(left, 30, 8, inv.Number)
+		doc.textRight(right, 30, 8, fmt.Sprintf("%d/%d", i+1, len(doc.pages)))
+	}
+	return doc.bytes()
+}
+
+// ===================== Invoice Handlers =====================
+func respondInvoice(c *gin.Context, ownerID int, asPDF bool) {
+	orderID, ok := parseOrderID(c)
+	if !ok {
+		return
+	}
+	inv, err := loadInvoice(orderID, ownerID)
+	if err == sql.ErrNoRows {
+		// order ที่ยังไม่จ่ายเงินยังไม่มีใบกำกับภาษี
+		c.JSON(http.StatusNotFound, gin.H{"error": "invoice not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !asPDF {
+		c.JSON(http.StatusOK, inv)
+		return
+	}
+	c.Header("Content-Disposition", `inline; filename="`+inv.Number+`.pdf"`)
+	c.Data(http.StatusOK, "application/pdf", renderInvoicePDF(inv))
+}
+
+// @Summary Get my order's tax invoice
+// @Description Issued when the order is paid. Full tax invoice when the order was placed with buyer details, abbreviated otherwise.
+// @Tags Invoices
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {object} Invoice
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /orders/{id}/invoice [get]
+// @security ApiKeyAuth
+func getMyInvoice(c *gin.Context) {
+	respondInvoice(c, c.GetInt("user_id"), false)
+}
+
+// @Summary Download my order's tax invoice as PDF
+// @Tags Invoices
+// @Produce application/pdf
+// @Param id path int true "Order ID"
+// @Success 200 {file} file
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /orders/{id}/invoice/pdf [get]
+// @security ApiKeyAuth
+func getMyInvoicePDF(c *gin.Context) {
+	respondInvoice(c, c.GetInt("user_id"), true)
+}
+
+// @Summary Get any order's tax invoice
+// @Tags Invoices
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {object} Invoice
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /staff/orders/{id}/invoice [get]
+// @security ApiKeyAuth
+func getAnyInvoice(c *gin.Context) {
+	respondInvoice(c, 0, false)
+}
+
+// @Summary Download any order's tax invoice as PDF
+// @Tags Invoices
+// @Produce application/pdf
+// @Param id path int true "Order ID"
+// @Success 200 {file} file
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /staff/orders/{id}/invoice/pdf [get]
+// @security ApiKeyAuth
+func getAnyInvoicePDF(c *gin.Context) {
+	respondInvoice(c, 0, true)
+}
@@ -28,11 +28,12 @@ type ErrorResponse struct {
 // ===================== Book Model =====================
 type Book struct {
 	ID        int       `json:"id"`
-	Title     string    `json:"title"`
-	Author    string    `json:"author"`
-	ISBN      string    `json:"isbn"`
-	Year      int       `json:"year"`
-	Price     float64   `json:"price"`
+	Title     string    `json:"title" binding:"required"`
+	Author    string    `json:"author" binding:"required"`
+	ISBN      string    `json:"isbn" binding:"omitempty,isbn_any"`
+	Year      int       `json:"year" binding:"omitempty,min=1000,max_next_year"`
+	Price     Money     `json:"price" binding:"gte=0"`
+	Version   int       `json:"version,omitempty"` // ใช้ทำ ETag ส่งกลับมาใน If-Match ตอนแก้ไข
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -48,8 +49,9 @@ type User struct {
 }
 
 type LoginRequest struct {
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Username  string `json:"username" binding:"required"`
+	Password  string `json:"password" binding:"required"`
+	CartToken string `json:"cart_token"` // guest cart ที่จะรวมเข้า cart ของ user (หรือส่งใน X-Cart-Token)
 }
 
 type LoginResponse struct {
@@ -239,9 +241,19 @@ func isRefreshTokenValid(token string) (int, bool) {
 	return userID, true
 }
 
+// logAudit บันทึก audit log ถ้า c เป็น nil หรือ userID เป็น 0 ถือว่าเป็นงานของระบบ (เช่น purge job)
 func logAudit(userID int, action, resource string, resourceID interface{}, details map[string]interface{}, c *gin.Context) {
 	detailsJSON, _ := json.Marshal(details)
 
+	var user, ip, userAgent interface{}
+	if userID != 0 {
+		user = userID
+	}
+	if c != nil {
+		ip = c.ClientIP()
+		userAgent = c.GetHeader("User-Agent")
+	}
+
 	query := `
 		INSERT INTO audit_logs
 		(user_id, action, resource, resource_id, details, ip_address, user_agent)
@@ -254,13 +266,13 @@ func logAudit(userID int, action, resource string, resourceID interface{}, detai
 	}
 
 	db.Exec(query,
-		userID,
+		user,
 		action,
 		resource,
 		resourceIDStr,
 		detailsJSON,
-		c.ClientIP(),
-		c.GetHeader("User-Agent"),
+		ip,
+		userAgent,
 	)
 }
 
@@ -376,6 +388,19 @@ func login(c *gin.Context) {
 		"username": user.Username,
 	}, c)
 
+	// รวม guest cart เข้า cart ของ user ถ้ารวมไม่ได้ก็ยัง login ได้ตามปกติ
+	cartToken := req.CartToken
+	if cartToken == "" {
+		cartToken = c.GetHeader(cartTokenHeader)
+	}
+	if cartToken != "" {
+		if merged, err := mergeGuestCart(user.ID, cartToken); err != nil {
+			log.Printf("Error merging guest cart: %v", err)
+		} else if merged > 0 {
+			logAudit(user.ID, "merge", "cart", nil, gin.H{"items": merged}, c)
+		}
+	}
+
 	// ส่ง response
 	c.JSON(http.StatusOK, LoginResponse{
 		AccessToken:  accessToken,
@@ -525,7 +550,7 @@ func getAllBooks(c *gin.Context) {
 	var rows *sql.Rows
 	var err error
 	// ลูกค้าถาม "มีหนังสืออะไรบ้าง"
-	rows, err = db.Query("SELECT id, title, author, isbn, year, price, created_at, updated_at FROM books")
+	rows, err = db.Query("SELECT id, title, author, COALESCE(isbn, ''), COALESCE(year, 0), price, created_at, updated_at FROM books WHERE deleted_at IS NULL")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -549,11 +574,16 @@ func getAllBooks(c *gin.Context) {
 }
 
 func getBook(c *gin.Context) {
+	if asOf := c.Query("as_of"); asOf != "" {
+		getBookAsOf(c, asOf)
+		return
+	}
+
 	id := c.Param("id")
 	var book Book
 
 	// QueryRow ใช้เมื่อคาดว่าจะได้ผลลัพธ์ 0 หรือ 1 แถว
-	err := db.QueryRow("SELECT id, title, author FROM books WHERE id = $1", id).Scan(&book.ID, &book.Title, &book.Author)
+	err := db.QueryRow("SELECT id, title, author, version FROM books WHERE id = $1 AND deleted_at IS NULL", id).Scan(&book.ID, &book.Title, &book.Author, &book.Version)
 
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "book not found"})
@@ -563,6 +593,14 @@ func getBook(c *gin.Context) {
 		return
 	}
 
+	recordBookView(c.GetInt("user_id"), book.ID)
+
+	etag := bookETag(book)
+	c.Header("ETag", etag)
+	if match := c.GetHeader("If-None-Match"); match != "" && matchETag(match, etag, true) {
+		c.Status(http.StatusNotModified)
+		return
+	}
 	c.JSON(http.StatusOK, book)
 }
 
@@ -570,22 +608,35 @@ func createBook(c *gin.Context) {
 	var newBook Book
 
 	if err := c.ShouldBindJSON(&newBook); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	isbn, err := normalizeISBN(newBook.ISBN)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	newBook.ISBN = isbn
 
 	// ใช้ RETURNING เพื่อดึงค่าที่ database generate (id, timestamps)
 	var id int
 	var createdAt, updatedAt time.Time
 
-	err := db.QueryRow(
-		`INSERT INTO books (title, author, isbn, year, price)
-         VALUES ($1, $2, $3, $4, $5)
-         RETURNING id, created_at, updated_at`,
-		newBook.Title, newBook.Author, newBook.ISBN, newBook.Year, newBook.Price,
-	).Scan(&id, &createdAt, &updatedAt)
+	userID := c.GetInt("user_id")
+	err = withActingUser(userID, func(tx *sql.Tx) error {
+		return tx.QueryRow(
+			`INSERT INTO books (title, author, isbn, year, price)
+             VALUES ($1, $2, NULLIF($3, ''), $4, $5)
+             RETURNING id, created_at, updated_at`,
+			newBook.Title, newBook.Author, newBook.ISBN, newBook.Year, newBook.Price,
+		).Scan(&id, &createdAt, &updatedAt)
+	})
 
-	if err != nil {
+	if isUniqueViolation(err) {
+		respondISBNConflict(c, newBook.ISBN)
+		return
+	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -595,7 +646,6 @@ func createBook(c *gin.Context) {
 	newBook.UpdatedAt = updatedAt
 
 	// Log audit
-	userID := c.GetInt("user_id")
 	logAudit(userID, "create", "books", newBook.ID, gin.H{
 		"title":  newBook.Title,
 		"author": newBook.Author,
@@ -612,23 +662,47 @@ func updateBook(c *gin.Context) {
 	var updateBook Book
 
 	if err := c.ShouldBindJSON(&updateBook); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	isbn, err := normalizeISBN(updateBook.ISBN)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	updateBook.ISBN = isbn
+
+	ifMatch := c.GetHeader("If-Match")
 
 	var updatedAt time.Time
-	err := db.QueryRow(
-		`UPDATE books
-         SET title = $1, author = $2, isbn = $3, year = $4, price = $5
-         WHERE id = $6
-         RETURNING id, updated_at`,
-		updateBook.Title, updateBook.Author, updateBook.ISBN,
-		updateBook.Year, updateBook.Price, id,
-	).Scan(&ID, &updatedAt)
+	var current Book
+	userID := c.GetInt("user_id")
+	err = withActingUser(userID, func(tx *sql.Tx) error {
+		var err error
+		if current, err = lockBookVersion(tx, id, ifMatch); err != nil {
+			return err
+		}
+		return tx.QueryRow(
+			`UPDATE books
+             SET title = $1, author = $2, isbn = NULLIF($3, ''), year = $4, price = $5,
+                 updated_at = NOW(), version = version + 1
+             WHERE id = $6 AND deleted_at IS NULL
+             RETURNING id, updated_at, version`,
+			updateBook.Title, updateBook.Author, updateBook.ISBN,
+			updateBook.Year, updateBook.Price, id,
+		).Scan(&ID, &updatedAt, &updateBook.Version)
+	})
 
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "book not found"})
 		return
+	} else if err == errBookModified {
+		respondBookModified(c, current)
+		return
+	} else if isUniqueViolation(err) {
+		respondISBNConflict(c, updateBook.ISBN)
+		return
 	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -637,37 +711,43 @@ func updateBook(c *gin.Context) {
 	updateBook.UpdatedAt = updatedAt
 
 	// Log audit
-	userID := c.GetInt("user_id")
 	logAudit(userID, "update", "books", updateBook.ID, gin.H{
 		"title":  updateBook.Title,
 		"author": updateBook.Author,
 	}, c)
 
+	c.Header("ETag", bookETag(updateBook))
 	c.JSON(http.StatusOK, updateBook)
 }
 
 func deleteBook(c *gin.Context) {
 	id := c.Param("id")
 
-	result, err := db.Exec("DELETE FROM books WHERE id = $1", id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
+	ifMatch := c.GetHeader("If-Match")
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	if rowsAffected == 0 {
+	// soft delete: ย้ายเข้าถังขยะ ลบถาวรโดย purge job เมื่อเกิน TRASH_RETENTION_DAYS
+	var current Book
+	userID := c.GetInt("user_id")
+	err := withActingUser(userID, func(tx *sql.Tx) error {
+		var err error
+		if current, err = lockBookVersion(tx, id, ifMatch); err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE books SET deleted_at = NOW(), version = version + 1 WHERE id = $1", id)
+		return err
+	})
+	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "book not found"})
 		return
+	} else if err == errBookModified {
+		respondBookModified(c, current)
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
 	// Log audit
-	userID := c.GetInt("user_id")
 	logAudit(userID, "delete", "books", id, nil, c)
 
 	c.JSON(http.StatusOK, gin.H{"message": "book deleted successfully"})
@@ -685,6 +765,21 @@ func main() {
 	initDB()
 	defer db.Close()
 
+	var err error
+	gateway, err = newPaymentGateway()
+	if err != nil {
+		log.Fatal("failed to set up payment gateway: ", err)
+	}
+	sender, err = newNotifier()
+	if err != nil {
+		log.Fatal("failed to set up notifier: ", err)
+	}
+
+	startTrashPurger()
+	startGuestCartCleaner()
+	startWishlistWatcher()
+	startRecommendationBuilder()
+
 	r := gin.Default()
 	r.Use(cors.Default())
 
@@ -710,6 +805,21 @@ func main() {
 		auth.POST("/logout", logout)               // Logout และ revoke token
 	}
 
+	// ===================== Payment Webhooks =====================
+	// gateway เรียกเข้ามาโดยตรง ตรวจสอบด้วยลายเซ็นแทน JWT
+	r.POST("/api/v1/payments/webhooks/:provider", paymentWebhook)
+
+	// ===================== Guest Cart Endpoints =====================
+	// cart ของคนที่ยังไม่ login ระบุด้วย X-Cart-Token ที่ได้จากการเพิ่มของครั้งแรก
+	guest := r.Group("/api/v1/guest/cart")
+	{
+		guest.GET("", getCart)
+		guest.POST("/items", addCartItem)
+		guest.PUT("/items/:book_id", updateCartItem)
+		guest.DELETE("/items/:book_id", removeCartItem)
+		guest.DELETE("", clearCart)
+	}
+
 	// ===================== Protected API Endpoints =====================
 	api := r.Group("/api/v1")
 	api.Use(authMiddleware()) // ทุก endpoint ต้อง authenticate
@@ -719,14 +829,30 @@ func main() {
 			requirePermission("books:read"),
 			getAllBooks)
 
+		api.GET("/books/trash",
+			requirePermission("books:trash"),
+			listTrash)
+
 		api.GET("/books/:id",
 			requirePermission("books:read"),
-			getBook)
+			getBook) // ?as_of=2025-01-07T09:00:00+07:00 ดูสถานะย้อนหลัง
+
+		api.GET("/books/:id/related",
+			requirePermission("books:read"),
+			getRelatedBooks) // ?limit=10
+
+		api.GET("/books/:id/history",
+			requirePermission("books:read"),
+			getBookHistory)
 
 		api.POST("/books",
 			requirePermission("books:create"),
 			createBook)
 
+		api.POST("/books/import",
+			requirePermission("books:create"),
+			importBooks) // CSV หรือ NDJSON, ?dry_run=true เพื่อตรวจอย่างเดียว
+
 		api.PUT("/books/:id",
 			requirePermission("books:update"),
 			updateBook)
@@ -734,6 +860,173 @@ func main() {
 		api.DELETE("/books/:id",
 			requirePermission("books:delete"),
 			deleteBook)
+
+		api.POST("/books/:id/restore",
+			requirePermission("books:trash"),
+			restoreBook)
+
+		// Reviews endpoints (รีวิวของตัวเอง ยกเว้น moderate)
+		api.GET("/books/:id/reviews",
+			requirePermission("books:read"),
+			listReviews) // ?status=hidden|all ต้องมี reviews:moderate
+
+		api.POST("/books/:id/reviews",
+			requirePermission("reviews:write"),
+			createReview)
+
+		api.PUT("/books/:id/reviews",
+			requirePermission("reviews:write"),
+			updateReview)
+
+		api.DELETE("/books/:id/reviews",
+			requirePermission("reviews:write"),
+			deleteReview)
+
+		api.PUT("/books/:id/reviews/:review_id/status",
+			requirePermission("reviews:moderate"),
+			moderateReview)
+
+		// Cart endpoints (ทุก user ที่ login แล้ว ไม่ต้องมี permission เพิ่ม)
+		api.GET("/cart", getCart)
+		api.POST("/cart/items", addCartItem)
+		api.PUT("/cart/items/:book_id", updateCartItem)
+		api.DELETE("/cart/items/:book_id", removeCartItem)
+		api.DELETE("/cart", clearCart)
+
+		// Order endpoints (ลูกค้าเห็นเฉพาะ order ของตัวเอง)
+		api.POST("/orders", createOrder) // ไม่ส่ง items = checkout ทั้ง cart
+		api.GET("/orders", listMyOrders)
+		api.GET("/orders/:id", getMyOrder)
+		api.POST("/orders/:id/cancel", cancelMyOrder) // เฉพาะ pending
+
+		// Payment endpoints (ลูกค้าจ่ายเงินของ order ตัวเอง)
+		api.POST("/orders/:id/payments", createPayment)
+		api.GET("/orders/:id/payments", listMyOrderPayments)
+		api.POST("/orders/:id/payments/:payment_id/confirm", confirmPayment)
+
+		// Tax invoice endpoints (ออกให้อัตโนมัติเมื่อ order เป็น paid)
+		api.GET("/orders/:id/invoice", getMyInvoice)
+		api.GET("/orders/:id/invoice/pdf", getMyInvoicePDF)
+
+		// Wishlist endpoints (ของ user ที่ login)
+		api.GET("/wishlist", getWishlist)
+		api.POST("/wishlist", addWishlistItem)
+		api.PUT("/wishlist/:book_id", updateWishlistItem)
+		api.DELETE("/wishlist/:book_id", removeWishlistItem)
+		api.GET("/notifications", listMyNotifications)
+
+		// Recommendation endpoints (คำนวณล่วงหน้าโดย job)
+		api.GET("/me/recommendations",
+			requirePermission("books:read"),
+			getMyRecommendations) // ?limit=10
+
+		// Staff order endpoints (ทุก order)
+		api.GET("/staff/orders",
+			requirePermission("orders:read"),
+			listAllOrders) // ?status=paid&user_id=3
+
+		api.GET("/staff/orders/:id",
+			requirePermission("orders:read"),
+			getAnyOrder)
+
+		api.PUT("/staff/orders/:id/status",
+			requirePermission("orders:update"),
+			updateOrderStatus)
+
+		api.GET("/staff/orders/:id/invoice",
+			requirePermission("orders:read"),
+			getAnyInvoice)
+
+		api.GET("/staff/orders/:id/invoice/pdf",
+			requirePermission("orders:read"),
+			getAnyInvoicePDF)
+
+		// Staff notification endpoints
+		api.GET("/staff/notifications",
+			requirePermission("notifications:read"),
+			listAllNotifications) // ?status=failed
+
+		api.POST("/staff/notifications/:id/retry",
+			requirePermission("notifications:manage"),
+			retryNotification)
+
+		api.POST("/staff/recommendations/rebuild",
+			requirePermission("recommendations:manage"),
+			rebuildRecommendationsNow)
+
+		// Staff payment endpoints
+		api.GET("/staff/orders/:id/payments",
+			requirePermission("payments:read"),
+			listOrderPayments)
+
+		api.POST("/staff/payments/:id/capture",
+			requirePermission("payments:manage"),
+			capturePayment) // เมื่อ PAYMENT_CAPTURE=manual
+
+		api.POST("/staff/payments/:id/refund",
+			requirePermission("payments:manage"),
+			refundPayment)
+
+		// Promotion endpoints
+		api.POST("/promotions/quote", quotePrices) // ทุก user ที่ login แล้ว ไม่ส่ง items = ราคาของ cart
+
+		api.GET("/promotions",
+			requirePermission("promotions:read"),
+			listPromotions) // ?active=true
+
+		api.GET("/promotions/:id",
+			requirePermission("promotions:read"),
+			getPromotion)
+
+		api.POST("/promotions",
+			requirePermission("promotions:manage"),
+			createPromotion)
+
+		api.PUT("/promotions/:id",
+			requirePermission("promotions:manage"),
+			updatePromotion)
+
+		api.DELETE("/promotions/:id",
+			requirePermission("promotions:manage"),
+			deletePromotion)
+
+		// Inventory endpoints
+		api.GET("/books/:id/stock",
+			requirePermission("inventory:read"),
+			getStock)
+
+		api.PUT("/books/:id/stock",
+			requirePermission("inventory:adjust"),
+			updateStockSettings) // low_stock_threshold ของเล่มนี้
+
+		api.GET("/books/:id/stock/movements",
+			requirePermission("inventory:read"),
+			listStockMovements)
+
+		api.POST("/books/:id/stock/movements",
+			requirePermission("inventory:adjust"),
+			createStockMovement) // receive, sell, adjust, return
+
+		api.GET("/inventory/low-stock",
+			requirePermission("inventory:read"),
+			listLowStock) // ?threshold=10
+
+		// Categories endpoints (admin)
+		api.GET("/categories",
+			requirePermission("books:read"),
+			listCategories)
+
+		api.POST("/categories",
+			requirePermission("categories:create"),
+			createCategory)
+
+		api.PUT("/categories/:id",
+			requirePermission("categories:update"),
+			updateCategory)
+
+		api.DELETE("/categories/:id",
+			requirePermission("categories:delete"),
+			deleteCategory)
 	}
 
 	r.Run(":8080")
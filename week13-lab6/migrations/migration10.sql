@@ -0,0 +1,67 @@
+-- ต้องรันหลัง migration9.sql
+
+-- 15. Orders
+
+-- status เปลี่ยนได้ตาม state machine ใน orders.go เท่านั้น
+-- pending → paid → shipped → delivered, ยกเลิกได้ก่อนส่ง (cancelled), คืนเงินได้หลังจ่ายแล้ว (refunded)
+CREATE TABLE IF NOT EXISTS orders (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'paid', 'shipped', 'delivered', 'cancelled', 'refunded')),
+    item_count INTEGER NOT NULL CHECK (item_count > 0),
+    subtotal DECIMAL(10,2) NOT NULL CHECK (subtotal >= 0),
+    note TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_orders_user ON orders(user_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_orders_status ON orders(status, id DESC);
+
+-- snapshot ของหนังสือและราคา ณ ตอนสั่งซื้อ แก้ books ทีหลังไม่กระทบ order เดิม
+CREATE TABLE IF NOT EXISTS order_items (
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    book_id INTEGER REFERENCES books(id) ON DELETE SET NULL,
+    title VARCHAR(255) NOT NULL,
+    author VARCHAR(255) NOT NULL,
+    isbn VARCHAR(20),
+    unit_price DECIMAL(10,2) NOT NULL CHECK (unit_price >= 0),
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    line_total DECIMAL(10,2) NOT NULL,
+    position INTEGER NOT NULL,
+    PRIMARY KEY (order_id, position)
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_items_book ON order_items(book_id);
+
+-- ประวัติการเปลี่ยน status ทุกครั้ง (from_status เป็น NULL ตอนสร้าง order)
+CREATE TABLE IF NOT EXISTS order_status_history (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    from_status VARCHAR(20),
+    to_status VARCHAR(20) NOT NULL,
+    note TEXT,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_status_history_order ON order_status_history(order_id, id);
+
+-- 16. Order Permissions
+-- ลูกค้าสั่งซื้อและดู order ของตัวเองได้โดยไม่ต้องมี permission เหล่านี้
+
+INSERT INTO permissions (name, description, resource, action) VALUES
+('orders:read', 'Can view all customers'' orders', 'orders', 'read'),
+('orders:update', 'Can change order status', 'orders', 'update')
+ON CONFLICT (name) DO NOTHING;
+
+-- Admin + Editor เท่านั้น: ทุก order permissions
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r, permissions p
+WHERE r.name IN ('admin', 'editor')
+  AND p.resource = 'orders'
+ON CONFLICT DO NOTHING;
+
+-- Viewer: ไม่ได้สิทธิ์ orders เพราะมีชื่อ เลขผู้เสียภาษี และที่อยู่ของลูกค้า (เหมือน notifications ใน migration14)
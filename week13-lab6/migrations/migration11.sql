@@ -0,0 +1,55 @@
+-- ต้องรันหลัง migration10.sql
+
+-- 17. Payments
+
+-- provider_ref คือ id ของ payment intent ฝั่ง gateway
+CREATE TABLE IF NOT EXISTS payments (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    provider VARCHAR(30) NOT NULL,
+    provider_ref VARCHAR(100) NOT NULL,
+    amount DECIMAL(10,2) NOT NULL CHECK (amount > 0),
+    amount_refunded DECIMAL(10,2) NOT NULL DEFAULT 0 CHECK (amount_refunded >= 0 AND amount_refunded <= amount),
+    currency CHAR(3) NOT NULL,
+    status VARCHAR(30) NOT NULL DEFAULT 'requires_confirmation'
+        CHECK (status IN ('requires_confirmation', 'requires_capture', 'succeeded', 'failed', 'refunded')),
+    failure_reason TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (provider, provider_ref)
+);
+
+CREATE INDEX IF NOT EXISTS idx_payments_order ON payments(order_id);
+
+-- กันจ่ายซ้ำ: หนึ่ง order มี payment ที่ยังไม่ failed ได้แค่รายการเดียว
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payments_order_active ON payments(order_id) WHERE status <> 'failed';
+
+-- ทุก webhook ที่รับมา event_id ซ้ำ = gateway ส่งซ้ำ ไม่ต้องทำอะไรอีก
+CREATE TABLE IF NOT EXISTS payment_events (
+    id SERIAL PRIMARY KEY,
+    provider VARCHAR(30) NOT NULL,
+    event_id VARCHAR(100) NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    payment_id INTEGER REFERENCES payments(id) ON DELETE SET NULL,  -- NULL ถ้าไม่รู้จัก intent นี้
+    payload JSONB NOT NULL,
+    received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (provider, event_id)
+);
+
+-- 18. Payment Permissions
+-- ลูกค้าจ่ายเงินและดู payment ของ order ตัวเองได้โดยไม่ต้องมี permission เหล่านี้
+
+INSERT INTO permissions (name, description, resource, action) VALUES
+('payments:read', 'Can view payments of any order', 'payments', 'read'),
+('payments:manage', 'Can capture and refund payments', 'payments', 'manage')
+ON CONFLICT (name) DO NOTHING;
+
+-- Admin + Editor เท่านั้น: ทุก payment permissions
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r, permissions p
+WHERE r.name IN ('admin', 'editor')
+  AND p.resource = 'payments'
+ON CONFLICT DO NOTHING;
+
+-- Viewer: ไม่ได้สิทธิ์ payments เพราะเป็นข้อมูลการจ่ายเงินของลูกค้าแต่ละคน (เหมือน orders ใน migration10)
@@ -0,0 +1,74 @@
+-- ต้องรันหลัง migration11.sql
+
+-- 19. Promotions
+
+-- code เก็บเป็นตัวพิมพ์ใหญ่ NULL = โปรอัตโนมัติ ไม่ต้องกรอกโค้ด
+-- times_used นับจาก promotion_redemptions ใช้ล็อกแถวนี้ตอนสั่งซื้อเพื่อไม่ให้ใช้เกิน usage_limit
+CREATE TABLE IF NOT EXISTS promotions (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    code VARCHAR(50) UNIQUE,
+    promo_type VARCHAR(20) NOT NULL CHECK (promo_type IN ('percent_off', 'amount_off', 'buy_x_get_y')),
+    value DECIMAL(10,2) NOT NULL CHECK (value > 0),
+    buy_quantity INTEGER CHECK (buy_quantity > 0),
+    get_quantity INTEGER CHECK (get_quantity > 0),
+    category_id INTEGER REFERENCES categories(id) ON DELETE CASCADE,
+    min_spend DECIMAL(10,2) NOT NULL DEFAULT 0 CHECK (min_spend >= 0),
+    starts_at TIMESTAMP,
+    ends_at TIMESTAMP,
+    usage_limit INTEGER CHECK (usage_limit > 0),
+    per_user_limit INTEGER CHECK (per_user_limit > 0),
+    stackable BOOLEAN NOT NULL DEFAULT FALSE,
+    priority INTEGER NOT NULL DEFAULT 0,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    times_used INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (promo_type <> 'buy_x_get_y' OR (buy_quantity IS NOT NULL AND get_quantity IS NOT NULL)),
+    CHECK (ends_at IS NULL OR starts_at IS NULL OR ends_at > starts_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_promotions_automatic ON promotions(active) WHERE code IS NULL;
+
+-- หนึ่งแถวต่อโปรที่ใช้ในแต่ละ order ใช้นับ per_user_limit
+CREATE TABLE IF NOT EXISTS promotion_redemptions (
+    promotion_id INTEGER NOT NULL REFERENCES promotions(id) ON DELETE RESTRICT,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    discount DECIMAL(10,2) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (promotion_id, order_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_promotion_redemptions_user ON promotion_redemptions(promotion_id, user_id);
+
+-- ยอดของ order หลังหักโปรโมชัน (subtotal = ก่อนหัก)
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS discount DECIMAL(10,2) NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS total DECIMAL(10,2);
+UPDATE orders SET total = subtotal - discount WHERE total IS NULL;
+ALTER TABLE orders ALTER COLUMN total SET NOT NULL;
+
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS discount DECIMAL(10,2) NOT NULL DEFAULT 0;
+
+-- 20. Promotion Permissions
+
+INSERT INTO permissions (name, description, resource, action) VALUES
+('promotions:read', 'Can view promotions and coupon codes', 'promotions', 'read'),
+('promotions:manage', 'Can create, update and delete promotions', 'promotions', 'manage')
+ON CONFLICT (name) DO NOTHING;
+
+-- Admin + Editor: ทุก promotion permissions
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r, permissions p
+WHERE r.name IN ('admin', 'editor')
+  AND p.resource = 'promotions'
+ON CONFLICT DO NOTHING;
+
+-- Viewer: read-only
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r, permissions p
+WHERE r.name = 'viewer'
+  AND p.name = 'promotions:read'
+ON CONFLICT DO NOTHING;
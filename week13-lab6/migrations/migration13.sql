@@ -0,0 +1,40 @@
+-- ต้องรันหลัง migration12.sql
+
+-- 21. VAT and Buyer Details on Orders
+
+-- vat_rate เป็นเปอร์เซ็นต์ตอนสั่งซื้อ เก็บไว้กับ order เพื่อให้ใบกำกับภาษีตรงกับยอดที่จ่ายจริงแม้เปลี่ยน VAT_RATE ทีหลัง
+-- order เก่าก่อน migration นี้ถือว่าเป็นราคารวม VAT 7%
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS vat_rate DECIMAL(5,2) NOT NULL DEFAULT 7 CHECK (vat_rate >= 0 AND vat_rate <= 100);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS prices_include_vat BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS vat_amount DECIMAL(10,2);
+UPDATE orders SET vat_amount = ROUND(total * vat_rate / (100 + vat_rate), 2) WHERE vat_amount IS NULL;
+ALTER TABLE orders ALTER COLUMN vat_amount SET NOT NULL;
+
+-- ข้อมูลผู้ซื้อสำหรับใบกำกับภาษีเต็มรูป NULL = ออกแบบอย่างย่อ
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS buyer_name VARCHAR(200);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS buyer_tax_id CHAR(13);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS buyer_branch CHAR(5);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS buyer_address VARCHAR(500);
+
+-- 22. Tax Invoices
+
+-- เลขที่ใบกำกับภาษีเรียงต่อกันไม่ข้ามเลข แยกตามปี ใช้ล็อกแถวของปีนั้นแทน SEQUENCE
+-- เพราะ SEQUENCE ไม่ย้อนกลับเมื่อ transaction rollback ทำให้เลขขาดหาย
+CREATE TABLE IF NOT EXISTS invoice_sequences (
+    year INTEGER PRIMARY KEY,
+    last_number INTEGER NOT NULL
+);
+
+-- หนึ่งใบต่อ order ออกตอน order เป็น paid document เก็บเอกสารทั้งฉบับตามที่ออกไป
+CREATE TABLE IF NOT EXISTS invoices (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL UNIQUE REFERENCES orders(id) ON DELETE RESTRICT,
+    invoice_number VARCHAR(50) NOT NULL UNIQUE,
+    issued_at TIMESTAMP NOT NULL,
+    total DECIMAL(10,2) NOT NULL,
+    vat_amount DECIMAL(10,2) NOT NULL,
+    document JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_invoices_issued_at ON invoices(issued_at);
@@ -0,0 +1,60 @@
+-- ต้องรันหลัง migration13.sql
+
+-- 23. Wishlist
+
+-- last_price, last_discount, last_in_stock คือสิ่งที่ตรวจครั้งล่าสุด job เทียบกับค่าปัจจุบันแล้วแจ้งเตือนเมื่อเปลี่ยน
+-- added_price คือราคาตอนเพิ่มเข้า wishlist ใช้แสดงว่าถูกลงไปเท่าไรแล้ว
+CREATE TABLE IF NOT EXISTS wishlist_items (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    note VARCHAR(500),
+    notify BOOLEAN NOT NULL DEFAULT TRUE,
+    added_price DECIMAL(10,2) NOT NULL,
+    last_price DECIMAL(10,2) NOT NULL,
+    last_discount INTEGER NOT NULL DEFAULT 0,
+    last_in_stock BOOLEAN NOT NULL,
+    added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, book_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_wishlist_items_book ON wishlist_items(book_id);
+
+-- 24. Notifications
+
+-- คิวข้อความที่จะส่ง (outbox) เพิ่มใน transaction เดียวกับที่ตรวจเจอการเปลี่ยนแปลง แล้ว job ค่อยส่งทีหลัง
+CREATE TABLE IF NOT EXISTS notifications (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    book_id INTEGER REFERENCES books(id) ON DELETE SET NULL,
+    kind VARCHAR(30) NOT NULL CHECK (kind IN ('price_drop', 'price_increase', 'back_in_stock')),
+    subject VARCHAR(300) NOT NULL,
+    body TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sending', 'sent', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMP
+);
+
+-- sending = job claim ไปส่งแล้ว next_attempt_at คือเวลาหมด lease ถ้า job ตายระหว่างส่งจะถูก claim ใหม่
+CREATE INDEX IF NOT EXISTS idx_notifications_due ON notifications(next_attempt_at) WHERE status IN ('pending', 'sending');
+CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, id);
+
+-- 25. Notification Permissions
+
+INSERT INTO permissions (name, description, resource, action) VALUES
+('notifications:read', 'Can view notifications sent to all users', 'notifications', 'read'),
+('notifications:manage', 'Can retry failed notifications', 'notifications', 'manage')
+ON CONFLICT (name) DO NOTHING;
+
+-- Admin + Editor เท่านั้น: ทุก notification permissions
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r, permissions p
+WHERE r.name IN ('admin', 'editor')
+  AND p.resource = 'notifications'
+ON CONFLICT DO NOTHING;
+
+-- Viewer: ไม่ได้สิทธิ์ notifications เพราะมีอีเมลและข้อความของผู้ใช้คนอื่น
@@ -0,0 +1,54 @@
+-- ต้องรันหลัง migration14.sql
+
+-- 26. Book Views
+
+-- นับการเปิดดูหนังสือของ user วันละแถว ใช้เป็นสัญญาณของ recommendation
+CREATE TABLE IF NOT EXISTS book_views (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    viewed_on DATE NOT NULL DEFAULT CURRENT_DATE,
+    views INTEGER NOT NULL DEFAULT 1,
+    PRIMARY KEY (user_id, book_id, viewed_on)
+);
+
+CREATE INDEX IF NOT EXISTS idx_book_views_day ON book_views(viewed_on);
+
+-- 27. Recommendations
+
+-- ผลที่ job คำนวณไว้ล่วงหน้า เขียนทับทั้งตารางทุกครั้งที่ job รัน
+-- computed_at ใช้ค่า default ทุกแถวในรอบเดียวกันจึงได้เวลาเดียวกัน (เวลาเริ่ม transaction)
+-- reasons: customers_also_viewed, same_author, same_category
+CREATE TABLE IF NOT EXISTS related_books (
+    book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    related_book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    score DOUBLE PRECISION NOT NULL,
+    reasons TEXT[] NOT NULL,
+    computed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (book_id, related_book_id)
+);
+
+-- because_book_id คือหนังสือในประวัติของ user ที่ทำให้ได้คำแนะนำนี้มากที่สุด
+CREATE TABLE IF NOT EXISTS user_recommendations (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    score DOUBLE PRECISION NOT NULL,
+    because_book_id INTEGER REFERENCES books(id) ON DELETE SET NULL,
+    reasons TEXT[] NOT NULL,
+    computed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, book_id)
+);
+
+-- 28. Recommendation Permissions
+-- ทุก user ที่มี books:read ดู related และคำแนะนำของตัวเองได้อยู่แล้ว
+
+INSERT INTO permissions (name, description, resource, action) VALUES
+('recommendations:manage', 'Can rebuild recommendations on demand', 'recommendations', 'manage')
+ON CONFLICT (name) DO NOTHING;
+
+-- Admin + Editor
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r, permissions p
+WHERE r.name IN ('admin', 'editor')
+  AND p.resource = 'recommendations'
+ON CONFLICT DO NOTHING;
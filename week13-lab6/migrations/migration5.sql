@@ -0,0 +1,27 @@
+-- ต้องรันหลัง migration4.sql และหลัง week11-assignment/migrations/006_create_categories_table_up.sql
+
+-- 8. Categories Permissions
+
+INSERT INTO permissions (name, description, resource, action) VALUES
+('categories:create', 'Can create categories', 'categories', 'create'),
+('categories:update', 'Can update categories', 'categories', 'update'),
+('categories:delete', 'Can delete categories', 'categories', 'delete')
+ON CONFLICT (name) DO NOTHING;
+
+-- Admin: ทุก categories permissions
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT
+    (SELECT id FROM roles WHERE name = 'admin'),
+    id
+FROM permissions
+WHERE resource = 'categories'
+ON CONFLICT DO NOTHING;
+
+-- Editor: create + update (ยกเว้น delete เหมือน books)
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT
+    (SELECT id FROM roles WHERE name = 'editor'),
+    id
+FROM permissions
+WHERE name IN ('categories:create', 'categories:update')
+ON CONFLICT DO NOTHING;
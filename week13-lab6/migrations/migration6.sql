@@ -0,0 +1,16 @@
+-- ต้องรันหลัง migration5.sql และหลัง week11-assignment/migrations/009_add_books_soft_delete_up.sql
+
+-- 9. Trash Permissions
+
+INSERT INTO permissions (name, description, resource, action) VALUES
+('books:trash', 'Can view and restore deleted books', 'books', 'trash')
+ON CONFLICT (name) DO NOTHING;
+
+-- Admin เท่านั้นที่ดูถังขยะและกู้คืนหนังสือได้
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT
+    (SELECT id FROM roles WHERE name = 'admin'),
+    id
+FROM permissions
+WHERE name = 'books:trash'
+ON CONFLICT DO NOTHING;
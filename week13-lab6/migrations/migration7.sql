@@ -0,0 +1,74 @@
+-- ต้องรันหลัง migration6.sql และหลัง week11-assignment/migrations/013_ignore_review_counters_in_revisions_up.sql
+-- (013 ทำให้การคำนวณ rating/reviews ใหม่ไม่ถูกเก็บเป็น book revision)
+
+-- 10. Reviews
+
+CREATE TABLE IF NOT EXISTS reviews (
+    id SERIAL PRIMARY KEY,
+    book_id INTEGER REFERENCES books(id) ON DELETE SET NULL,  -- NULL = หนังสือถูก purge ไปแล้ว รีวิวยังเก็บไว้
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    rating SMALLINT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+    title VARCHAR(200),
+    body TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'published' CHECK (status IN ('published', 'hidden')),
+    moderated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    moderated_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (book_id, user_id)  -- หนึ่งคนรีวิวหนังสือหนึ่งเล่มได้ครั้งเดียว
+);
+
+CREATE INDEX IF NOT EXISTS idx_reviews_book ON reviews(book_id, status, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_reviews_user ON reviews(user_id);
+
+-- books.rating / books.reviews เป็นค่าสรุปจากรีวิวที่ published เท่านั้น
+-- แอปคำนวณใหม่ใน transaction เดียวกับการเขียนรีวิว หนังสือที่ไม่มีรีวิว published เลยใช้ค่า seed เดิม
+-- (ถ้าตั้งเป็น 0 ทั้งหมด /books/featured ของ week11 ซึ่งต้องการ rating >= 4.0 จะว่างเปล่า)
+-- เก็บค่า seed ไว้แยก เมื่อรีวิวสุดท้ายถูกซ่อนหรือลบ refreshBookRating จะกลับไปใช้ค่านี้
+CREATE TABLE IF NOT EXISTS book_rating_seeds (
+    book_id INTEGER PRIMARY KEY REFERENCES books(id) ON DELETE CASCADE,
+    rating DECIMAL(3,2) NOT NULL,
+    reviews INTEGER NOT NULL
+);
+
+-- เฉพาะเล่มที่ยังไม่มีรีวิว ถ้ารันซ้ำ ค่าของเล่มที่มีรีวิวแล้วมาจากรีวิวจริง ไม่ใช่ seed
+INSERT INTO book_rating_seeds (book_id, rating, reviews)
+SELECT b.id, b.rating, b.reviews
+FROM books b
+WHERE (b.rating > 0 OR b.reviews > 0)
+  AND NOT EXISTS (SELECT 1 FROM reviews r WHERE r.book_id = b.id)
+ON CONFLICT (book_id) DO NOTHING;
+
+UPDATE books b
+SET rating = COALESCE((
+        SELECT ROUND(AVG(r.rating), 2) FROM reviews r
+        WHERE r.book_id = b.id AND r.status = 'published'
+    ), 0),
+    reviews = (
+        SELECT COUNT(*) FROM reviews r
+        WHERE r.book_id = b.id AND r.status = 'published'
+    )
+WHERE EXISTS (SELECT 1 FROM reviews r WHERE r.book_id = b.id);
+
+-- 11. Reviews Permissions
+
+INSERT INTO permissions (name, description, resource, action) VALUES
+('reviews:write', 'Can write, edit and delete own reviews', 'reviews', 'write'),
+('reviews:moderate', 'Can hide or publish any review', 'reviews', 'moderate')
+ON CONFLICT (name) DO NOTHING;
+
+-- ทุก role ยกเว้น viewer (read-only) เขียนรีวิวของตัวเองได้
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r, permissions p
+WHERE r.name IN ('admin', 'editor', 'user')
+  AND p.name = 'reviews:write'
+ON CONFLICT DO NOTHING;
+
+-- Admin + Editor: moderate
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r, permissions p
+WHERE r.name IN ('admin', 'editor')
+  AND p.name = 'reviews:moderate'
+ON CONFLICT DO NOTHING;
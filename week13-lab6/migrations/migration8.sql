@@ -0,0 +1,41 @@
+-- ต้องรันหลัง migration7.sql และหลัง week11-assignment/migrations/012_create_inventory_up.sql
+
+-- 12. Stock Movements
+
+-- ledger ของทุกการเปลี่ยนสต็อก inventory.quantity ต้องเท่ากับผลรวม quantity ของเล่มนั้นเสมอ
+CREATE TABLE IF NOT EXISTS stock_movements (
+    id SERIAL PRIMARY KEY,
+    book_id INTEGER REFERENCES books(id) ON DELETE SET NULL,  -- NULL = หนังสือถูก purge ไปแล้ว ประวัติยังอยู่
+    movement_type VARCHAR(20) NOT NULL CHECK (movement_type IN ('receive', 'sell', 'adjust', 'return')),
+    quantity INTEGER NOT NULL CHECK (quantity <> 0),  -- บวก = เข้า, ลบ = ออก
+    balance_after INTEGER NOT NULL CHECK (balance_after >= 0),
+    reason TEXT,
+    reference VARCHAR(100),  -- เช่น เลขใบรับสินค้า หรือเลขคำสั่งซื้อ
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_movements_book ON stock_movements(book_id, created_at DESC);
+
+-- 13. Inventory Permissions
+
+INSERT INTO permissions (name, description, resource, action) VALUES
+('inventory:read', 'Can view stock levels and movements', 'inventory', 'read'),
+('inventory:adjust', 'Can receive, sell, adjust and return stock', 'inventory', 'adjust')
+ON CONFLICT (name) DO NOTHING;
+
+-- Admin + Editor: ทุก inventory permissions
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r, permissions p
+WHERE r.name IN ('admin', 'editor')
+  AND p.resource = 'inventory'
+ON CONFLICT DO NOTHING;
+
+-- Viewer: read-only
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r, permissions p
+WHERE r.name = 'viewer'
+  AND p.name = 'inventory:read'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,27 @@
+-- ต้องรันหลัง migration8.sql
+
+-- 14. Shopping Carts
+
+-- หนึ่ง user มีได้หนึ่ง cart, cart ของคนที่ยังไม่ login ระบุด้วย token ที่ server สร้างให้
+CREATE TABLE IF NOT EXISTS carts (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    token VARCHAR(64) UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (user_id IS NOT NULL OR token IS NOT NULL)
+);
+
+-- สำหรับลบ guest cart ที่ถูกทิ้งไว้
+CREATE INDEX IF NOT EXISTS idx_carts_guest_updated ON carts(updated_at) WHERE user_id IS NULL;
+
+-- seen_price คือราคาที่ลูกค้าเห็นล่าสุด ใช้เตือนเมื่อราคาเปลี่ยน (ราคาจริงอ่านจาก books ทุกครั้ง)
+CREATE TABLE IF NOT EXISTS cart_items (
+    cart_id INTEGER NOT NULL REFERENCES carts(id) ON DELETE CASCADE,
+    book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    seen_price DECIMAL(10,2) NOT NULL,
+    added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (cart_id, book_id)
+);
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ===================== Money =====================
+// Money is an amount in satang (1/100 baht). It scans DECIMAL columns and
+// reads JSON numbers exactly, without going through float64, and writes
+// JSON as a plain number with two decimals, e.g. 1234.50. A value that
+// isn't an amount fails as a *json.UnmarshalTypeError, so binding errors
+// still name the field. Amounts that are already float64 (e.g. promotion
+// values) convert with moneyFromFloat.
+type Money int64
+
+// moneyFromFloat ใช้กับค่าที่เป็น float อยู่แล้ว เช่น ยอดเงินใน request หรือ value ของโปรโมชันแบบ amount_off
+func moneyFromFloat(v float64) Money {
+	return Money(math.Round(v * 100))
+}
+
+// parseMoney reads a decimal such as "1234.5", "-0.25" or "100". A third
+// decimal place is rounded half away from zero; more are ignored.
+func parseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	digits := strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+	whole, frac, _ := strings.Cut(digits, ".")
+	if whole == "" && frac == "" {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	for _, part := range []string{whole, frac} {
+		for _, r := range part {
+			if r < '0' || r > '9' {
+				return 0, fmt.Errorf("invalid amount %q", s)
+			}
+		}
+	}
+
+	var baht int64
+	if whole != "" {
+		var err error
+		if baht, err = strconv.ParseInt(whole, 10, 64); err != nil {
+			return 0, fmt.Errorf("invalid amount %q", s)
+		}
+	}
+	frac += "000"
+	satang, _ := strconv.ParseInt(frac[:2], 10, 64)
+	if frac[2] >= '5' {
+		satang++
+	}
+
+	m := Money(baht*100 + satang)
+	if neg {
+		m = -m
+	}
+	return m, nil
+}
+
+func (m Money) Float64() float64 {
+	return float64(m) / 100
+}
+
+// Mul คูณด้วยจำนวนชิ้น
+func (m Money) Mul(quantity int) Money {
+	return m * Money(quantity)
+}
+
+// Percent returns percent% of m rounded to the satang.
+func (m Money) Percent(percent float64) Money {
+	return Money(math.Round(float64(m) * percent / 100))
+}
+
+// String คืนค่าแบบ 1234.50 (ไม่มีคอมมา) ใช้ทั้งใน JSON และส่งให้ database
+func (m Money) String() string {
+	sign := ""
+	v := int64(m)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/100, v%100)
+}
+
+// Format คืนค่าแบบ 1,234.50 สำหรับเอกสาร
+func (m Money) Format() string {
+	s := m.String()
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, frac, _ := strings.Cut(s, ".")
+	var b strings.Builder
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	return sign + b.String() + "." + frac
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	v, err := parseMoney(strings.Trim(s, `"`))
+	if err != nil {
+		return &json.UnmarshalTypeError{Value: s, Type: reflect.TypeOf(*m)}
+	}
+	*m = v
+	return nil
+}
+
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case []byte:
+		return m.scanString(string(v))
+	case string:
+		return m.scanString(v)
+	case int64:
+		*m = Money(v * 100)
+	case float64:
+		*m = moneyFromFloat(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+	return nil
+}
+
+func (m *Money) scanString(s string) error {
+	v, err := parseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// ===================== VAT =====================
+// taxConfig คือการตั้งค่า VAT แต่ละ order เก็บค่าที่ใช้ตอนสั่งซื้อไว้ เปลี่ยน env ทีหลังไม่กระทบ order เดิม
+type taxConfig struct {
+	RateBP           int64 // basis points, 700 = 7%
+	PricesIncludeVAT bool  // true = ราคาใน books รวม VAT แล้ว (ราคาขายปลีกปกติ)
+}
+
+// loadTaxConfig อ่าน VAT_RATE (เปอร์เซ็นต์ ค่าเริ่มต้น 7) และ PRICES_INCLUDE_VAT (ค่าเริ่มต้น true)
+func loadTaxConfig() taxConfig {
+	cfg := taxConfig{RateBP: 700, PricesIncludeVAT: true}
+	if rate, err := strconv.ParseFloat(getEnv("VAT_RATE", "7"), 64); err == nil && rate >= 0 && rate <= 100 {
+		cfg.RateBP = int64(math.Round(rate * 100))
+	} else {
+		log.Printf("invalid VAT_RATE, using 7")
+	}
+	if include, err := strconv.ParseBool(getEnv("PRICES_INCLUDE_VAT", "true")); err == nil {
+		cfg.PricesIncludeVAT = include
+	} else {
+		log.Printf("invalid PRICES_INCLUDE_VAT, using true")
+	}
+	return cfg
+}
+
+// RatePercent คืนอัตรา VAT เป็นเปอร์เซ็นต์ เช่น 7
+func (t taxConfig) RatePercent() float64 {
+	return float64(t.RateBP) / 100
+}
+
+// breakdown splits amount into the value before VAT, the VAT and the
+// amount payable. With prices including VAT amount is what the customer
+// pays and the VAT is taken out of it; otherwise VAT is added on top.
+func (t taxConfig) breakdown(amount Money) (net, vat, gross Money) {
+	if t.PricesIncludeVAT {
+		vat = Money(math.Round(float64(amount) * float64(t.RateBP) / float64(10000+t.RateBP)))
+		return amount - vat, vat, amount
+	}
+	vat = Money(math.Round(float64(amount) * float64(t.RateBP) / 10000))
+	return amount, vat, amount + vat
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+	}{
+		{"100", 10000},
+		{"1234.5", 123450},
+		{"1234.50", 123450},
+		{".5", 50},
+		{"7.", 700},
+		{" 7.10 ", 710},
+		{"+3", 300},
+		{"0", 0},
+		// ทศนิยมตำแหน่งที่สามปัดครึ่งขึ้น (ห่างจากศูนย์) ตำแหน่งถัดไปไม่สนใจ
+		{"1.004", 100},
+		{"1.005", 101},
+		{"1.0049", 100},
+		{"1.999", 200},
+		{"0.995", 100},
+		{"-0.25", -25},
+		{"-1.004", -100},
+		{"-1.005", -101},
+		{"-1234.56", -123456},
+	}
+	for _, tt := range tests {
+		got, err := parseMoney(tt.in)
+		if err != nil {
+			t.Errorf("parseMoney(%q) error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseMoney(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "-", ".", "abc", "1.2.3", "1,000", "1e3", "--1", "12a"} {
+		if got, err := parseMoney(in); err == nil {
+			t.Errorf("parseMoney(%q) = %d, want error", in, got)
+		}
+	}
+}
+
+func TestMoneyStringAndFormat(t *testing.T) {
+	tests := []struct {
+		in     Money
+		str    string
+		format string
+	}{
+		{0, "0.00", "0.00"},
+		{5, "0.05", "0.05"},
+		{99999, "999.99", "999.99"},
+		{100000, "1000.00", "1,000.00"},
+		{123450, "1234.50", "1,234.50"},
+		{12345678, "123456.78", "123,456.78"},
+		{100000000, "1000000.00", "1,000,000.00"},
+		{-5, "-0.05", "-0.05"},
+		{-123456789, "-1234567.89", "-1,234,567.89"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.str {
+			t.Errorf("Money(%d).String() = %q, want %q", tt.in, got, tt.str)
+		}
+		if got := tt.in.Format(); got != tt.format {
+			t.Errorf("Money(%d).Format() = %q, want %q", tt.in, got, tt.format)
+		}
+	}
+}
+
+func TestMoneyPercent(t *testing.T) {
+	tests := []struct {
+		in      Money
+		percent float64
+		want    Money
+	}{
+		{10000, 7, 700},
+		{5555, 10, 556}, // 555.5 ปัดขึ้น
+		{-5555, 10, -556},
+		{1, 49, 0},
+		{1, 50, 1},
+	}
+	for _, tt := range tests {
+		if got := tt.in.Percent(tt.percent); got != tt.want {
+			t.Errorf("Money(%d).Percent(%v) = %d, want %d", tt.in, tt.percent, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	var v struct {
+		Amount Money `json:"amount"`
+	}
+	if err := json.Unmarshal([]byte(`{"amount": 12.345}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Amount != 1235 {
+		t.Errorf("unmarshal 12.345 = %d, want 1235", v.Amount)
+	}
+	if err := json.Unmarshal([]byte(`{"amount": "-0.10"}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Amount != -10 {
+		t.Errorf(`unmarshal "-0.10" = %d, want -10`, v.Amount)
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{"amount":-0.10}` {
+		t.Errorf("marshal = %s, want {\"amount\":-0.10}", out)
+	}
+
+	// ค่าที่ไม่ใช่จำนวนเงินเป็น type error (422) เหมือน float64 ไม่ใช่ 400
+	// ชื่อ field เติมโดย decoder ของ encoding/json v1 ส่วน GOEXPERIMENT=jsonv2 ไม่เติมให้ error จาก UnmarshalJSON
+	var book Book
+	err = json.Unmarshal([]byte(`{"title": "Go", "price": "cheap"}`), &book)
+	fields, ok := fieldErrors(err)
+	if !ok || len(fields) != 1 || fields[0].Code != "type" || fields[0].Field != "" && fields[0].Field != "price" {
+		t.Errorf("unmarshal bad price: fields = %+v, ok = %v (err %v)", fields, ok, err)
+	}
+}
+
+func TestTaxBreakdown(t *testing.T) {
+	inclusive := taxConfig{RateBP: 700, PricesIncludeVAT: true}
+	exclusive := taxConfig{RateBP: 700, PricesIncludeVAT: false}
+
+	tests := []struct {
+		name            string
+		tax             taxConfig
+		amount          Money
+		net, vat, gross Money
+	}{
+		{"inclusive 107.00", inclusive, 10700, 10000, 700, 10700},
+		{"inclusive 1.00", inclusive, 100, 93, 7, 100},
+		{"inclusive 99.99", inclusive, 9999, 9345, 654, 9999},
+		{"inclusive zero", inclusive, 0, 0, 0, 0},
+		{"inclusive credit", inclusive, -10700, -10000, -700, -10700},
+		{"exclusive 100.00", exclusive, 10000, 10000, 700, 10700},
+		{"exclusive 99.99", exclusive, 9999, 9999, 700, 10699},
+		{"exclusive 0.01", exclusive, 1, 1, 0, 1},
+		{"exclusive credit", exclusive, -10000, -10000, -700, -10700},
+		{"no VAT", taxConfig{RateBP: 0, PricesIncludeVAT: true}, 10000, 10000, 0, 10000},
+	}
+	for _, tt := range tests {
+		net, vat, gross := tt.tax.breakdown(tt.amount)
+		if net != tt.net || vat != tt.vat || gross != tt.gross {
+			t.Errorf("%s: breakdown(%d) = %d, %d, %d, want %d, %d, %d",
+				tt.name, tt.amount, net, vat, gross, tt.net, tt.vat, tt.gross)
+		}
+	}
+
+	// ไม่ว่ายอดเท่าไร net + vat ต้องเท่ากับ gross พอดี ไม่มีเศษสตางค์หาย
+	for _, tax := range []taxConfig{inclusive, exclusive} {
+		for amount := Money(-2000); amount <= 20000; amount++ {
+			net, vat, gross := tax.breakdown(amount)
+			if net+vat != gross {
+				t.Fatalf("include=%v breakdown(%d): %d + %d != %d", tax.PricesIncludeVAT, amount, net, vat, gross)
+			}
+			if tax.PricesIncludeVAT && gross != amount || !tax.PricesIncludeVAT && net != amount {
+				t.Fatalf("include=%v breakdown(%d) changed the amount: net %d gross %d", tax.PricesIncludeVAT, amount, net, gross)
+			}
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// ===================== Notifier =====================
+// notificationMessage คือข้อความหนึ่งฉบับที่ส่งถึง user หนึ่งคน
+type notificationMessage struct {
+	To       string // email
+	Username string
+	Subject  string
+	Body     string // plain text
+}
+
+// notifier is implemented by each delivery channel. Send returns an error
+// when the message should be retried later.
+type notifier interface {
+	Name() string
+	Send(ctx context.Context, msg notificationMessage) error
+}
+
+var errNoRecipient = errors.New("user has no email address")
+
+// newNotifier เลือกช่องทางจาก NOTIFIER: log (ค่าเริ่มต้น) หรือ smtp
+func newNotifier() (notifier, error) {
+	switch kind := getEnv("NOTIFIER", "log"); kind {
+	case "log":
+		return logNotifier{}, nil
+	case "smtp":
+		return newSMTPNotifier()
+	default:
+		return nil, fmt.Errorf("unknown NOTIFIER %q", kind)
+	}
+}
+
+// logNotifier เขียนข้อความลง log แทนการส่งจริง ใช้ตอนพัฒนา
+type logNotifier struct{}
+
+func (logNotifier) Name() string {
+	return "log"
+}
+
+func (logNotifier) Send(ctx context.Context, msg notificationMessage) error {
+	log.Printf("notification to %s <%s>: %s\n%s", msg.Username, msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// smtpNotifier ส่งอีเมลผ่าน SMTP server ใช้กับ test server ในเครื่องอย่าง MailHog
+// หรือ Mailpit (ค่าเริ่มต้น localhost:1025 ไม่มี auth) ได้เลย
+// ใช้ STARTTLS เมื่อ server รองรับ และ login เมื่อตั้ง SMTP_USERNAME
+type smtpNotifier struct {
+	host string
+	addr string
+	from mail.Address
+	auth smtp.Auth
+}
+
+func newSMTPNotifier() (*smtpNotifier, error) {
+	host := getEnv("SMTP_HOST", "localhost")
+	from, err := mail.ParseAddress(getEnv("SMTP_FROM", "Bookstore <no-reply@bookstore.local>"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP_FROM: %w", err)
+	}
+	n := &smtpNotifier{
+		host: host,
+		addr: net.JoinHostPort(host, getEnv("SMTP_PORT", "1025")),
+		from: *from,
+	}
+	if username := getEnv("SMTP_USERNAME", ""); username != "" {
+		// PlainAuth ไม่ยอมส่งรหัสผ่านถ้าไม่ได้เข้ารหัส ยกเว้น server อยู่ที่ localhost
+		n.auth = smtp.PlainAuth("", username, getEnv("SMTP_PASSWORD", ""), host)
+	}
+	return n, nil
+}
+
+func (n *smtpNotifier) Name() string {
+	return "smtp"
+}
+
+func (n *smtpNotifier) Send(ctx context.Context, msg notificationMessage) error {
+	if msg.To == "" {
+		return errNoRecipient
+	}
+	conn, err := (&net.Dialer{Timeout: 10 * time.Second}).DialContext(ctx, "tcp", n.addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: n.host}); err != nil {
+			return err
+		}
+	}
+	if n.auth != nil {
+		if err := client.Auth(n.auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(n.from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(n.compose(msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// compose สร้างอีเมลแบบ text/plain UTF-8 หัวข้อภาษาไทยถูก encode ตาม RFC 2047
+func (n *smtpNotifier) compose(msg notificationMessage) []byte {
+	to := mail.Address{Name: msg.Username, Address: msg.To}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", n.from.String())
+	fmt.Fprintf(&b, "To: %s\r\n", to.String())
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Message-ID: <%s@%s>\r\n", randomID("msg."), n.from.Address[strings.LastIndex(n.from.Address, "@")+1:])
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(&b)
+	qp.Write([]byte(strings.ReplaceAll(msg.Body, "\n", "\r\n")))
+	qp.Close()
+	return b.Bytes()
+}
@@ -0,0 +1,869 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===================== Order Models =====================
+type Order struct {
+	ID                 int                 `json:"id"`
+	UserID             *int                `json:"user_id,omitempty"`
+	Username           string              `json:"username,omitempty"`
+	Status             string              `json:"status"`
+	ItemCount          int                 `json:"item_count"`
+	Subtotal           Money               `json:"subtotal"`
+	Discount           Money               `json:"discount"` // ส่วนลดจากโปรโมชัน
+	VATRate            float64             `json:"vat_rate"` // อัตรา VAT ตอนสั่งซื้อ (เปอร์เซ็นต์)
+	VAT                Money               `json:"vat"`
+	PricesIncludeVAT   bool                `json:"prices_include_vat"`
+	Total              Money               `json:"total"`           // ยอดที่ต้องจ่าย
+	Buyer              *InvoiceParty       `json:"buyer,omitempty"` // ข้อมูลผู้ซื้อสำหรับใบกำกับภาษีเต็มรูป
+	Note               string              `json:"note,omitempty"`
+	AllowedTransitions []string            `json:"allowed_transitions"`
+	Items              []OrderItem         `json:"items,omitempty"`      // เฉพาะตอนดู order เดียว
+	Promotions         []AppliedPromotion  `json:"promotions,omitempty"` // เฉพาะตอนดู order เดียว
+	History            []OrderStatusChange `json:"history,omitempty"`    // เฉพาะตอนดู order เดียว
+	CreatedAt          time.Time           `json:"created_at"`
+	UpdatedAt          time.Time           `json:"updated_at"`
+}
+
+// OrderItem เป็น snapshot ตอนสั่งซื้อ book_id เป็น null ถ้าหนังสือถูกลบถาวรไปแล้ว
+type OrderItem struct {
+	BookID    *int   `json:"book_id"`
+	Title     string `json:"title"`
+	Author    string `json:"author"`
+	ISBN      string `json:"isbn,omitempty"`
+	UnitPrice Money  `json:"unit_price"`
+	Quantity  int    `json:"quantity"`
+	LineTotal Money  `json:"line_total"` // ก่อนหักโปรโมชัน
+	Discount  Money  `json:"discount"`
+}
+
+type OrderStatusChange struct {
+	From      string    `json:"from,omitempty"` // ว่างตอนสร้าง order
+	To        string    `json:"to"`
+	Note      string    `json:"note,omitempty"`
+	UserID    *int      `json:"user_id,omitempty"`
+	Username  string    `json:"username,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OrderItemRequest struct {
+	BookID   int `json:"book_id" binding:"required,gt=0"`
+	Quantity int `json:"quantity" binding:"required,min=1,max=99"`
+}
+
+type OrderRequest struct {
+	Items       []OrderItemRequest `json:"items" binding:"max=100,dive"` // ไม่ส่ง = checkout ทุกอย่างใน cart
+	CouponCodes []string           `json:"coupon_codes" binding:"max=5,dive,max=50"`
+	Buyer       *InvoiceParty      `json:"buyer"` // ไม่ส่ง = ออกใบกำกับภาษีอย่างย่อ
+	Note        string             `json:"note" binding:"max=1000"`
+}
+
+type OrderStatusRequest struct {
+	Status string `json:"status" binding:"required,oneof=pending paid shipped delivered cancelled refunded"`
+	Note   string `json:"note" binding:"max=500"`
+}
+
+type OrderPage struct {
+	Items      []Order `json:"items"`
+	NextBefore int     `json:"next_before,omitempty"` // ส่งเป็น ?before= เพื่อดูหน้าถัดไป
+}
+
+// ===================== Order State Machine =====================
+// cancelled = ยกเลิกก่อนจ่ายเงิน, refunded = คืนเงินหลังจ่ายแล้ว ทั้งสองสถานะเป็นสถานะสุดท้าย
+var orderTransitions = map[string][]string{
+	"pending":   {"paid", "cancelled"},
+	"paid":      {"shipped", "refunded"},
+	"shipped":   {"delivered"},
+	"delivered": {"refunded"},
+}
+
+var orderStatuses = []string{"pending", "paid", "shipped", "delivered", "cancelled", "refunded"}
+
+func isOrderStatus(s string) bool {
+	for _, status := range orderStatuses {
+		if status == s {
+			return true
+		}
+	}
+	return false
+}
+
+func allowedTransitions(from string) []string {
+	if next, ok := orderTransitions[from]; ok {
+		return next
+	}
+	return []string{}
+}
+
+func canTransition(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// restocksOnTransition บอกว่าการเปลี่ยน status นี้ต้องคืนของเข้าสต็อกหรือไม่
+// ของที่ส่งออกไปแล้ว (refund หลัง delivered) ให้รับคืนผ่าน inventory เองเมื่อได้ของกลับมา
+func restocksOnTransition(from, to string) bool {
+	return to == "cancelled" || (to == "refunded" && from == "paid")
+}
+
+// orderTransitionError is returned when the requested status can't be
+// reached from the order's current status.
+type orderTransitionError struct {
+	From string
+	To   string
+}
+
+func (e *orderTransitionError) Error() string {
+	return fmt.Sprintf("cannot change order status from %s to %s", e.From, e.To)
+}
+
+// errOrderNotPaid is returned when an order with something to pay would
+// become paid without a succeeded payment. Only the payment gateway flow
+// (or a zero total) may mark an order paid, since paid issues the invoice.
+var errOrderNotPaid = errors.New("order has no succeeded payment, only orders with a zero total can be marked paid by hand")
+
+// errOrderNotRefunded is the same guard for refunded: money goes back only
+// through POST /staff/payments/:id/refund, which moves the order itself.
+var errOrderNotRefunded = errors.New("order has no refunded payment, refund it with POST /staff/payments/:id/refund")
+
+// errPaymentAuthorized is returned when cancelling an order whose payment
+// is authorized but not captured yet. A later capture would charge the
+// customer for a cancelled order, so the payment has to be settled first.
+var errPaymentAuthorized = errors.New("order has an authorized payment, capture and refund it before cancelling")
+
+// paymentGuards คือสถานะ payment ที่ต้องมีก่อน order จะเปลี่ยนเป็นสถานะนั้นได้ (ยกเว้นยอดเป็นศูนย์)
+var paymentGuards = map[string]struct {
+	paymentStatus string
+	err           error
+}{
+	"paid":     {"succeeded", errOrderNotPaid},
+	"refunded": {"refunded", errOrderNotRefunded},
+}
+
+// unavailableBookError is returned by placeOrder for a book that doesn't
+// exist or is in the trash.
+type unavailableBookError struct {
+	BookID int
+}
+
+func (e *unavailableBookError) Error() string {
+	return fmt.Sprintf("book %d is not available", e.BookID)
+}
+
+// couponRejectedError is returned by placeOrder when a coupon code the
+// customer entered can't be applied, so they aren't charged without it.
+type couponRejectedError struct {
+	Rejected []RejectedCode
+}
+
+func (e *couponRejectedError) Error() string {
+	return "coupon code cannot be applied: " + e.Rejected[0].Code + " (" + e.Rejected[0].Reason + ")"
+}
+
+// promotionUsedUpError is returned by placeOrder when an automatic
+// promotion the order was priced with reached its usage limit in a
+// concurrent order. Placing the order again prices it without.
+type promotionUsedUpError struct {
+	PromotionID int
+}
+
+func (e *promotionUsedUpError) Error() string {
+	return fmt.Sprintf("promotion %d has just reached its usage limit, place the order again for the new price", e.PromotionID)
+}
+
+// checkoutLock คือ class ของ advisory lock ต่อ user ให้ order ของคนเดียวกันวางทีละใบ
+// per_user_limit จึงนับได้ถูกแม้กดสั่งซ้อนกัน order ของคนละคนไม่รอกัน
+const checkoutLock = 130020
+
+// errEmptyOrder is returned when an order has no items and the cart is empty.
+var errEmptyOrder = errors.New("order has no items")
+
+func orderReference(orderID int) string {
+	return "order:" + strconv.Itoa(orderID)
+}
+
+// ===================== Order Processing =====================
+// mergeOrderLines รวมหนังสือเล่มเดียวกันเป็นบรรทัดเดียว และเรียงตาม book_id
+// ให้ทุก transaction ล็อกแถว inventory ในลำดับเดียวกัน กัน deadlock
+func mergeOrderLines(lines []OrderItemRequest) []OrderItemRequest {
+	byBook := map[int]int{}
+	for _, line := range lines {
+		byBook[line.BookID] += line.Quantity
+	}
+	merged := make([]OrderItemRequest, 0, len(byBook))
+	for bookID, quantity := range byBook {
+		merged = append(merged, OrderItemRequest{BookID: bookID, Quantity: quantity})
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].BookID < merged[j].BookID })
+	return merged
+}
+
+// placeOrder creates a pending order inside tx: it snapshots each book's
+// current price, prices the order with running promotions and codes,
+// takes the stock with "sell" movements and records the first status
+// change. VAT is worked out with the current tax settings and kept on
+// the order. It returns the movements so the caller can audit them after
+// commit.
+func placeOrder(tx *sql.Tx, userID int, lines []OrderItemRequest, codes []string, buyer *InvoiceParty, note string) (int, []StockMovement, error) {
+	items, quoteLines, err := loadOrderLines(tx, lines)
+	if err != nil {
+		return 0, nil, err
+	}
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1, $2)", checkoutLock, userID); err != nil {
+		return 0, nil, err
+	}
+	promos, usage, err := loadPromotions(tx, codes, userID)
+	if err != nil {
+		return 0, nil, err
+	}
+	tax := loadTaxConfig()
+	quote := applyVAT(priceQuote(quoteLines, promos, codes, usage, time.Now()), tax)
+	if len(quote.Rejected) > 0 {
+		return 0, nil, &couponRejectedError{Rejected: quote.Rejected}
+	}
+	if buyer == nil {
+		buyer = &InvoiceParty{}
+	} else if buyer.Branch == "" {
+		buyer = &InvoiceParty{Name: buyer.Name, TaxID: buyer.TaxID, Branch: headOfficeBranch, Address: buyer.Address}
+	}
+
+	itemCount := 0
+	for i := range items {
+		items[i].LineTotal = quote.Lines[i].LineTotal
+		items[i].Discount = quote.Lines[i].Discount
+		itemCount += items[i].Quantity
+	}
+
+	var orderID int
+	err = tx.QueryRow(`
+		INSERT INTO orders (user_id, status, item_count, subtotal, discount, vat_rate, vat_amount, prices_include_vat, total,
+		                    buyer_name, buyer_tax_id, buyer_branch, buyer_address, note)
+		VALUES ($1, 'pending', $2, $3, $4, $5, $6, $7, $8,
+		        NULLIF($9, ''), NULLIF($10, ''), NULLIF($11, ''), NULLIF($12, ''), NULLIF($13, ''))
+		RETURNING id
+	`, userID, itemCount, quote.Subtotal, quote.Discount, quote.VATRate, quote.VAT, quote.PricesIncludeVAT, quote.Total,
+		buyer.Name, buyer.TaxID, buyer.Branch, buyer.Address, note).Scan(&orderID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var movements []StockMovement
+	for i, item := range items {
+		_, err := tx.Exec(`
+			INSERT INTO order_items (order_id, book_id, title, author, isbn, unit_price, quantity, line_total, discount, position)
+			VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, $10)
+		`, orderID, *item.BookID, item.Title, item.Author, item.ISBN, item.UnitPrice, item.Quantity, item.LineTotal, item.Discount, i+1)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		m, err := recordStockMovement(tx, userID, *item.BookID, "sell", -item.Quantity, "", orderReference(orderID))
+		if err == sql.ErrNoRows {
+			return 0, nil, &unavailableBookError{BookID: *item.BookID}
+		} else if err != nil {
+			return 0, nil, err
+		}
+		movements = append(movements, m)
+	}
+
+	for _, applied := range quote.Applied {
+		_, err := tx.Exec(`
+			INSERT INTO promotion_redemptions (promotion_id, order_id, user_id, discount)
+			VALUES ($1, $2, $3, $4)
+		`, applied.PromotionID, orderID, userID, applied.Discount)
+		if err != nil {
+			return 0, nil, err
+		}
+		// ล็อกเฉพาะโปรโมชันที่ใช้จริง และเช็ค usage_limit อีกครั้งกัน order ที่วางพร้อมกันใช้เกิน
+		res, err := tx.Exec(`
+			UPDATE promotions SET times_used = times_used + 1
+			WHERE id = $1 AND (usage_limit IS NULL OR times_used < usage_limit)
+		`, applied.PromotionID)
+		if err != nil {
+			return 0, nil, err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return 0, nil, err
+		} else if n == 0 {
+			if applied.Code != "" {
+				return 0, nil, &couponRejectedError{Rejected: []RejectedCode{{Code: applied.Code, Reason: "usage_limit_reached"}}}
+			}
+			return 0, nil, &promotionUsedUpError{PromotionID: applied.PromotionID}
+		}
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO order_status_history (order_id, from_status, to_status, user_id)
+		VALUES ($1, NULL, 'pending', $2)
+	`, orderID, userID)
+	return orderID, movements, err
+}
+
+// transitionOrder moves the order to status inside tx and returns the old
+// status. ownerID limits the change to that user's orders (0 = any order).
+// Cancelling, or refunding an order that hasn't shipped, puts the books
+// back in stock with "return" movements; books already in the trash are
+// skipped. Cancelling also gives the promotions it used back to their
+// usage limits, and is refused while a payment is authorized
+// (errPaymentAuthorized). Becoming paid or refunded needs a payment in the
+// matching status unless the total is zero (see paymentGuards). Becoming
+// paid issues the tax invoice.
+func transitionOrder(tx *sql.Tx, userID, ownerID, orderID int, status, note string) (string, []StockMovement, error) {
+	var from string
+	var total Money
+	err := tx.QueryRow(`
+		SELECT status, total FROM orders
+		WHERE id = $1 AND ($2 = 0 OR user_id = $2)
+		FOR UPDATE
+	`, orderID, ownerID).Scan(&from, &total)
+	if err != nil {
+		return "", nil, err
+	}
+	if !canTransition(from, status) {
+		return from, nil, &orderTransitionError{From: from, To: status}
+	}
+
+	if status == "cancelled" {
+		var authorized bool
+		err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM payments WHERE order_id = $1 AND status = 'requires_capture')", orderID).Scan(&authorized)
+		if err != nil {
+			return from, nil, err
+		}
+		if authorized {
+			return from, nil, errPaymentAuthorized
+		}
+	}
+
+	if guard, ok := paymentGuards[status]; ok && total != 0 {
+		// ทาง payment gateway อัปเดต payment ใน transaction เดียวกันก่อนเรียกมาถึงนี่
+		var found bool
+		err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM payments WHERE order_id = $1 AND status = $2)", orderID, guard.paymentStatus).Scan(&found)
+		if err != nil {
+			return from, nil, err
+		}
+		if !found {
+			return from, nil, guard.err
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE orders SET status = $2, updated_at = NOW() WHERE id = $1", orderID, status); err != nil {
+		return from, nil, err
+	}
+	var user interface{}
+	if userID != 0 {
+		user = userID
+	}
+	_, err = tx.Exec(`
+		INSERT INTO order_status_history (order_id, from_status, to_status, note, user_id)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+	`, orderID, from, status, note, user)
+	if err != nil {
+		return from, nil, err
+	}
+
+	if status == "paid" {
+		if err := issueInvoice(tx, orderID); err != nil {
+			return from, nil, err
+		}
+	}
+
+	if status == "cancelled" {
+		_, err := tx.Exec(`
+			UPDATE promotions p SET times_used = times_used - 1
+			FROM promotion_redemptions r
+			WHERE r.promotion_id = p.id AND r.order_id = $1
+		`, orderID)
+		if err != nil {
+			return from, nil, err
+		}
+	}
+
+	if !restocksOnTransition(from, status) {
+		return from, nil, nil
+	}
+
+	rows, err := tx.Query(`
+		SELECT oi.book_id, oi.quantity
+		FROM order_items oi
+		JOIN books b ON b.id = oi.book_id AND b.deleted_at IS NULL
+		WHERE oi.order_id = $1
+		ORDER BY oi.book_id
+	`, orderID)
+	if err != nil {
+		return from, nil, err
+	}
+	var lines []OrderItemRequest
+	for rows.Next() {
+		var line OrderItemRequest
+		if err := rows.Scan(&line.BookID, &line.Quantity); err != nil {
+			rows.Close()
+			return from, nil, err
+		}
+		lines = append(lines, line)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return from, nil, err
+	}
+
+	var movements []StockMovement
+	for _, line := range lines {
+		m, err := recordStockMovement(tx, userID, line.BookID, "return", line.Quantity, "order "+status, orderReference(orderID))
+		if err != nil {
+			return from, nil, err
+		}
+		movements = append(movements, m)
+	}
+	return from, movements, nil
+}
+
+const orderSelect = `
+	SELECT o.id, o.user_id, COALESCE(u.username, ''), o.status, o.item_count, o.subtotal, o.discount,
+	       o.vat_rate, o.vat_amount, o.prices_include_vat, o.total,
+	       COALESCE(o.buyer_name, ''), COALESCE(o.buyer_tax_id, ''), COALESCE(o.buyer_branch, ''), COALESCE(o.buyer_address, ''),
+	       COALESCE(o.note, ''), o.created_at, o.updated_at
+	FROM orders o
+	LEFT JOIN users u ON u.id = o.user_id`
+
+func scanOrder(row interface{ Scan(...interface{}) error }) (Order, error) {
+	var o Order
+	var buyer InvoiceParty
+	err := row.Scan(&o.ID, &o.UserID, &o.Username, &o.Status, &o.ItemCount, &o.Subtotal, &o.Discount,
+		&o.VATRate, &o.VAT, &o.PricesIncludeVAT, &o.Total,
+		&buyer.Name, &buyer.TaxID, &buyer.Branch, &buyer.Address,
+		&o.Note, &o.CreatedAt, &o.UpdatedAt)
+	if buyer.Name != "" {
+		o.Buyer = &buyer
+	}
+	o.AllowedTransitions = allowedTransitions(o.Status)
+	return o, err
+}
+
+func loadOrderItems(q queryer, orderID int) ([]OrderItem, error) {
+	rows, err := q.Query(`
+		SELECT book_id, title, author, COALESCE(isbn, ''), unit_price, quantity, line_total, discount
+		FROM order_items WHERE order_id = $1 ORDER BY position
+	`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []OrderItem{}
+	for rows.Next() {
+		var item OrderItem
+		if err := rows.Scan(&item.BookID, &item.Title, &item.Author, &item.ISBN,
+			&item.UnitPrice, &item.Quantity, &item.LineTotal, &item.Discount); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// loadOrder อ่าน order พร้อมรายการหนังสือและประวัติ status ownerID = 0 คือ order ของใครก็ได้
+func loadOrder(orderID, ownerID int) (Order, error) {
+	o, err := scanOrder(db.QueryRow(orderSelect+" WHERE o.id = $1 AND ($2 = 0 OR o.user_id = $2)", orderID, ownerID))
+	if err != nil {
+		return o, err
+	}
+
+	if o.Items, err = loadOrderItems(db, orderID); err != nil {
+		return o, err
+	}
+
+	promos, err := db.Query(`
+		SELECT r.promotion_id, p.name, COALESCE(p.code, ''), r.discount
+		FROM promotion_redemptions r
+		JOIN promotions p ON p.id = r.promotion_id
+		WHERE r.order_id = $1
+		ORDER BY r.created_at, r.promotion_id
+	`, orderID)
+	if err != nil {
+		return o, err
+	}
+	defer promos.Close()
+	for promos.Next() {
+		var applied AppliedPromotion
+		if err := promos.Scan(&applied.PromotionID, &applied.Name, &applied.Code, &applied.Discount); err != nil {
+			return o, err
+		}
+		o.Promotions = append(o.Promotions, applied)
+	}
+	if err := promos.Err(); err != nil {
+		return o, err
+	}
+
+	history, err := db.Query(`
+		SELECT COALESCE(h.from_status, ''), h.to_status, COALESCE(h.note, ''), h.user_id, COALESCE(u.username, ''), h.created_at
+		FROM order_status_history h
+		LEFT JOIN users u ON u.id = h.user_id
+		WHERE h.order_id = $1
+		ORDER BY h.id
+	`, orderID)
+	if err != nil {
+		return o, err
+	}
+	defer history.Close()
+	for history.Next() {
+		var h OrderStatusChange
+		if err := history.Scan(&h.From, &h.To, &h.Note, &h.UserID, &h.Username, &h.CreatedAt); err != nil {
+			return o, err
+		}
+		o.History = append(o.History, h)
+	}
+	return o, history.Err()
+}
+
+func parseOrderID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return 0, false
+	}
+	return id, true
+}
+
+func respondOrder(c *gin.Context, status, orderID, ownerID int) {
+	order, err := loadOrder(orderID, ownerID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(status, order)
+}
+
+// respondOrderPage ตอบรายการ order แบบแบ่งหน้า ownerID = 0 คือทุก user (ใช้ ?user_id= กรองได้)
+func respondOrderPage(c *gin.Context, ownerID int) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+		return
+	}
+	before, err := strconv.Atoi(c.DefaultQuery("before", "0"))
+	if err != nil || before < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "before must be an order id"})
+		return
+	}
+	status := c.Query("status")
+	if status != "" && !isOrderStatus(status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown status: " + status})
+		return
+	}
+	if ownerID == 0 && c.Query("user_id") != "" {
+		ownerID, err = strconv.Atoi(c.Query("user_id"))
+		if err != nil || ownerID < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user_id must be a user id"})
+			return
+		}
+	}
+
+	rows, err := db.Query(orderSelect+`
+		WHERE ($1 = 0 OR o.user_id = $1)
+		  AND ($2 = '' OR o.status = $2)
+		  AND ($3 = 0 OR o.id < $3)
+		ORDER BY o.id DESC
+		LIMIT $4
+	`, ownerID, status, before, limit+1)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	page := OrderPage{Items: []Order{}}
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		page.Items = append(page.Items, o)
+	}
+
+	if len(page.Items) > limit {
+		page.Items = page.Items[:limit]
+		page.NextBefore = page.Items[limit-1].ID
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// changeOrderStatus ใช้ร่วมกันระหว่างลูกค้ายกเลิก order ตัวเองกับ staff เปลี่ยน status
+func changeOrderStatus(c *gin.Context, ownerID, orderID int, status, note string) {
+	userID := c.GetInt("user_id")
+	var from string
+	var movements []StockMovement
+	err := withActingUser(userID, func(tx *sql.Tx) error {
+		var err error
+		from, movements, err = transitionOrder(tx, userID, ownerID, orderID, status, note)
+		return err
+	})
+
+	var transitionErr *orderTransitionError
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	} else if errors.As(err, &transitionErr) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":               transitionErr.Error(),
+			"status":              transitionErr.From,
+			"allowed_transitions": allowedTransitions(transitionErr.From),
+		})
+		return
+	} else if err == errOrderNotPaid || err == errOrderNotRefunded || err == errPaymentAuthorized {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "status": from})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	logAudit(userID, "update_status", "orders", orderID, gin.H{
+		"from": from,
+		"to":   status,
+		"note": note,
+	}, c)
+	for _, m := range movements {
+		logStockMovement(userID, m, c)
+	}
+
+	respondOrder(c, http.StatusOK, orderID, ownerID)
+}
+
+// ===================== Customer Order Handlers =====================
+// @Summary Place an order
+// @Description Creates a pending order from items, or from the whole cart when items is empty (ordered lines are then removed from the cart). Prices are snapshotted, promotions and coupon codes applied and stock is taken in one transaction. A coupon code that can't be applied fails the order with 422; an automatic promotion that reaches its usage limit meanwhile fails it with 409, and placing it again prices it without.
+// @Tags Orders
+// @Accept json
+// @Produce json
+// @Param order body OrderRequest true "Items and note"
+// @Success 201 {object} Order
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} ValidationErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /orders [post]
+// @security ApiKeyAuth
+func createOrder(c *gin.Context) {
+	var req OrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	var cartID int
+	if len(req.Items) == 0 {
+		var err error
+		cartID, _, err = resolveCart(c, false)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var orderID int
+	var movements []StockMovement
+	err := withActingUser(userID, func(tx *sql.Tx) error {
+		lines := req.Items
+		if len(lines) == 0 && cartID != 0 {
+			var err error
+			if lines, err = cartOrderLines(tx, cartID, true); err != nil {
+				return err
+			}
+		}
+		if len(lines) == 0 {
+			return errEmptyOrder
+		}
+
+		var err error
+		orderID, movements, err = placeOrder(tx, userID, lines, req.CouponCodes, req.Buyer, req.Note)
+		if err != nil {
+			return err
+		}
+
+		if len(req.Items) == 0 {
+			for _, line := range lines {
+				if _, err := tx.Exec("DELETE FROM cart_items WHERE cart_id = $1 AND book_id = $2", cartID, line.BookID); err != nil {
+					return err
+				}
+			}
+			return touchCart(tx, cartID)
+		}
+		return nil
+	})
+
+	var bookErr *unavailableBookError
+	var stockErr *insufficientStockError
+	var couponErr *couponRejectedError
+	var usedUpErr *promotionUsedUpError
+	if err == errEmptyOrder {
+		c.JSON(http.StatusUnprocessableEntity, ValidationErrorResponse{Error: "validation failed", Fields: []FieldError{{
+			Field: "items", Code: "required", Message: "is required when the cart is empty",
+		}}})
+		return
+	} else if errors.As(err, &bookErr) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": bookErr.Error(), "book_id": bookErr.BookID})
+		return
+	} else if errors.As(err, &couponErr) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "coupon code cannot be applied", "rejected": couponErr.Rejected})
+		return
+	} else if errors.As(err, &usedUpErr) {
+		c.JSON(http.StatusConflict, gin.H{"error": usedUpErr.Error(), "promotion_id": usedUpErr.PromotionID})
+		return
+	} else if errors.As(err, &stockErr) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":     "insufficient stock",
+			"book_id":   stockErr.BookID,
+			"available": stockErr.Available,
+			"requested": stockErr.Requested,
+		})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	logAudit(userID, "create", "orders", orderID, gin.H{
+		"from_cart":    len(req.Items) == 0,
+		"lines":        len(movements),
+		"coupon_codes": req.CouponCodes,
+	}, c)
+	for _, m := range movements {
+		logStockMovement(userID, m, c)
+	}
+
+	respondOrder(c, http.StatusCreated, orderID, userID)
+}
+
+// @Summary List my orders
+// @Description Newest first
+// @Tags Orders
+// @Produce json
+// @Param status query string false "Filter by status"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param before query int false "next_before from the previous page"
+// @Success 200 {object} OrderPage
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /orders [get]
+// @security ApiKeyAuth
+func listMyOrders(c *gin.Context) {
+	respondOrderPage(c, c.GetInt("user_id"))
+}
+
+// @Summary Get my order
+// @Tags Orders
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {object} Order
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /orders/{id} [get]
+// @security ApiKeyAuth
+func getMyOrder(c *gin.Context) {
+	orderID, ok := parseOrderID(c)
+	if !ok {
+		return
+	}
+	respondOrder(c, http.StatusOK, orderID, c.GetInt("user_id"))
+}
+
+// @Summary Cancel my order
+// @Description Only pending (unpaid) orders can be cancelled; the books go back in stock. An order whose payment is authorized but not captured can't be cancelled (409).
+// @Tags Orders
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {object} Order
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /orders/{id}/cancel [post]
+// @security ApiKeyAuth
+func cancelMyOrder(c *gin.Context) {
+	orderID, ok := parseOrderID(c)
+	if !ok {
+		return
+	}
+	changeOrderStatus(c, c.GetInt("user_id"), orderID, "cancelled", "cancelled by customer")
+}
+
+// ===================== Staff Order Handlers =====================
+// @Summary List all orders
+// @Description Newest first
+// @Tags Orders
+// @Produce json
+// @Param status query string false "Filter by status"
+// @Param user_id query int false "Filter by customer"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param before query int false "next_before from the previous page"
+// @Success 200 {object} OrderPage
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /staff/orders [get]
+// @security ApiKeyAuth
+func listAllOrders(c *gin.Context) {
+	respondOrderPage(c, 0)
+}
+
+// @Summary Get any order
+// @Tags Orders
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {object} Order
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /staff/orders/{id} [get]
+// @security ApiKeyAuth
+func getAnyOrder(c *gin.Context) {
+	orderID, ok := parseOrderID(c)
+	if !ok {
+		return
+	}
+	respondOrder(c, http.StatusOK, orderID, 0)
+}
+
+// @Summary Change order status
+// @Description pending → paid → shipped → delivered; pending → cancelled; paid or delivered → refunded. Illegal transitions return 409 with the allowed ones. Marking an order paid or refunded needs a succeeded or refunded payment unless its total is zero (409 otherwise), so real refunds go through POST /staff/payments/{id}/refund.
+// @Tags Orders
+// @Accept json
+// @Produce json
+// @Param id path int true "Order ID"
+// @Param status body OrderStatusRequest true "New status"
+// @Success 200 {object} Order
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} ValidationErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /staff/orders/{id}/status [put]
+// @security ApiKeyAuth
+func updateOrderStatus(c *gin.Context) {
+	orderID, ok := parseOrderID(c)
+	if !ok {
+		return
+	}
+	var req OrderStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	changeOrderStatus(c, 0, orderID, req.Status, req.Note)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOrderTransitions(t *testing.T) {
+	for from, next := range orderTransitions {
+		if !isOrderStatus(from) {
+			t.Errorf("orderTransitions has unknown status %q", from)
+		}
+		for _, to := range next {
+			if !isOrderStatus(to) {
+				t.Errorf("orderTransitions[%q] has unknown status %q", from, to)
+			}
+			if to == from {
+				t.Errorf("orderTransitions[%q] loops back to itself", from)
+			}
+		}
+	}
+
+	// cancelled กับ refunded เป็นสถานะสุดท้าย
+	for _, status := range []string{"cancelled", "refunded"} {
+		if next := allowedTransitions(status); len(next) != 0 {
+			t.Errorf("allowedTransitions(%q) = %v, want none", status, next)
+		}
+	}
+	if next := allowedTransitions("unknown"); next == nil || len(next) != 0 {
+		t.Errorf("allowedTransitions(unknown) = %#v, want empty slice", next)
+	}
+	if got, want := allowedTransitions("pending"), []string{"paid", "cancelled"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("allowedTransitions(pending) = %v, want %v", got, want)
+	}
+
+	for status := range paymentGuards {
+		if !isOrderStatus(status) {
+			t.Errorf("paymentGuards has unknown status %q", status)
+		}
+	}
+
+	for _, status := range orderStatuses {
+		if !isOrderStatus(status) {
+			t.Errorf("isOrderStatus(%q) = false", status)
+		}
+	}
+	for _, status := range []string{"", "Paid", "sending", "returned"} {
+		if isOrderStatus(status) {
+			t.Errorf("isOrderStatus(%q) = true", status)
+		}
+	}
+}
+
+func TestCanTransition(t *testing.T) {
+	allowed := map[[2]string]bool{
+		{"pending", "paid"}:       true,
+		{"pending", "cancelled"}:  true,
+		{"paid", "shipped"}:       true,
+		{"paid", "refunded"}:      true,
+		{"shipped", "delivered"}:  true,
+		{"delivered", "refunded"}: true,
+	}
+	for _, from := range orderStatuses {
+		for _, to := range orderStatuses {
+			want := allowed[[2]string{from, to}]
+			if got := canTransition(from, to); got != want {
+				t.Errorf("canTransition(%q, %q) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+	if canTransition("unknown", "paid") || canTransition("pending", "unknown") {
+		t.Error("canTransition accepted an unknown status")
+	}
+}
+
+func TestRestocksOnTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{"pending", "cancelled", true},
+		{"paid", "refunded", true},       // ยังไม่ได้ส่งของ คืนเข้าสต็อกได้ทันที
+		{"delivered", "refunded", false}, // ของอยู่กับลูกค้า รับคืนผ่าน inventory เอง
+		{"pending", "paid", false},
+		{"paid", "shipped", false},
+		{"shipped", "delivered", false},
+	}
+	for _, tt := range tests {
+		if got := restocksOnTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("restocksOnTransition(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ===================== Payment Gateway =====================
+// paymentIntent is the gateway's view of one payment. Amounts are in minor
+// units (satang) so no float rounding crosses the gateway boundary.
+type paymentIntent struct {
+	ID             string `json:"id"`
+	Amount         int64  `json:"amount"`
+	AmountRefunded int64  `json:"amount_refunded"`
+	Currency       string `json:"currency"`
+	Status         string `json:"status"` // requires_confirmation, requires_capture, succeeded, failed, refunded
+	FailureReason  string `json:"failure_reason,omitempty"`
+	Reference      string `json:"reference"` // เช่น order:12
+}
+
+// webhookEvent is a verified callback from the gateway. ID is unique per
+// event and stays the same when the gateway retries a delivery.
+type webhookEvent struct {
+	ID      string        `json:"id"`
+	Type    string        `json:"type"`
+	Created int64         `json:"created"`
+	Intent  paymentIntent `json:"data"`
+}
+
+// paymentGateway is implemented by each payment provider. Methods return
+// the intent's state after the call; the same state also arrives later
+// through the provider's webhook.
+type paymentGateway interface {
+	Name() string
+	CreateIntent(ctx context.Context, amount int64, currency, reference string) (paymentIntent, error)
+	Confirm(ctx context.Context, intentID, method string) (paymentIntent, error)
+	Capture(ctx context.Context, intentID string) (paymentIntent, error)
+	Refund(ctx context.Context, intentID string, amount int64) (paymentIntent, error)
+	VerifyWebhook(header http.Header, body []byte) (webhookEvent, error)
+}
+
+var (
+	errIntentNotFound    = errors.New("payment intent not found")
+	errUnsupportedMethod = errors.New("unsupported payment method")
+	errInvalidSignature  = errors.New("invalid webhook signature")
+	errWebhookSkewTooBig = errors.New("webhook timestamp outside tolerance")
+)
+
+// paymentStateError is returned when the intent's status doesn't allow the
+// requested operation (e.g. capturing a failed payment).
+type paymentStateError struct {
+	Status    string
+	Operation string
+}
+
+func (e *paymentStateError) Error() string {
+	return fmt.Sprintf("cannot %s a payment in status %s", e.Operation, e.Status)
+}
+
+// newPaymentGateway เลือก provider จาก PAYMENT_PROVIDER (ตอนนี้มีแค่ mock)
+func newPaymentGateway() (paymentGateway, error) {
+	switch provider := getEnv("PAYMENT_PROVIDER", "mock"); provider {
+	case "mock":
+		return newMockGateway(
+			[]byte(getEnv("PAYMENT_WEBHOOK_SECRET", "mock-webhook-secret-change-in-production")),
+			getEnv("PAYMENT_WEBHOOK_URL", "http://localhost:8080/api/v1/payments/webhooks/mock"),
+		), nil
+	default:
+		return nil, fmt.Errorf("unknown PAYMENT_PROVIDER %q", provider)
+	}
+}
+
+func randomID(prefix string) string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return prefix + hex.EncodeToString(b)
+}
+
+// ===================== Mock Gateway =====================
+// mockGateway เป็น gateway จำลองสำหรับรันในเครื่อง เก็บ intent ไว้ใน memory (หายเมื่อ restart)
+// และส่ง webhook ที่เซ็นด้วย HMAC กลับมาที่ PAYMENT_WEBHOOK_URL เหมือน provider จริง
+//
+// payment_method ตอน confirm:
+//   - mock_card (ค่าเริ่มต้น) อนุมัติ รอ capture
+//   - mock_card_declined ถูกปฏิเสธ
+//   - mock_card_insufficient_funds ถูกปฏิเสธเพราะเงินไม่พอ
+type mockGateway struct {
+	mu         sync.Mutex
+	intents    map[string]*paymentIntent
+	secret     []byte
+	webhookURL string // ว่าง = ไม่ส่ง webhook
+	client     *http.Client
+}
+
+const (
+	mockSignatureHeader  = "Mock-Signature"
+	mockWebhookTolerance = 5 * time.Minute
+)
+
+func newMockGateway(secret []byte, webhookURL string) *mockGateway {
+	return &mockGateway{
+		intents:    map[string]*paymentIntent{},
+		secret:     secret,
+		webhookURL: webhookURL,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (g *mockGateway) Name() string { return "mock" }
+
+func (g *mockGateway) CreateIntent(ctx context.Context, amount int64, currency, reference string) (paymentIntent, error) {
+	if amount <= 0 {
+		return paymentIntent{}, errors.New("amount must be positive")
+	}
+	intent := &paymentIntent{
+		ID:        randomID("mock_pi_"),
+		Amount:    amount,
+		Currency:  currency,
+		Status:    "requires_confirmation",
+		Reference: reference,
+	}
+
+	g.mu.Lock()
+	g.intents[intent.ID] = intent
+	g.mu.Unlock()
+	return *intent, nil
+}
+
+func (g *mockGateway) Confirm(ctx context.Context, intentID, method string) (paymentIntent, error) {
+	return g.update(intentID, func(intent *paymentIntent) (string, error) {
+		if intent.Status != "requires_confirmation" {
+			return "", &paymentStateError{Status: intent.Status, Operation: "confirm"}
+		}
+		switch method {
+		case "", "mock_card":
+			intent.Status = "requires_capture"
+			return "payment_intent.amount_capturable_updated", nil
+		case "mock_card_declined":
+			intent.Status = "failed"
+			intent.FailureReason = "card_declined"
+		case "mock_card_insufficient_funds":
+			intent.Status = "failed"
+			intent.FailureReason = "insufficient_funds"
+		default:
+			return "", fmt.Errorf("%w: %q", errUnsupportedMethod, method)
+		}
+		return "payment_intent.payment_failed", nil
+	})
+}
+
+func (g *mockGateway) Capture(ctx context.Context, intentID string) (paymentIntent, error) {
+	return g.update(intentID, func(intent *paymentIntent) (string, error) {
+		if intent.Status != "requires_capture" {
+			return "", &paymentStateError{Status: intent.Status, Operation: "capture"}
+		}
+		intent.Status = "succeeded"
+		return "payment_intent.succeeded", nil
+	})
+}
+
+func (g *mockGateway) Refund(ctx context.Context, intentID string, amount int64) (paymentIntent, error) {
+	return g.update(intentID, func(intent *paymentIntent) (string, error) {
+		if intent.Status != "succeeded" {
+			return "", &paymentStateError{Status: intent.Status, Operation: "refund"}
+		}
+		if amount <= 0 || amount > intent.Amount-intent.AmountRefunded {
+			return "", fmt.Errorf("refund amount must be between 1 and %d", intent.Amount-intent.AmountRefunded)
+		}
+		intent.AmountRefunded += amount
+		if intent.AmountRefunded == intent.Amount {
+			intent.Status = "refunded"
+		}
+		return "charge.refunded", nil
+	})
+}
+
+// update applies fn to the intent under the lock and sends the webhook
+// event fn names once the change is made.
+func (g *mockGateway) update(intentID string, fn func(*paymentIntent) (string, error)) (paymentIntent, error) {
+	g.mu.Lock()
+	intent, ok := g.intents[intentID]
+	if !ok {
+		g.mu.Unlock()
+		return paymentIntent{}, errIntentNotFound
+	}
+	eventType, err := fn(intent)
+	snapshot := *intent
+	g.mu.Unlock()
+	if err != nil {
+		return snapshot, err
+	}
+
+	g.sendWebhook(webhookEvent{
+		ID:      randomID("mock_evt_"),
+		Type:    eventType,
+		Created: time.Now().Unix(),
+		Intent:  snapshot,
+	})
+	return snapshot, nil
+}
+
+// sign คืนค่า header แบบ t=<unix>,v1=<hex hmac ของ "t.body">
+func (g *mockGateway) sign(body []byte, t time.Time) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, g.secret)
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// sendWebhook delivers the event in the background, retrying up to four
+// times with backoff until the endpoint answers 2xx. Retries reuse the
+// event ID, so the receiver sees them as the same event.
+func (g *mockGateway) sendWebhook(event webhookEvent) {
+	if g.webhookURL == "" {
+		return
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("mock gateway: encode webhook %s: %v", event.ID, err)
+		return
+	}
+
+	go func() {
+		delay := time.Second
+		for attempt := 1; attempt <= 4; attempt++ {
+			time.Sleep(delay)
+			delay *= 2
+
+			req, err := http.NewRequest(http.MethodPost, g.webhookURL, bytes.NewReader(body))
+			if err != nil {
+				log.Printf("mock gateway: webhook %s: %v", event.ID, err)
+				return
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(mockSignatureHeader, g.sign(body, time.Now()))
+
+			resp, err := g.client.Do(req)
+			if err == nil {
+				resp.Body.Close()
+				if resp.StatusCode/100 == 2 {
+					return
+				}
+				err = fmt.Errorf("status %d", resp.StatusCode)
+			}
+			log.Printf("mock gateway: webhook %s attempt %d failed: %v", event.ID, attempt, err)
+		}
+	}()
+}
+
+func (g *mockGateway) VerifyWebhook(header http.Header, body []byte) (webhookEvent, error) {
+	var event webhookEvent
+	var ts, sig string
+	for _, part := range strings.Split(header.Get(mockSignatureHeader), ",") {
+		if k, v, ok := strings.Cut(part, "="); ok {
+			switch k {
+			case "t":
+				ts = v
+			case "v1":
+				sig = v
+			}
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return event, errInvalidSignature
+	}
+
+	expected := g.sign(body, time.Unix(unix, 0))
+	if !hmac.Equal([]byte(expected), []byte("t="+ts+",v1="+sig)) {
+		return event, errInvalidSignature
+	}
+	if skew := time.Since(time.Unix(unix, 0)); skew > mockWebhookTolerance || skew < -mockWebhookTolerance {
+		return event, errWebhookSkewTooBig
+	}
+
+	if err := json.Unmarshal(body, &event); err != nil {
+		return event, err
+	}
+	if event.ID == "" || event.Intent.ID == "" {
+		return event, errors.New("webhook event is missing id")
+	}
+	return event, nil
+}
@@ -0,0 +1,654 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===================== Payment Models =====================
+type Payment struct {
+	ID             int       `json:"id"`
+	OrderID        int       `json:"order_id"`
+	Provider       string    `json:"provider"`
+	ProviderRef    string    `json:"provider_ref"` // id ของ intent ฝั่ง gateway
+	Amount         Money     `json:"amount"`
+	AmountRefunded Money     `json:"amount_refunded"`
+	Currency       string    `json:"currency"`
+	Status         string    `json:"status"` // requires_confirmation, requires_capture, succeeded, failed, refunded
+	FailureReason  string    `json:"failure_reason,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type PaymentConfirmRequest struct {
+	PaymentMethod string `json:"payment_method" binding:"max=100"` // mock: mock_card, mock_card_declined, mock_card_insufficient_funds
+}
+
+type PaymentRefundRequest struct {
+	Amount float64 `json:"amount" binding:"gte=0"` // 0 = คืนส่วนที่เหลือทั้งหมด
+	Reason string  `json:"reason" binding:"max=500"`
+}
+
+var gateway paymentGateway
+
+// paymentCurrency อ่านจาก PAYMENT_CURRENCY (ค่าเริ่มต้น THB)
+func paymentCurrency() string {
+	return getEnv("PAYMENT_CURRENCY", "THB")
+}
+
+// autoCapture: PAYMENT_CAPTURE=manual ให้ staff capture เอง ไม่งั้น capture ทันทีหลัง confirm
+func autoCapture() bool {
+	return getEnv("PAYMENT_CAPTURE", "auto") != "manual"
+}
+
+const paymentSelect = `
+	SELECT id, order_id, provider, provider_ref, amount, amount_refunded, currency, status,
+	       COALESCE(failure_reason, ''), created_at, updated_at
+	FROM payments`
+
+func scanPayment(row interface{ Scan(...interface{}) error }) (Payment, error) {
+	var p Payment
+	err := row.Scan(&p.ID, &p.OrderID, &p.Provider, &p.ProviderRef, &p.Amount, &p.AmountRefunded,
+		&p.Currency, &p.Status, &p.FailureReason, &p.CreatedAt, &p.UpdatedAt)
+	return p, err
+}
+
+// ===================== Payment State =====================
+// paymentStatusRank ใช้กัน status ถอยหลัง เมื่อ response กับ webhook ของการเปลี่ยนเดียวกันมาไม่ตรงลำดับ
+var paymentStatusRank = map[string]int{
+	"requires_confirmation": 0,
+	"requires_capture":      1,
+	"failed":                2,
+	"succeeded":             2,
+	"refunded":              3,
+}
+
+// paymentChange is what applyIntent did, for auditing after commit.
+type paymentChange struct {
+	Before    Payment
+	After     Payment
+	OrderFrom string // ว่างถ้า order ไม่เปลี่ยน status
+	OrderTo   string
+	Movements []StockMovement
+}
+
+func (ch paymentChange) changed() bool {
+	return ch.Before.Status != ch.After.Status || ch.Before.AmountRefunded != ch.After.AmountRefunded
+}
+
+// applyIntent writes the gateway's state of an intent to its payment row
+// inside tx and moves the order along: pending → paid when the payment
+// succeeds, → refunded when it is fully refunded. Handlers and webhooks
+// both report the same changes in either order, so the status only moves
+// forward and a state the row already has is a no-op. It returns
+// sql.ErrNoRows for an intent this service didn't create.
+func applyIntent(tx *sql.Tx, userID int, intent paymentIntent) (paymentChange, error) {
+	var ch paymentChange
+	p, err := scanPayment(tx.QueryRow(paymentSelect+" WHERE provider = $1 AND provider_ref = $2 FOR UPDATE",
+		gateway.Name(), intent.ID))
+	if err != nil {
+		return ch, err
+	}
+	ch.Before, ch.After = p, p
+
+	status := p.Status
+	if rank, ok := paymentStatusRank[intent.Status]; ok && rank > paymentStatusRank[p.Status] {
+		status = intent.Status
+	}
+	refunded := p.AmountRefunded
+	if r := Money(intent.AmountRefunded); r > refunded {
+		refunded = r
+	}
+	if status == p.Status && refunded == p.AmountRefunded {
+		return ch, nil
+	}
+
+	ch.After, err = scanPayment(tx.QueryRow(`
+		UPDATE payments
+		SET status = $2, amount_refunded = $3, failure_reason = NULLIF($4, ''), updated_at = NOW()
+		WHERE id = $1
+		RETURNING id, order_id, provider, provider_ref, amount, amount_refunded, currency, status,
+		          COALESCE(failure_reason, ''), created_at, updated_at
+	`, p.ID, status, refunded, intent.FailureReason))
+	if err != nil {
+		return ch, err
+	}
+
+	var orderStatus string
+	switch {
+	case ch.After.Status == "succeeded" && p.Status != "succeeded":
+		orderStatus = "paid"
+	case ch.After.Status == "refunded" && p.Status != "refunded":
+		orderStatus = "refunded"
+	default:
+		return ch, nil
+	}
+
+	note := "payment #" + strconv.Itoa(p.ID) + " " + ch.After.Status
+	from, movements, err := transitionOrder(tx, userID, 0, p.OrderID, orderStatus, note)
+	var transitionErr *orderTransitionError
+	if errors.As(err, &transitionErr) {
+		// เช่น order ถูกยกเลิกไปก่อนเงินเข้า ต้องให้ staff ตรวจแล้ว refund เอง
+		log.Printf("payment %d is %s but order %d stays %s", p.ID, ch.After.Status, p.OrderID, transitionErr.From)
+		return ch, nil
+	} else if err != nil {
+		return ch, err
+	}
+	ch.OrderFrom, ch.OrderTo, ch.Movements = from, orderStatus, movements
+	return ch, nil
+}
+
+// logPaymentChange บันทึก audit ของทุกการเปลี่ยนสถานะ payment (และ order/สต็อกที่เปลี่ยนตาม) หลัง commit
+func logPaymentChange(userID int, ch paymentChange, c *gin.Context) {
+	if !ch.changed() {
+		return
+	}
+	logAudit(userID, "payment_"+ch.After.Status, "payments", ch.After.ID, gin.H{
+		"order_id":        ch.After.OrderID,
+		"from":            ch.Before.Status,
+		"to":              ch.After.Status,
+		"amount":          ch.After.Amount,
+		"amount_refunded": ch.After.AmountRefunded,
+		"provider_ref":    ch.After.ProviderRef,
+		"failure_reason":  ch.After.FailureReason,
+	}, c)
+	if ch.OrderTo != "" {
+		logAudit(userID, "update_status", "orders", ch.After.OrderID, gin.H{
+			"from":       ch.OrderFrom,
+			"to":         ch.OrderTo,
+			"payment_id": ch.After.ID,
+		}, c)
+	}
+	for _, m := range ch.Movements {
+		logStockMovement(userID, m, c)
+	}
+}
+
+// syncIntent applies the intent returned by a gateway call and answers with
+// the updated payment.
+func syncIntent(c *gin.Context, intent paymentIntent) {
+	userID := c.GetInt("user_id")
+	var ch paymentChange
+	err := withActingUser(userID, func(tx *sql.Tx) error {
+		var err error
+		ch, err = applyIntent(tx, userID, intent)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	logPaymentChange(userID, ch, c)
+	c.JSON(http.StatusOK, ch.After)
+}
+
+// respondGatewayError แปลง error จาก gateway: สถานะไม่ถูกต้อง = 409, วิธีจ่ายที่ไม่รองรับ = 422, ที่เหลือ = 502
+func respondGatewayError(c *gin.Context, err error) {
+	var stateErr *paymentStateError
+	if errors.As(err, &stateErr) {
+		c.JSON(http.StatusConflict, gin.H{"error": stateErr.Error(), "status": stateErr.Status})
+		return
+	}
+	if errors.Is(err, errUnsupportedMethod) {
+		c.JSON(http.StatusUnprocessableEntity, ValidationErrorResponse{Error: "validation failed", Fields: []FieldError{{
+			Field: "payment_method", Code: "unsupported", Message: err.Error(),
+		}}})
+		return
+	}
+	c.JSON(http.StatusBadGateway, gin.H{"error": "payment gateway: " + err.Error()})
+}
+
+// loadPayment อ่าน payment พร้อม status ของ order ownerID = 0 คือ order ของใครก็ได้
+func loadPayment(c *gin.Context, paymentID, orderID, ownerID int) (Payment, string, bool) {
+	var orderStatus string
+	p, err := scanPayment(db.QueryRow(`
+		SELECT p.id, p.order_id, p.provider, p.provider_ref, p.amount, p.amount_refunded, p.currency, p.status,
+		       COALESCE(p.failure_reason, ''), p.created_at, p.updated_at
+		FROM payments p
+		JOIN orders o ON o.id = p.order_id
+		WHERE p.id = $1 AND ($2 = 0 OR p.order_id = $2) AND ($3 = 0 OR o.user_id = $3)
+	`, paymentID, orderID, ownerID))
+	if err == nil {
+		err = db.QueryRow("SELECT status FROM orders WHERE id = $1", p.OrderID).Scan(&orderStatus)
+	}
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "payment not found"})
+		return p, "", false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return p, "", false
+	}
+	if p.Provider != gateway.Name() {
+		c.JSON(http.StatusConflict, gin.H{"error": "payment belongs to provider " + p.Provider})
+		return p, "", false
+	}
+	return p, orderStatus, true
+}
+
+func parsePaymentID(c *gin.Context, param string) (int, bool) {
+	id, err := strconv.Atoi(c.Param(param))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "payment not found"})
+		return 0, false
+	}
+	return id, true
+}
+
+func respondOrderPayments(c *gin.Context, orderID, ownerID int) {
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM orders WHERE id = $1 AND ($2 = 0 OR user_id = $2))",
+		orderID, ownerID).Scan(&exists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+
+	rows, err := db.Query(paymentSelect+" WHERE order_id = $1 ORDER BY id", orderID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	payments := []Payment{}
+	for rows.Next() {
+		p, err := scanPayment(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		payments = append(payments, p)
+	}
+	c.JSON(http.StatusOK, payments)
+}
+
+// ===================== Customer Payment Handlers =====================
+// @Summary Start paying for an order
+// @Description Creates a payment intent for the order total. If the order already has an unfinished payment, that one is returned instead (200).
+// @Tags Payments
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 201 {object} Payment
+// @Success 200 {object} Payment
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /orders/{id}/payments [post]
+// @security ApiKeyAuth
+func createPayment(c *gin.Context) {
+	orderID, ok := parseOrderID(c)
+	if !ok {
+		return
+	}
+	userID := c.GetInt("user_id")
+
+	var status string
+	var amount Money
+	err := db.QueryRow("SELECT status, total FROM orders WHERE id = $1 AND user_id = $2", orderID, userID).Scan(&status, &amount)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if status != "pending" {
+		c.JSON(http.StatusConflict, gin.H{"error": "order is not awaiting payment", "status": status})
+		return
+	}
+	if amount <= 0 {
+		// ส่วนลดครอบคลุมทั้ง order ให้ staff เปลี่ยนเป็น paid เอง
+		c.JSON(http.StatusConflict, gin.H{"error": "order total is zero, nothing to pay"})
+		return
+	}
+
+	existing, err := scanPayment(db.QueryRow(paymentSelect+`
+		WHERE order_id = $1 AND status IN ('requires_confirmation', 'requires_capture')
+	`, orderID))
+	if err == nil {
+		c.JSON(http.StatusOK, existing)
+		return
+	} else if err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	currency := paymentCurrency()
+	intent, err := gateway.CreateIntent(c.Request.Context(), int64(amount), currency, orderReference(orderID))
+	if err != nil {
+		respondGatewayError(c, err)
+		return
+	}
+
+	p, err := scanPayment(db.QueryRow(`
+		INSERT INTO payments (order_id, provider, provider_ref, amount, currency, status)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, order_id, provider, provider_ref, amount, amount_refunded, currency, status,
+		          COALESCE(failure_reason, ''), created_at, updated_at
+	`, orderID, gateway.Name(), intent.ID, Money(intent.Amount), currency, intent.Status))
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "order already has a payment in progress"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	logAudit(userID, "create", "payments", p.ID, gin.H{
+		"order_id":     orderID,
+		"amount":       p.Amount,
+		"currency":     p.Currency,
+		"provider":     p.Provider,
+		"provider_ref": p.ProviderRef,
+	}, c)
+
+	c.JSON(http.StatusCreated, p)
+}
+
+// @Summary Confirm a payment
+// @Description Authorizes the payment with the given method. Unless PAYMENT_CAPTURE=manual it is captured right away and the order becomes paid.
+// @Tags Payments
+// @Accept json
+// @Produce json
+// @Param id path int true "Order ID"
+// @Param payment_id path int true "Payment ID"
+// @Param confirm body PaymentConfirmRequest false "Payment method"
+// @Success 200 {object} Payment
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} ValidationErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /orders/{id}/payments/{payment_id}/confirm [post]
+// @security ApiKeyAuth
+func confirmPayment(c *gin.Context) {
+	orderID, ok := parseOrderID(c)
+	if !ok {
+		return
+	}
+	paymentID, ok := parsePaymentID(c, "payment_id")
+	if !ok {
+		return
+	}
+	var req PaymentConfirmRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondBindError(c, err)
+			return
+		}
+	}
+
+	p, orderStatus, ok := loadPayment(c, paymentID, orderID, c.GetInt("user_id"))
+	if !ok {
+		return
+	}
+	if orderStatus != "pending" {
+		c.JSON(http.StatusConflict, gin.H{"error": "order is not awaiting payment", "status": orderStatus})
+		return
+	}
+
+	intent, err := gateway.Confirm(c.Request.Context(), p.ProviderRef, req.PaymentMethod)
+	if err != nil {
+		respondGatewayError(c, err)
+		return
+	}
+	if intent.Status == "requires_capture" && autoCapture() {
+		userID := c.GetInt("user_id")
+		ch, orderStatus, err := recordAuthorization(userID, p.OrderID, intent)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		logPaymentChange(userID, ch, c)
+		if orderStatus != "pending" {
+			c.JSON(http.StatusConflict, gin.H{"error": "order is not awaiting payment", "status": orderStatus})
+			return
+		}
+		if intent, err = gateway.Capture(c.Request.Context(), p.ProviderRef); err != nil {
+			respondGatewayError(c, err)
+			return
+		}
+	}
+	syncIntent(c, intent)
+}
+
+// recordAuthorization writes an authorized intent while holding the order
+// lock and returns the order's status. A concurrent cancel either ran
+// first (the order isn't pending, so don't capture) or sees the
+// authorization and is refused with errPaymentAuthorized.
+func recordAuthorization(userID, orderID int, intent paymentIntent) (paymentChange, string, error) {
+	var ch paymentChange
+	var status string
+	err := withActingUser(userID, func(tx *sql.Tx) error {
+		if err := tx.QueryRow("SELECT status FROM orders WHERE id = $1 FOR UPDATE", orderID).Scan(&status); err != nil {
+			return err
+		}
+		var err error
+		ch, err = applyIntent(tx, userID, intent)
+		return err
+	})
+	return ch, status, err
+}
+
+// @Summary List payments of my order
+// @Tags Payments
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {array} Payment
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /orders/{id}/payments [get]
+// @security ApiKeyAuth
+func listMyOrderPayments(c *gin.Context) {
+	orderID, ok := parseOrderID(c)
+	if !ok {
+		return
+	}
+	respondOrderPayments(c, orderID, c.GetInt("user_id"))
+}
+
+// ===================== Staff Payment Handlers =====================
+// @Summary List payments of any order
+// @Tags Payments
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {array} Payment
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /staff/orders/{id}/payments [get]
+// @security ApiKeyAuth
+func listOrderPayments(c *gin.Context) {
+	orderID, ok := parseOrderID(c)
+	if !ok {
+		return
+	}
+	respondOrderPayments(c, orderID, 0)
+}
+
+// @Summary Capture an authorized payment
+// @Description Used when PAYMENT_CAPTURE=manual; the order becomes paid. Refused (409) once the order is no longer pending.
+// @Tags Payments
+// @Produce json
+// @Param id path int true "Payment ID"
+// @Success 200 {object} Payment
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /staff/payments/{id}/capture [post]
+// @security ApiKeyAuth
+func capturePayment(c *gin.Context) {
+	paymentID, ok := parsePaymentID(c, "id")
+	if !ok {
+		return
+	}
+	p, orderStatus, ok := loadPayment(c, paymentID, 0, 0)
+	if !ok {
+		return
+	}
+	// order ที่ถูกยกเลิกไปแล้วห้าม capture ไม่งั้นลูกค้าถูกตัดเงินโดยไม่ได้ของ
+	if orderStatus != "pending" {
+		c.JSON(http.StatusConflict, gin.H{"error": "order is not awaiting payment", "status": orderStatus})
+		return
+	}
+
+	intent, err := gateway.Capture(c.Request.Context(), p.ProviderRef)
+	if err != nil {
+		respondGatewayError(c, err)
+		return
+	}
+	syncIntent(c, intent)
+}
+
+// @Summary Refund a payment
+// @Description Refunds amount, or everything not yet refunded when amount is 0. A full refund moves the order to refunded (and restocks it if it hasn't shipped), so it isn't allowed while the order is shipped.
+// @Tags Payments
+// @Accept json
+// @Produce json
+// @Param id path int true "Payment ID"
+// @Param refund body PaymentRefundRequest true "Amount and reason"
+// @Success 200 {object} Payment
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} ValidationErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /staff/payments/{id}/refund [post]
+// @security ApiKeyAuth
+func refundPayment(c *gin.Context) {
+	paymentID, ok := parsePaymentID(c, "id")
+	if !ok {
+		return
+	}
+	var req PaymentRefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	p, orderStatus, ok := loadPayment(c, paymentID, 0, 0)
+	if !ok {
+		return
+	}
+	if p.Status != "succeeded" {
+		c.JSON(http.StatusConflict, gin.H{"error": "only succeeded payments can be refunded", "status": p.Status})
+		return
+	}
+
+	remaining := p.Amount - p.AmountRefunded
+	amount := moneyFromFloat(req.Amount)
+	if amount == 0 {
+		amount = remaining
+	}
+	if amount > remaining {
+		c.JSON(http.StatusUnprocessableEntity, ValidationErrorResponse{Error: "validation failed", Fields: []FieldError{{
+			Field: "amount", Code: "max", Param: remaining.String(),
+			Message: "must be at most the amount not yet refunded",
+		}}})
+		return
+	}
+	if amount == remaining && !canTransition(orderStatus, "refunded") {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "order cannot be refunded in its current status",
+			"status": orderStatus,
+		})
+		return
+	}
+
+	intent, err := gateway.Refund(c.Request.Context(), p.ProviderRef, int64(amount))
+	if err != nil {
+		respondGatewayError(c, err)
+		return
+	}
+	if req.Reason != "" {
+		logAudit(c.GetInt("user_id"), "refund_reason", "payments", p.ID, gin.H{
+			"amount": amount,
+			"reason": req.Reason,
+		}, c)
+	}
+	syncIntent(c, intent)
+}
+
+// ===================== Payment Webhooks =====================
+// @Summary Receive a payment gateway webhook
+// @Description Signed callback from the provider. Each event is processed once; redeliveries of the same event id are acknowledged without doing anything.
+// @Tags Payments
+// @Accept json
+// @Produce json
+// @Param provider path string true "Provider name, e.g. mock"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /payments/webhooks/{provider} [post]
+func paymentWebhook(c *gin.Context) {
+	if c.Param("provider") != gateway.Name() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown payment provider"})
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, 1<<20))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	event, err := gateway.VerifyWebhook(c.Request.Header, body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	duplicate := false
+	var ch paymentChange
+	err = withActingUser(0, func(tx *sql.Tx) error {
+		// INSERT ก่อนทำอย่างอื่น event เดียวกันที่มาพร้อมกันจะรอ transaction แรก แล้วเจอว่าซ้ำ
+		var eventRowID int
+		err := tx.QueryRow(`
+			INSERT INTO payment_events (provider, event_id, event_type, payload)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (provider, event_id) DO NOTHING
+			RETURNING id
+		`, gateway.Name(), event.ID, event.Type, string(body)).Scan(&eventRowID)
+		if err == sql.ErrNoRows {
+			duplicate = true
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		ch, err = applyIntent(tx, 0, event.Intent)
+		if err == sql.ErrNoRows {
+			log.Printf("webhook %s: unknown payment intent %s", event.ID, event.Intent.ID)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE payment_events SET payment_id = $2 WHERE id = $1", eventRowID, ch.After.ID)
+		return err
+	})
+	if err != nil {
+		// ตอบ 500 ให้ gateway ส่งมาใหม่ event ยังไม่ถูกบันทึกเพราะ rollback ไปแล้ว
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if duplicate {
+		c.JSON(http.StatusOK, gin.H{"received": true, "duplicate": true})
+		return
+	}
+	logPaymentChange(0, ch, c)
+	c.JSON(http.StatusOK, gin.H{"received": true, "duplicate": false})
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ===================== PDF Writer =====================
+// เขียน PDF เองด้วย stdlib พอสำหรับเอกสารอย่างใบกำกับภาษี: หน้า A4, ข้อความฟอนต์เดียว และเส้น
+// ค่าเริ่มต้นใช้ Helvetica ที่มีในทุกโปรแกรมอ่าน PDF (ASCII เท่านั้น)
+// ถ้าตั้ง INVOICE_FONT เป็นไฟล์ .ttf ที่มีภาษาไทย (เช่น Sarabun) จะฝังฟอนต์นั้นลงไปในไฟล์
+
+const (
+	pdfPageWidth  = 595.28 // A4 หน่วย point
+	pdfPageHeight = 841.89
+)
+
+// pdfFont is the one font a pdfDocument writes with.
+type pdfFont interface {
+	hasGlyphs(s string) bool
+	width(s string, size float64) float64
+	encode(s string) string // operand ของ Tj
+	write(w *pdfWriter) int // เขียน object ของฟอนต์ คืนเลข object ของ font dictionary
+}
+
+type pdfDocument struct {
+	font  pdfFont
+	pages []*bytes.Buffer // content stream ของแต่ละหน้า
+	page  *bytes.Buffer
+}
+
+func newPDFDocument(font pdfFont) *pdfDocument {
+	d := &pdfDocument{font: font}
+	d.newPage()
+	return d
+}
+
+func (d *pdfDocument) newPage() {
+	d.page = &bytes.Buffer{}
+	d.pages = append(d.pages, d.page)
+}
+
+// setPage เลือกหน้าที่จะเขียนต่อ (เริ่มที่ 0) ใช้ใส่เลขหน้าหลังรู้จำนวนหน้าทั้งหมดแล้ว
+func (d *pdfDocument) setPage(i int) {
+	d.page = d.pages[i]
+}
+
+// text วาดข้อความโดยให้ (x, y) เป็นมุมซ้ายล่างของ baseline นับจากมุมซ้ายล่างของหน้า
+func (d *pdfDocument) text(x, y, size float64, s string) {
+	if s == "" {
+		return
+	}
+	fmt.Fprintf(d.page, "BT /F1 %.2f Tf %.2f %.2f Td %s Tj ET\n", size, x, y, d.font.encode(s))
+}
+
+// textRight วาดข้อความชิดขวาที่ x ใช้กับตัวเลข
+func (d *pdfDocument) textRight(x, y, size float64, s string) {
+	d.text(x-d.font.width(s, size), y, size, s)
+}
+
+func (d *pdfDocument) line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(d.page, "%.2f w %.2f %.2f m %.2f %.2f l S\n", width, x1, y1, x2, y2)
+}
+
+// fit ตัดข้อความให้กว้างไม่เกิน maxWidth โดยเติม "..." ท้าย
+func (d *pdfDocument) fit(s string, size, maxWidth float64) string {
+	if d.font.width(s, size) <= maxWidth {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && d.font.width(string(runes)+"...", size) > maxWidth {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
+
+// wrap แบ่งข้อความเป็นบรรทัดที่กว้างไม่เกิน maxWidth ตัดที่ช่องว่างก่อน
+// คำที่ยาวเกินบรรทัด (เช่น ภาษาไทยที่ไม่เว้นวรรค) ตัดตามตัวอักษร
+func (d *pdfDocument) wrap(s string, size, maxWidth float64) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(s, "\n") {
+		current := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if current != "" {
+				candidate = current + " " + word
+			}
+			if d.font.width(candidate, size) <= maxWidth {
+				current = candidate
+				continue
+			}
+			if current != "" {
+				lines = append(lines, current)
+			}
+			current = ""
+			for _, r := range word {
+				if current != "" && d.font.width(current+string(r), size) > maxWidth {
+					lines = append(lines, current)
+					current = ""
+				}
+				current += string(r)
+			}
+		}
+		if current != "" {
+			lines = append(lines, current)
+		}
+	}
+	return lines
+}
+
+// bytes ประกอบไฟล์ PDF ทั้งไฟล์
+func (d *pdfDocument) bytes() []byte {
+	w := newPDFWriter()
+	catalog := w.alloc()
+	pages := w.alloc()
+	font := d.font.write(w)
+
+	var kids []string
+	for _, content := range d.pages {
+		stream := w.alloc()
+		w.stream(stream, "", content.Bytes(), true)
+		page := w.alloc()
+		w.object(page, fmt.Sprintf(
+			"<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 %d 0 R >> >> /Contents %d 0 R >>",
+			pages, pdfPageWidth, pdfPageHeight, font, stream))
+		kids = append(kids, fmt.Sprintf("%d 0 R", page))
+	}
+	w.object(pages, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids)))
+	w.object(catalog, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pages))
+	return w.finish(catalog)
+}
+
+// pdfWriter เก็บ object ตามลำดับที่เขียนและจำตำแหน่งไว้ทำตาราง xref
+type pdfWriter struct {
+	buf     bytes.Buffer
+	offsets map[int]int
+	next    int
+}
+
+func newPDFWriter() *pdfWriter {
+	w := &pdfWriter{offsets: map[int]int{}, next: 1}
+	// บรรทัดที่สองเป็น byte > 127 ตามธรรมเนียม บอกโปรแกรมอื่นว่าไฟล์นี้เป็น binary
+	w.buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	return w
+}
+
+// alloc จองเลข object ไว้ก่อน เพื่อให้อ้างถึงกันได้ก่อนเขียนจริง
+func (w *pdfWriter) alloc() int {
+	n := w.next
+	w.next++
+	return n
+}
+
+func (w *pdfWriter) object(n int, body string) {
+	w.offsets[n] = w.buf.Len()
+	fmt.Fprintf(&w.buf, "%d 0 obj\n%s\nendobj\n", n, body)
+}
+
+// stream writes a stream object; dict holds extra entries besides
+// /Length and /Filter.
+func (w *pdfWriter) stream(n int, dict string, data []byte, compress bool) {
+	if compress {
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		zw.Write(data)
+		zw.Close()
+		data = z.Bytes()
+		dict += " /Filter /FlateDecode"
+	}
+	w.offsets[n] = w.buf.Len()
+	fmt.Fprintf(&w.buf, "%d 0 obj\n<< /Length %d%s >>\nstream\n", n, len(data), dict)
+	w.buf.Write(data)
+	w.buf.WriteString("\nendstream\nendobj\n")
+}
+
+func (w *pdfWriter) finish(root int) []byte {
+	xref := w.buf.Len()
+	fmt.Fprintf(&w.buf, "xref\n0 %d\n0000000000 65535 f \n", w.next)
+	for n := 1; n < w.next; n++ {
+		fmt.Fprintf(&w.buf, "%010d 00000 n \n", w.offsets[n])
+	}
+	fmt.Fprintf(&w.buf, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", w.next, root, xref)
+	return w.buf.Bytes()
+}
+
+// pdfString escapes s as a literal string operand.
+func pdfString(s string) string {
+	return "(" + strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(s) + ")"
+}
+
+// ===================== Helvetica =====================
+// ความกว้างตัวอักษร ASCII 32-126 ของ Helvetica (หน่วย 1/1000 ของขนาดฟอนต์) จาก AFM มาตรฐาน
+var helveticaWidths = [...]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278, // space - /
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556, // 0 - ?
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778, // @ - O
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556, // P - _
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556, // ` - o
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584, // p - ~
+}
+
+type helveticaFont struct{}
+
+func (helveticaFont) hasGlyphs(s string) bool {
+	for _, r := range s {
+		if r < 32 || r > 126 {
+			return false
+		}
+	}
+	return true
+}
+
+// ascii แทนตัวอักษรที่ Helvetica ไม่มีด้วย ?
+func (helveticaFont) ascii(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 32 || r > 126 {
+			return '?'
+		}
+		return r
+	}, s)
+}
+
+func (f helveticaFont) width(s string, size float64) float64 {
+	total := 0
+	for _, r := range f.ascii(s) {
+		total += helveticaWidths[r-32]
+	}
+	return float64(total) * size / 1000
+}
+
+func (f helveticaFont) encode(s string) string {
+	return pdfString(f.ascii(s))
+}
+
+func (helveticaFont) write(w *pdfWriter) int {
+	n := w.alloc()
+	w.object(n, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	return n
+}
+
+// ===================== TrueType =====================
+// trueTypeFont อ่านเฉพาะตารางที่ต้องใช้วัดความกว้างและแปลงตัวอักษรเป็น glyph
+// ฝังทั้งไฟล์โดยไม่ตัด subset และยังไม่รองรับ OpenType แบบ CFF หรือ .ttc
+type trueTypeFont struct {
+	data       []byte
+	unitsPerEm float64
+	ascent     int
+	descent    int
+	bbox       [4]int
+	advances   []int // ต่อ glyph หน่วย font unit
+	glyphs     map[rune]uint16
+}
+
+var errUnsupportedFont = errors.New("not a TrueType font with a Unicode cmap")
+
+func be16(b []byte, off int) int {
+	if off < 0 || off+2 > len(b) {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(b[off:]))
+}
+
+func be16s(b []byte, off int) int {
+	return int(int16(be16(b, off)))
+}
+
+func be32(b []byte, off int) int {
+	if off < 0 || off+4 > len(b) {
+		return 0
+	}
+	return int(binary.BigEndian.Uint32(b[off:]))
+}
+
+func parseTrueType(data []byte) (*trueTypeFont, error) {
+	if len(data) < 12 {
+		return nil, errUnsupportedFont
+	}
+	if v := be32(data, 0); v != 0x00010000 && v != 0x74727565 { // 'true'
+		return nil, errUnsupportedFont
+	}
+
+	tables := map[string][]byte{}
+	for i := 0; i < be16(data, 4); i++ {
+		rec := 12 + 16*i
+		if rec+16 > len(data) {
+			return nil, errUnsupportedFont
+		}
+		off, length := be32(data, rec+8), be32(data, rec+12)
+		if off+length > len(data) {
+			return nil, errUnsupportedFont
+		}
+		tables[string(data[rec:rec+4])] = data[off : off+length]
+	}
+	head, hhea, hmtx, maxp, cmap := tables["head"], tables["hhea"], tables["hmtx"], tables["maxp"], tables["cmap"]
+	if len(head) < 54 || len(hhea) < 36 || len(maxp) < 6 || hmtx == nil || cmap == nil {
+		return nil, errUnsupportedFont
+	}
+
+	f := &trueTypeFont{
+		data:       data,
+		unitsPerEm: float64(be16(head, 18)),
+		ascent:     be16s(hhea, 4),
+		descent:    be16s(hhea, 6),
+		bbox:       [4]int{be16s(head, 36), be16s(head, 38), be16s(head, 40), be16s(head, 42)},
+		glyphs:     map[rune]uint16{},
+	}
+	if f.unitsPerEm == 0 {
+		return nil, errUnsupportedFont
+	}
+
+	// hmtx มีความกว้างครบ numberOfHMetrics ตัวแรก ที่เหลือใช้ค่าสุดท้ายซ้ำ
+	numGlyphs, numMetrics := be16(maxp, 4), be16(hhea, 34)
+	if numGlyphs == 0 {
+		return nil, errUnsupportedFont
+	}
+	f.advances = make([]int, numGlyphs)
+	last := 0
+	for g := range f.advances {
+		if g < numMetrics {
+			last = be16(hmtx, 4*g)
+		}
+		f.advances[g] = last
+	}
+
+	// cmap format 4 (Unicode BMP) จาก platform 3 encoding 1 หรือ platform 0
+	sub := -1
+	for i := 0; i < be16(cmap, 2); i++ {
+		rec := 4 + 8*i
+		platform, encoding, off := be16(cmap, rec), be16(cmap, rec+2), be32(cmap, rec+4)
+		if (platform == 3 && encoding == 1 || platform == 0) && be16(cmap, off) == 4 {
+			sub = off
+			break
+		}
+	}
+	if sub < 0 {
+		return nil, errUnsupportedFont
+	}
+	segments := be16(cmap, sub+6) / 2
+	ends := sub + 14
+	starts := ends + 2*segments + 2
+	deltas := starts + 2*segments
+	rangeOffsets := deltas + 2*segments
+	for s := 0; s < segments; s++ {
+		start, end := be16(cmap, starts+2*s), be16(cmap, ends+2*s)
+		delta, rangeOffset := be16(cmap, deltas+2*s), be16(cmap, rangeOffsets+2*s)
+		for c := start; c <= end && c != 0xFFFF; c++ {
+			g := 0
+			if rangeOffset == 0 {
+				g = (c + delta) & 0xFFFF
+			} else if g = be16(cmap, rangeOffsets+2*s+rangeOffset+2*(c-start)); g != 0 {
+				g = (g + delta) & 0xFFFF
+			}
+			if g != 0 && g < numGlyphs {
+				f.glyphs[rune(c)] = uint16(g)
+			}
+		}
+	}
+	return f, nil
+}
+
+// scale แปลงหน่วย font unit เป็นหน่วย 1/1000 ที่ PDF ใช้
+func (f *trueTypeFont) scale(v int) int {
+	return int(float64(v) * 1000 / f.unitsPerEm)
+}
+
+// ttfFont คือ trueTypeFont ที่ใช้ในเอกสารหนึ่งฉบับ จำ glyph ที่ใช้ไว้ทำตาราง W และ ToUnicode
+type ttfFont struct {
+	*trueTypeFont
+	used map[uint16]rune
+}
+
+func (f *ttfFont) hasGlyphs(s string) bool {
+	for _, r := range s {
+		if _, ok := f.glyphs[r]; !ok && r != ' ' {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *ttfFont) width(s string, size float64) float64 {
+	total := 0
+	for _, r := range s {
+		total += f.advances[f.glyphs[r]]
+	}
+	return float64(total) * size / f.unitsPerEm
+}
+
+// encode ใช้ Identity-H: ทุกตัวอักษรเป็นเลข glyph 2 byte
+func (f *ttfFont) encode(s string) string {
+	var b strings.Builder
+	b.WriteByte('<')
+	for _, r := range s {
+		g := f.glyphs[r]
+		if g != 0 {
+			f.used[g] = r
+		}
+		fmt.Fprintf(&b, "%04X", g)
+	}
+	b.WriteByte('>')
+	return b.String()
+}
+
+func (f *ttfFont) write(w *pdfWriter) int {
+	const name = "/InvoiceFont"
+	file := w.alloc()
+	w.stream(file, fmt.Sprintf(" /Length1 %d", len(f.data)), f.data, true)
+
+	descriptor := w.alloc()
+	w.object(descriptor, fmt.Sprintf(
+		"<< /Type /FontDescriptor /FontName %s /Flags 32 /FontBBox [%d %d %d %d] /ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+		name, f.scale(f.bbox[0]), f.scale(f.bbox[1]), f.scale(f.bbox[2]), f.scale(f.bbox[3]),
+		f.scale(f.ascent), f.scale(f.descent), f.scale(f.ascent), file))
+
+	gids := make([]int, 0, len(f.used))
+	for g := range f.used {
+		gids = append(gids, int(g))
+	}
+	sort.Ints(gids)
+
+	var widths, toUnicode strings.Builder
+	for _, g := range gids {
+		fmt.Fprintf(&widths, "%d [%d] ", g, f.scale(f.advances[g]))
+	}
+	toUnicode.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n" +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n" +
+		"/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n" +
+		"1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+	// bfchar ใส่ได้ครั้งละไม่เกิน 100 รายการ
+	for start := 0; start < len(gids); start += 100 {
+		chunk := gids[start:min(start+100, len(gids))]
+		fmt.Fprintf(&toUnicode, "%d beginbfchar\n", len(chunk))
+		for _, g := range chunk {
+			fmt.Fprintf(&toUnicode, "<%04X> <%04X>\n", g, f.used[uint16(g)])
+		}
+		toUnicode.WriteString("endbfchar\n")
+	}
+	toUnicode.WriteString("endcmap\nCMapName currentdict /CMapName get /CMap defineresource pop\nend\nend\n")
+
+	cid := w.alloc()
+	w.object(cid, fmt.Sprintf(
+		"<< /Type /Font /Subtype /CIDFontType2 /BaseFont %s /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor %d 0 R /DW %d /W [%s] /CIDToGIDMap /Identity >>",
+		name, descriptor, f.scale(f.advances[0]), widths.String()))
+	cmap := w.alloc()
+	w.stream(cmap, "", []byte(toUnicode.String()), true)
+
+	font := w.alloc()
+	w.object(font, fmt.Sprintf(
+		"<< /Type /Font /Subtype /Type0 /BaseFont %s /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>",
+		name, cid, cmap))
+	return font
+}
+
+var (
+	documentFontOnce sync.Once
+	documentTTF      *trueTypeFont
+)
+
+// documentFont คืนฟอนต์สำหรับเอกสารใหม่หนึ่งฉบับ อ่าน INVOICE_FONT ครั้งแรกครั้งเดียว
+// อ่านไม่ได้ก็ log ไว้แล้วใช้ Helvetica แทน
+func documentFont() pdfFont {
+	documentFontOnce.Do(func() {
+		path := getEnv("INVOICE_FONT", "")
+		if path == "" {
+			return
+		}
+		data, err := os.ReadFile(path)
+		if err == nil {
+			documentTTF, err = parseTrueType(data)
+		}
+		if err != nil {
+			log.Printf("INVOICE_FONT %s: %v, using Helvetica", path, err)
+		}
+	})
+	if documentTTF == nil {
+		return helveticaFont{}
+	}
+	return &ttfFont{trueTypeFont: documentTTF, used: map[uint16]rune{}}
+}
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+type QuoteRequest struct {
+	Items       []OrderItemRequest `json:"items" binding:"max=100,dive"` // ไม่ส่ง = คิดราคาของใน cart
+	CouponCodes []string           `json:"coupon_codes" binding:"max=5,dive,max=50"`
+}
+
+// queryer คือสิ่งที่ *sql.DB และ *sql.Tx มีเหมือนกัน ใช้กับ helper ที่เรียกได้ทั้งในและนอก transaction
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+const promotionColumns = `
+	id, name, COALESCE(code, ''), promo_type, value, COALESCE(buy_quantity, 0), COALESCE(get_quantity, 0),
+	category_id, min_spend, starts_at, ends_at, usage_limit, per_user_limit, stackable, priority, active,
+	times_used, created_at, updated_at`
+
+func scanPromotion(row interface{ Scan(...interface{}) error }) (Promotion, error) {
+	var p Promotion
+	err := row.Scan(&p.ID, &p.Name, &p.Code, &p.Type, &p.Value, &p.BuyQuantity, &p.GetQuantity,
+		&p.CategoryID, &p.MinSpend, &p.StartsAt, &p.EndsAt, &p.UsageLimit, &p.PerUserLimit, &p.Stackable, &p.Priority, &p.Active,
+		&p.TimesUsed, &p.CreatedAt, &p.UpdatedAt)
+	return p, err
+}
+
+// ===================== Promotion Data =====================
+// loadOrderLines snapshots the books of an order or quote. It merges and
+// sorts lines like mergeOrderLines and returns an OrderItem and a
+// QuoteLine (with the book's category and all its parents) per book, in
+// the same order. A missing or trashed book is an *unavailableBookError.
+func loadOrderLines(q queryer, lines []OrderItemRequest) ([]OrderItem, []QuoteLine, error) {
+	lines = mergeOrderLines(lines)
+	items := make([]OrderItem, 0, len(lines))
+	quoteLines := make([]QuoteLine, 0, len(lines))
+	ancestors := map[int][]int{}
+
+	for _, line := range lines {
+		item := OrderItem{Quantity: line.Quantity}
+		var categoryID *int
+		err := q.QueryRow(`
+			SELECT title, author, COALESCE(isbn, ''), price, category_id
+			FROM books WHERE id = $1 AND deleted_at IS NULL
+		`, line.BookID).Scan(&item.Title, &item.Author, &item.ISBN, &item.UnitPrice, &categoryID)
+		if err == sql.ErrNoRows {
+			return nil, nil, &unavailableBookError{BookID: line.BookID}
+		} else if err != nil {
+			return nil, nil, err
+		}
+		bookID := line.BookID
+		item.BookID = &bookID
+
+		quoteLine := QuoteLine{BookID: bookID, Title: item.Title, Quantity: item.Quantity, UnitPrice: item.UnitPrice}
+		if categoryID != nil {
+			ids, ok := ancestors[*categoryID]
+			if !ok {
+				if ids, err = categoryAncestors(q, *categoryID); err != nil {
+					return nil, nil, err
+				}
+				ancestors[*categoryID] = ids
+			}
+			quoteLine.categoryIDs = ids
+		}
+
+		items = append(items, item)
+		quoteLines = append(quoteLines, quoteLine)
+	}
+	return items, quoteLines, nil
+}
+
+// categoryAncestors คืน id ของหมวดนี้และหมวดแม่ทุกชั้นจนถึง root
+func categoryAncestors(q queryer, categoryID int) ([]int, error) {
+	rows, err := q.Query(`
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id FROM categories WHERE id = $1
+			UNION ALL
+			SELECT c.id, c.parent_id FROM categories c JOIN ancestors a ON c.id = a.parent_id
+		)
+		SELECT id FROM ancestors
+	`, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// loadPromotions reads the automatic promotions that may be running plus
+// the ones named by codes, and how often each was used (by everyone and by
+// userID, not counting cancelled orders). Nothing is locked: placeOrder
+// claims a use of each applied promotion with a conditional UPDATE.
+func loadPromotions(q queryer, codes []string, userID int) ([]Promotion, map[int]promotionUsage, error) {
+	normalized := make([]string, 0, len(codes))
+	for _, code := range codes {
+		normalized = append(normalized, normalizeCouponCode(code))
+	}
+
+	query := "SELECT " + promotionColumns + ` FROM promotions
+		WHERE (code IS NULL AND active AND (ends_at IS NULL OR ends_at > NOW()))
+		   OR code = ANY($1)
+		ORDER BY id`
+	rows, err := q.Query(query, pq.Array(normalized))
+	if err != nil {
+		return nil, nil, err
+	}
+	var promos []Promotion
+	var ids []int64
+	usage := map[int]promotionUsage{}
+	for rows.Next() {
+		p, err := scanPromotion(rows)
+		if err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		promos = append(promos, p)
+		ids = append(ids, int64(p.ID))
+		usage[p.ID] = promotionUsage{Total: p.TimesUsed}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(ids) == 0 || userID == 0 {
+		return promos, usage, nil
+	}
+
+	rows, err = q.Query(`
+		SELECT r.promotion_id, COUNT(*)
+		FROM promotion_redemptions r
+		JOIN orders o ON o.id = r.order_id
+		WHERE r.user_id = $1 AND r.promotion_id = ANY($2) AND o.status <> 'cancelled'
+		GROUP BY r.promotion_id
+	`, userID, pq.Array(ids))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, count int
+		if err := rows.Scan(&id, &count); err != nil {
+			return nil, nil, err
+		}
+		u := usage[id]
+		u.ByUser = count
+		usage[id] = u
+	}
+	return promos, usage, rows.Err()
+}
+
+// cartOrderLines อ่านของใน cart เป็นบรรทัดสั่งซื้อ lock = ล็อกแถวไว้จนจบ transaction
+func cartOrderLines(q queryer, cartID int, lock bool) ([]OrderItemRequest, error) {
+	query := "SELECT book_id, quantity FROM cart_items WHERE cart_id = $1"
+	if lock {
+		query += " FOR UPDATE"
+	}
+	rows, err := q.Query(query, cartID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines []OrderItemRequest
+	for rows.Next() {
+		var line OrderItemRequest
+		if err := rows.Scan(&line.BookID, &line.Quantity); err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	return lines, rows.Err()
+}
+
+// ===================== Promotion Handlers =====================
+// @Summary Price books with promotions
+// @Description Prices items (or the cart when items is empty) for the current user with every running automatic promotion and the given coupon codes. Codes that can't be used are listed in rejected with the reason.
+// @Tags Promotions
+// @Accept json
+// @Produce json
+// @Param quote body QuoteRequest true "Items and coupon codes"
+// @Success 200 {object} Quote
+// @Failure 400 {object} ErrorResponse
+// @Failure 422 {object} ValidationErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /promotions/quote [post]
+// @security ApiKeyAuth
+func quotePrices(c *gin.Context) {
+	var req QuoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	lines := req.Items
+	if len(lines) == 0 {
+		cartID, _, err := resolveCart(c, false)
+		if err == nil && cartID != 0 {
+			lines, err = cartOrderLines(db, cartID, false)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	_, quoteLines, err := loadOrderLines(db, lines)
+	var bookErr *unavailableBookError
+	if errors.As(err, &bookErr) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": bookErr.Error(), "book_id": bookErr.BookID})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	promos, usage, err := loadPromotions(db, req.CouponCodes, c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, applyVAT(priceQuote(quoteLines, promos, req.CouponCodes, usage, time.Now()), loadTaxConfig()))
+}
+
+// @Summary List promotions
+// @Tags Promotions
+// @Produce json
+// @Param active query bool false "Only active (true) or inactive (false) promotions"
+// @Success 200 {array} Promotion
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /promotions [get]
+// @security ApiKeyAuth
+func listPromotions(c *gin.Context) {
+	var active interface{}
+	if v := c.Query("active"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "active must be true or false"})
+			return
+		}
+		active = b
+	}
+
+	rows, err := db.Query("SELECT "+promotionColumns+` FROM promotions
+		WHERE $1::boolean IS NULL OR active = $1
+		ORDER BY priority DESC, id`, active)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	promos := []Promotion{}
+	for rows.Next() {
+		p, err := scanPromotion(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		promos = append(promos, p)
+	}
+	c.JSON(http.StatusOK, promos)
+}
+
+func parsePromotionID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "promotion not found"})
+		return 0, false
+	}
+	return id, true
+}
+
+// @Summary Get promotion
+// @Tags Promotions
+// @Produce json
+// @Param id path int true "Promotion ID"
+// @Success 200 {object} Promotion
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /promotions/{id} [get]
+// @security ApiKeyAuth
+func getPromotion(c *gin.Context) {
+	id, ok := parsePromotionID(c)
+	if !ok {
+		return
+	}
+	p, err := scanPromotion(db.QueryRow("SELECT "+promotionColumns+" FROM promotions WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "promotion not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+// bindPromotion อ่าน body และตรวจเงื่อนไขทั้งหมด ตอบ error ไปแล้วถ้าคืน false
+func bindPromotion(c *gin.Context) (PromotionRequest, bool) {
+	var req PromotionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return req, false
+	}
+	req.Code = normalizeCouponCode(req.Code)
+
+	fields := validatePromotion(req)
+	if req.CategoryID != nil {
+		var exists bool
+		if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM categories WHERE id = $1)", *req.CategoryID).Scan(&exists); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return req, false
+		}
+		if !exists {
+			fields = append(fields, FieldError{Field: "category_id", Code: "not_found", Message: "category not found"})
+		}
+	}
+	if len(fields) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, ValidationErrorResponse{Error: "validation failed", Fields: fields})
+		return req, false
+	}
+	return req, true
+}
+
+func promotionArgs(req PromotionRequest) []interface{} {
+	active := req.Active == nil || *req.Active
+	var buy, get interface{}
+	if req.Type == "buy_x_get_y" {
+		buy, get = req.BuyQuantity, req.GetQuantity
+	}
+	return []interface{}{req.Name, req.Code, req.Type, req.Value, buy, get, req.CategoryID, req.MinSpend,
+		req.StartsAt, req.EndsAt, req.UsageLimit, req.PerUserLimit, req.Stackable, req.Priority, active}
+}
+
+func respondSavedPromotion(c *gin.Context, status int, action string, p Promotion, err error) {
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "promotion not found"})
+		return
+	} else if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "coupon code already exists"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	logAudit(c.GetInt("user_id"), action, "promotions", p.ID, gin.H{
+		"name":   p.Name,
+		"code":   p.Code,
+		"type":   p.Type,
+		"value":  p.Value,
+		"active": p.Active,
+	}, c)
+	c.JSON(status, p)
+}
+
+// @Summary Create promotion
+// @Description Without code the promotion applies automatically (e.g. a category-wide sale); with code the customer has to enter it.
+// @Tags Promotions
+// @Accept json
+// @Produce json
+// @Param promotion body PromotionRequest true "Promotion"
+// @Success 201 {object} Promotion
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} ValidationErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /promotions [post]
+// @security ApiKeyAuth
+func createPromotion(c *gin.Context) {
+	req, ok := bindPromotion(c)
+	if !ok {
+		return
+	}
+	p, err := scanPromotion(db.QueryRow(`
+		INSERT INTO promotions (name, code, promo_type, value, buy_quantity, get_quantity, category_id, min_spend,
+		                        starts_at, ends_at, usage_limit, per_user_limit, stackable, priority, active)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		RETURNING `+promotionColumns, promotionArgs(req)...))
+	respondSavedPromotion(c, http.StatusCreated, "create", p, err)
+}
+
+// @Summary Update promotion
+// @Description Replaces every field. Changes apply to new quotes and orders only.
+// @Tags Promotions
+// @Accept json
+// @Produce json
+// @Param id path int true "Promotion ID"
+// @Param promotion body PromotionRequest true "Promotion"
+// @Success 200 {object} Promotion
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} ValidationErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /promotions/{id} [put]
+// @security ApiKeyAuth
+func updatePromotion(c *gin.Context) {
+	id, ok := parsePromotionID(c)
+	if !ok {
+		return
+	}
+	req, ok := bindPromotion(c)
+	if !ok {
+		return
+	}
+	p, err := scanPromotion(db.QueryRow(`
+		UPDATE promotions
+		SET name = $1, code = NULLIF($2, ''), promo_type = $3, value = $4, buy_quantity = $5, get_quantity = $6,
+		    category_id = $7, min_spend = $8, starts_at = $9, ends_at = $10, usage_limit = $11,
+		    per_user_limit = $12, stackable = $13, priority = $14, active = $15, updated_at = NOW()
+		WHERE id = $16
+		RETURNING `+promotionColumns, append(promotionArgs(req), id)...))
+	respondSavedPromotion(c, http.StatusOK, "update", p, err)
+}
+
+// @Summary Delete promotion
+// @Description Promotions that were used in an order can't be deleted; set active to false instead.
+// @Tags Promotions
+// @Produce json
+// @Param id path int true "Promotion ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /promotions/{id} [delete]
+// @security ApiKeyAuth
+func deletePromotion(c *gin.Context) {
+	id, ok := parsePromotionID(c)
+	if !ok {
+		return
+	}
+
+	var used bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM promotion_redemptions WHERE promotion_id = $1)", id).Scan(&used); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if used {
+		c.JSON(http.StatusConflict, gin.H{"error": "promotion has been used in orders, set active to false instead"})
+		return
+	}
+
+	var name, code string
+	err := db.QueryRow("DELETE FROM promotions WHERE id = $1 RETURNING name, COALESCE(code, '')", id).Scan(&name, &code)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "promotion not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	logAudit(c.GetInt("user_id"), "delete", "promotions", id, gin.H{"name": name, "code": code}, c)
+	c.JSON(http.StatusOK, gin.H{"message": "promotion deleted successfully"})
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// ===================== Promotion Models =====================
+type Promotion struct {
+	ID           int        `json:"id"`
+	Name         string     `json:"name"`
+	Code         string     `json:"code,omitempty"` // ว่าง = ใช้อัตโนมัติ ไม่ต้องกรอกโค้ด
+	Type         string     `json:"type"`           // percent_off, amount_off, buy_x_get_y
+	Value        float64    `json:"value"`          // percent_off/buy_x_get_y: เปอร์เซ็นต์ (100 = แถมฟรี), amount_off: บาท
+	BuyQuantity  int        `json:"buy_quantity,omitempty"`
+	GetQuantity  int        `json:"get_quantity,omitempty"`
+	CategoryID   *int       `json:"category_id,omitempty"` // null = ทุกหมวด, มีค่า = หมวดนี้และหมวดย่อย
+	MinSpend     Money      `json:"min_spend"`             // ยอดของรายการที่เข้าเงื่อนไข
+	StartsAt     *time.Time `json:"starts_at,omitempty"`
+	EndsAt       *time.Time `json:"ends_at,omitempty"`
+	UsageLimit   *int       `json:"usage_limit,omitempty"`
+	PerUserLimit *int       `json:"per_user_limit,omitempty"`
+	Stackable    bool       `json:"stackable"` // ใช้ร่วมกับโปรที่ stackable ด้วยกันได้
+	Priority     int        `json:"priority"`  // มากกว่าคิดก่อน
+	Active       bool       `json:"active"`
+	TimesUsed    int        `json:"times_used"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+type PromotionRequest struct {
+	Name         string     `json:"name" binding:"required,max=100"`
+	Code         string     `json:"code" binding:"omitempty,min=3,max=50,alphanum"`
+	Type         string     `json:"type" binding:"required,oneof=percent_off amount_off buy_x_get_y"`
+	Value        float64    `json:"value" binding:"gt=0"`
+	BuyQuantity  int        `json:"buy_quantity" binding:"omitempty,min=1,max=100"`
+	GetQuantity  int        `json:"get_quantity" binding:"omitempty,min=1,max=100"`
+	CategoryID   *int       `json:"category_id"`
+	MinSpend     float64    `json:"min_spend" binding:"gte=0"`
+	StartsAt     *time.Time `json:"starts_at"`
+	EndsAt       *time.Time `json:"ends_at"`
+	UsageLimit   *int       `json:"usage_limit" binding:"omitempty,min=1"`
+	PerUserLimit *int       `json:"per_user_limit" binding:"omitempty,min=1"`
+	Stackable    bool       `json:"stackable"`
+	Priority     int        `json:"priority"`
+	Active       *bool      `json:"active"` // ไม่ส่ง = true
+}
+
+type QuoteLine struct {
+	BookID    int    `json:"book_id"`
+	Title     string `json:"title"`
+	Quantity  int    `json:"quantity"`
+	UnitPrice Money  `json:"unit_price"`
+	LineTotal Money  `json:"line_total"` // ก่อนหักโปรโมชัน
+	Discount  Money  `json:"discount"`
+	Total     Money  `json:"total"`
+
+	categoryIDs []int // หมวดของหนังสือและหมวดแม่ทุกชั้น
+}
+
+type AppliedPromotion struct {
+	PromotionID int    `json:"promotion_id"`
+	Name        string `json:"name"`
+	Code        string `json:"code,omitempty"`
+	Discount    Money  `json:"discount"`
+}
+
+// RejectedCode บอกว่าทำไมโค้ดที่กรอกมาใช้ไม่ได้
+// reason: not_found, inactive, not_started, expired, usage_limit_reached, user_limit_reached,
+// no_eligible_items, min_spend_not_met, quantity_not_met, not_combinable
+type RejectedCode struct {
+	Code   string `json:"code"`
+	Reason string `json:"reason"`
+}
+
+// Quote: subtotal - discount = ยอดสินค้า ถ้าราคารวม VAT แล้ว total เท่ากับยอดนั้น
+// ถ้าไม่รวม total = ยอดนั้น + vat
+type Quote struct {
+	Lines            []QuoteLine        `json:"lines"`
+	Subtotal         Money              `json:"subtotal"`
+	Discount         Money              `json:"discount"`
+	VATRate          float64            `json:"vat_rate"` // เปอร์เซ็นต์
+	VAT              Money              `json:"vat"`
+	PricesIncludeVAT bool               `json:"prices_include_vat"`
+	Total            Money              `json:"total"` // ยอดที่ต้องจ่าย
+	Applied          []AppliedPromotion `json:"applied"`
+	Rejected         []RejectedCode     `json:"rejected,omitempty"`
+}
+
+// promotionUsage นับการใช้โปรโมชันทั้งหมด และของ user ที่ขอ quote
+type promotionUsage struct {
+	Total  int
+	ByUser int
+}
+
+// ===================== Promotion Engine =====================
+// ไม่แตะ database เลย ทุกอย่างที่ต้องใช้ส่งเข้ามาเป็น argument จึงคำนวณซ้ำได้ผลเดิมเสมอ
+// เงินทุกก้อนเป็น Money (สตางค์) เพื่อไม่ให้ทศนิยมของ float เพี้ยน
+
+func normalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// promotionAvailability checks everything about p that doesn't depend on
+// the basket. It returns "" when p can be used.
+func promotionAvailability(p Promotion, usage promotionUsage, now time.Time) string {
+	switch {
+	case !p.Active:
+		return "inactive"
+	case p.StartsAt != nil && now.Before(*p.StartsAt):
+		return "not_started"
+	case p.EndsAt != nil && !now.Before(*p.EndsAt):
+		return "expired"
+	case p.UsageLimit != nil && usage.Total >= *p.UsageLimit:
+		return "usage_limit_reached"
+	case p.PerUserLimit != nil && usage.ByUser >= *p.PerUserLimit:
+		return "user_limit_reached"
+	}
+	return ""
+}
+
+func promotionCovers(p Promotion, line QuoteLine) bool {
+	if p.CategoryID == nil {
+		return true
+	}
+	for _, id := range line.categoryIDs {
+		if id == *p.CategoryID {
+			return true
+		}
+	}
+	return false
+}
+
+// promotionDiscounts works out p's discount on each line given what is
+// still payable per line (amounts, in satang). It returns the reason when
+// p gives nothing.
+func promotionDiscounts(p Promotion, lines []QuoteLine, amounts []Money) ([]Money, string) {
+	discounts := make([]Money, len(lines))
+
+	var eligible []int
+	var eligibleTotal Money
+	for i, line := range lines {
+		if amounts[i] > 0 && promotionCovers(p, line) {
+			eligible = append(eligible, i)
+			eligibleTotal += amounts[i]
+		}
+	}
+	if len(eligible) == 0 {
+		return nil, "no_eligible_items"
+	}
+	if eligibleTotal < p.MinSpend {
+		return nil, "min_spend_not_met"
+	}
+
+	switch p.Type {
+	case "percent_off":
+		for _, i := range eligible {
+			discounts[i] = percentOf(amounts[i], p.Value)
+		}
+
+	case "amount_off":
+		// กระจายส่วนลดตามสัดส่วนยอดแต่ละบรรทัด เศษสตางค์ไล่ใส่ทีละบรรทัดตามลำดับ
+		off := moneyFromFloat(p.Value)
+		if off > eligibleTotal {
+			off = eligibleTotal
+		}
+		var given Money
+		for _, i := range eligible {
+			discounts[i] = off * amounts[i] / eligibleTotal
+			given += discounts[i]
+		}
+		for _, i := range eligible {
+			if given == off {
+				break
+			}
+			if discounts[i] < amounts[i] {
+				discounts[i]++
+				given++
+			}
+		}
+
+	case "buy_x_get_y":
+		// เรียงทุกชิ้นจากแพงไปถูก ทุกกลุ่ม buy+get ชิ้น ลดให้ get ชิ้นที่ถูกที่สุดของกลุ่ม
+		type unit struct {
+			line   int
+			amount Money
+		}
+		var units []unit
+		for _, i := range eligible {
+			qty := lines[i].Quantity
+			for n := 0; n < qty; n++ {
+				// ชิ้นสุดท้ายของบรรทัดได้เศษสตางค์ไป ผลรวมต่อบรรทัดจะเท่ากับ amounts[i] พอดี
+				share := amounts[i] / Money(qty)
+				if n == qty-1 {
+					share = amounts[i] - share.Mul(qty-1)
+				}
+				units = append(units, unit{line: i, amount: share})
+			}
+		}
+		sort.SliceStable(units, func(a, b int) bool { return units[a].amount > units[b].amount })
+
+		group := p.BuyQuantity + p.GetQuantity
+		if group <= 0 || len(units) < group {
+			return nil, "quantity_not_met"
+		}
+		for start := 0; start+group <= len(units); start += group {
+			for _, u := range units[start+p.BuyQuantity : start+group] {
+				discounts[u.line] += percentOf(u.amount, p.Value)
+			}
+		}
+	}
+
+	var total Money
+	for i := range discounts {
+		if discounts[i] > amounts[i] {
+			discounts[i] = amounts[i]
+		}
+		total += discounts[i]
+	}
+	if total == 0 {
+		return nil, "no_eligible_items"
+	}
+	return discounts, ""
+}
+
+func percentOf(amount Money, percent float64) Money {
+	if percent > 100 {
+		percent = 100
+	}
+	return amount.Percent(percent)
+}
+
+// promotionOption is one way to combine promotions: a single
+// non-stackable promotion, or every stackable one applied in order.
+type promotionOption struct {
+	promos    []Promotion
+	discounts [][]Money // ต่อโปร ต่อบรรทัด
+	total     Money
+	skipped   map[int]string // โปรที่ตกเงื่อนไขเมื่อคิดต่อจากโปรก่อนหน้า
+}
+
+func applyPromotionOption(promos []Promotion, lines []QuoteLine, base []Money) promotionOption {
+	opt := promotionOption{skipped: map[int]string{}}
+	amounts := append([]Money(nil), base...)
+	for _, p := range promos {
+		discounts, reason := promotionDiscounts(p, lines, amounts)
+		if reason != "" {
+			opt.skipped[p.ID] = reason
+			continue
+		}
+		for i, d := range discounts {
+			amounts[i] -= d
+			opt.total += d
+		}
+		opt.promos = append(opt.promos, p)
+		opt.discounts = append(opt.discounts, discounts)
+	}
+	return opt
+}
+
+// priceQuote prices lines for one user. Automatic promotions (no code)
+// always take part; promotions with a code only when it is in codes.
+// Stacking rule: either every available stackable promotion applied in
+// priority order (each on what the previous ones left), or one
+// non-stackable promotion on its own, whichever saves the customer more.
+// Ties go to the stackable set, then to the higher-priority promotion.
+// Every code that ends up unused is listed in Rejected with the reason.
+func priceQuote(lines []QuoteLine, promos []Promotion, codes []string, usage map[int]promotionUsage, now time.Time) Quote {
+	quote := Quote{Lines: make([]QuoteLine, len(lines)), Applied: []AppliedPromotion{}}
+	copy(quote.Lines, lines)
+
+	base := make([]Money, len(lines))
+	var subtotal Money
+	for i := range quote.Lines {
+		base[i] = quote.Lines[i].UnitPrice.Mul(quote.Lines[i].Quantity)
+		subtotal += base[i]
+	}
+
+	// โค้ดที่กรอกมา (ไม่สนตัวพิมพ์ ซ้ำกันนับครั้งเดียว) ตามลำดับที่ส่งมา
+	var entered []string
+	wanted := map[string]bool{}
+	for _, code := range codes {
+		code = normalizeCouponCode(code)
+		if code != "" && !wanted[code] {
+			wanted[code] = true
+			entered = append(entered, code)
+		}
+	}
+
+	rejected := map[string]string{}
+	found := map[string]bool{}
+	var candidates []Promotion
+	for _, p := range promos {
+		if p.Code != "" {
+			if !wanted[p.Code] {
+				continue
+			}
+			found[p.Code] = true
+		}
+		if reason := promotionAvailability(p, usage[p.ID], now); reason != "" {
+			if p.Code != "" {
+				rejected[p.Code] = reason
+			}
+			continue
+		}
+		candidates = append(candidates, p)
+	}
+	for _, code := range entered {
+		if !found[code] {
+			rejected[code] = "not_found"
+		}
+	}
+	sort.SliceStable(candidates, func(a, b int) bool {
+		if candidates[a].Priority != candidates[b].Priority {
+			return candidates[a].Priority > candidates[b].Priority
+		}
+		return candidates[a].ID < candidates[b].ID
+	})
+
+	var stackable []Promotion
+	var options []promotionOption
+	for _, p := range candidates {
+		if p.Stackable {
+			stackable = append(stackable, p)
+		}
+	}
+	options = append(options, applyPromotionOption(stackable, quote.Lines, base))
+	for _, p := range candidates {
+		if !p.Stackable {
+			options = append(options, applyPromotionOption([]Promotion{p}, quote.Lines, base))
+		}
+	}
+
+	best := options[0]
+	for _, opt := range options[1:] {
+		if opt.total > best.total {
+			best = opt
+		}
+	}
+
+	// โค้ดที่ไม่ได้ใช้: ถ้าตกเงื่อนไขในแบบของตัวเองใช้เหตุผลนั้น ไม่งั้นแปลว่าแพ้แบบที่ลดได้มากกว่า
+	used := map[int]bool{}
+	for _, p := range best.promos {
+		used[p.ID] = true
+	}
+	for _, p := range candidates {
+		if p.Code == "" || used[p.ID] {
+			continue
+		}
+		reason := "not_combinable"
+		for _, opt := range options {
+			if r, ok := opt.skipped[p.ID]; ok {
+				reason = r
+			}
+		}
+		rejected[p.Code] = reason
+	}
+
+	lineDiscount := make([]Money, len(lines))
+	var discount Money
+	for n, p := range best.promos {
+		var promoTotal Money
+		for i, d := range best.discounts[n] {
+			lineDiscount[i] += d
+			promoTotal += d
+		}
+		discount += promoTotal
+		quote.Applied = append(quote.Applied, AppliedPromotion{
+			PromotionID: p.ID, Name: p.Name, Code: p.Code, Discount: promoTotal,
+		})
+	}
+	for i := range quote.Lines {
+		quote.Lines[i].LineTotal = base[i]
+		quote.Lines[i].Discount = lineDiscount[i]
+		quote.Lines[i].Total = base[i] - lineDiscount[i]
+	}
+
+	for _, code := range entered {
+		if reason, ok := rejected[code]; ok {
+			quote.Rejected = append(quote.Rejected, RejectedCode{Code: code, Reason: reason})
+		}
+	}
+	quote.Subtotal = subtotal
+	quote.Discount = discount
+	quote.Total = subtotal - discount
+	return quote
+}
+
+// applyVAT คิด VAT จากยอดหลังหักส่วนลด (ฐานภาษีคือราคาที่ขายจริง)
+func applyVAT(quote Quote, tax taxConfig) Quote {
+	_, vat, gross := tax.breakdown(quote.Subtotal - quote.Discount)
+	quote.VATRate = tax.RatePercent()
+	quote.VAT = vat
+	quote.PricesIncludeVAT = tax.PricesIncludeVAT
+	quote.Total = gross
+	return quote
+}
+
+// validatePromotion ตรวจเงื่อนไขที่ binding tag บอกไม่ได้ (ข้าม field กัน)
+func validatePromotion(req PromotionRequest) []FieldError {
+	var fields []FieldError
+	if req.Type != "amount_off" && req.Value > 100 {
+		fields = append(fields, FieldError{Field: "value", Code: "max", Param: "100",
+			Message: "must be at most 100 percent for " + req.Type})
+	}
+	if req.Type == "buy_x_get_y" {
+		if req.BuyQuantity == 0 {
+			fields = append(fields, FieldError{Field: "buy_quantity", Code: "required", Message: "is required for buy_x_get_y"})
+		}
+		if req.GetQuantity == 0 {
+			fields = append(fields, FieldError{Field: "get_quantity", Code: "required", Message: "is required for buy_x_get_y"})
+		}
+	}
+	if req.StartsAt != nil && req.EndsAt != nil && !req.EndsAt.After(*req.StartsAt) {
+		fields = append(fields, FieldError{Field: "ends_at", Code: "gtfield", Param: "starts_at", Message: "must be after starts_at"})
+	}
+	return fields
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func intPtr(n int) *int {
+	return &n
+}
+
+// testLine สร้างบรรทัดของ quote ราคาเป็นบาทแบบ string เช่น "55.55"
+func testLine(t *testing.T, bookID int, price string, quantity int, categoryIDs ...int) QuoteLine {
+	t.Helper()
+	unit, err := parseMoney(price)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return QuoteLine{BookID: bookID, Quantity: quantity, UnitPrice: unit, categoryIDs: categoryIDs}
+}
+
+func lineAmounts(lines []QuoteLine) []Money {
+	amounts := make([]Money, len(lines))
+	for i, line := range lines {
+		amounts[i] = line.UnitPrice.Mul(line.Quantity)
+	}
+	return amounts
+}
+
+func TestPromotionDiscounts(t *testing.T) {
+	tests := []struct {
+		name   string
+		promo  Promotion
+		lines  []QuoteLine
+		want   []Money
+		reason string
+	}{
+		{
+			name:  "percent_off rounds each line to the satang",
+			promo: Promotion{Type: "percent_off", Value: 10},
+			lines: []QuoteLine{testLine(t, 1, "100.00", 2), testLine(t, 2, "55.55", 1)},
+			want:  []Money{2000, 556},
+		},
+		{
+			name:  "percent_off only on the promotion's category and its children",
+			promo: Promotion{Type: "percent_off", Value: 20, CategoryID: intPtr(1)},
+			lines: []QuoteLine{testLine(t, 1, "100.00", 1, 5, 1), testLine(t, 2, "100.00", 1, 2)},
+			want:  []Money{2000, 0},
+		},
+		{
+			name:  "percent_off above 100 gives the line away, no more",
+			promo: Promotion{Type: "percent_off", Value: 150},
+			lines: []QuoteLine{testLine(t, 1, "80.00", 1)},
+			want:  []Money{8000},
+		},
+		{
+			name:  "amount_off split by line amount",
+			promo: Promotion{Type: "amount_off", Value: 10},
+			lines: []QuoteLine{testLine(t, 1, "30.00", 1), testLine(t, 2, "10.00", 1)},
+			want:  []Money{750, 250},
+		},
+		{
+			name:  "amount_off satang remainder goes to the first lines",
+			promo: Promotion{Type: "amount_off", Value: 10},
+			lines: []QuoteLine{testLine(t, 1, "10.00", 1), testLine(t, 2, "10.00", 1), testLine(t, 3, "10.00", 1)},
+			want:  []Money{334, 333, 333},
+		},
+		{
+			name:  "amount_off capped at the eligible total",
+			promo: Promotion{Type: "amount_off", Value: 50},
+			lines: []QuoteLine{testLine(t, 1, "30.00", 1)},
+			want:  []Money{3000},
+		},
+		{
+			name:  "buy_x_get_y frees the cheapest item of each group",
+			promo: Promotion{Type: "buy_x_get_y", Value: 100, BuyQuantity: 2, GetQuantity: 1},
+			lines: []QuoteLine{testLine(t, 1, "300.00", 2), testLine(t, 2, "100.00", 1), testLine(t, 3, "200.00", 1)},
+			// ชิ้นเรียงแพงไปถูก: 300, 300, 200 | 100 กลุ่มแรกได้ 200 ฟรี ชิ้นสุดท้ายไม่ครบกลุ่ม
+			want: []Money{0, 0, 20000},
+		},
+		{
+			name:  "buy_x_get_y counts several groups on one line",
+			promo: Promotion{Type: "buy_x_get_y", Value: 50, BuyQuantity: 1, GetQuantity: 1},
+			lines: []QuoteLine{testLine(t, 1, "100.00", 4)},
+			want:  []Money{10000},
+		},
+		{
+			name:   "buy_x_get_y needs a full group",
+			promo:  Promotion{Type: "buy_x_get_y", Value: 100, BuyQuantity: 2, GetQuantity: 1},
+			lines:  []QuoteLine{testLine(t, 1, "100.00", 2)},
+			reason: "quantity_not_met",
+		},
+		{
+			name:   "min_spend counts eligible lines only",
+			promo:  Promotion{Type: "percent_off", Value: 10, CategoryID: intPtr(1), MinSpend: 15000},
+			lines:  []QuoteLine{testLine(t, 1, "100.00", 1, 1), testLine(t, 2, "100.00", 1, 2)},
+			reason: "min_spend_not_met",
+		},
+		{
+			name:  "min_spend met exactly",
+			promo: Promotion{Type: "percent_off", Value: 10, MinSpend: 10000},
+			lines: []QuoteLine{testLine(t, 1, "100.00", 1)},
+			want:  []Money{1000},
+		},
+		{
+			name:   "no line in the category",
+			promo:  Promotion{Type: "percent_off", Value: 10, CategoryID: intPtr(9)},
+			lines:  []QuoteLine{testLine(t, 1, "100.00", 1, 1)},
+			reason: "no_eligible_items",
+		},
+		{
+			name:   "discount rounds to nothing",
+			promo:  Promotion{Type: "percent_off", Value: 1},
+			lines:  []QuoteLine{testLine(t, 1, "0.25", 1)},
+			reason: "no_eligible_items",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := promotionDiscounts(tt.promo, tt.lines, lineAmounts(tt.lines))
+			if reason != tt.reason {
+				t.Fatalf("reason = %q, want %q", reason, tt.reason)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("discounts = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromotionAvailability(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	before, after := now.Add(-time.Hour), now.Add(time.Hour)
+
+	tests := []struct {
+		name  string
+		promo Promotion
+		usage promotionUsage
+		want  string
+	}{
+		{"available", Promotion{Active: true, StartsAt: &before, EndsAt: &after}, promotionUsage{}, ""},
+		{"inactive", Promotion{Active: false}, promotionUsage{}, "inactive"},
+		{"not started", Promotion{Active: true, StartsAt: &after}, promotionUsage{}, "not_started"},
+		{"starts now", Promotion{Active: true, StartsAt: &now}, promotionUsage{}, ""},
+		{"expired", Promotion{Active: true, EndsAt: &before}, promotionUsage{}, "expired"},
+		{"ends now", Promotion{Active: true, EndsAt: &now}, promotionUsage{}, "expired"},
+		{"usage below limit", Promotion{Active: true, UsageLimit: intPtr(5)}, promotionUsage{Total: 4}, ""},
+		{"usage limit reached", Promotion{Active: true, UsageLimit: intPtr(5)}, promotionUsage{Total: 5}, "usage_limit_reached"},
+		{"user below limit", Promotion{Active: true, PerUserLimit: intPtr(2)}, promotionUsage{Total: 9, ByUser: 1}, ""},
+		{"user limit reached", Promotion{Active: true, PerUserLimit: intPtr(2)}, promotionUsage{ByUser: 2}, "user_limit_reached"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := promotionAvailability(tt.promo, tt.usage, now); got != tt.want {
+				t.Errorf("promotionAvailability = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func appliedIDs(quote Quote) []int {
+	ids := []int{}
+	for _, a := range quote.Applied {
+		ids = append(ids, a.PromotionID)
+	}
+	return ids
+}
+
+func TestPriceQuoteStacking(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		promos       []Promotion
+		codes        []string
+		wantApplied  []int
+		wantDiscount Money
+		wantRejected []RejectedCode
+	}{
+		{
+			name: "stackable promotions apply in priority order on what is left",
+			promos: []Promotion{
+				{ID: 2, Type: "amount_off", Value: 10, Stackable: true, Priority: 5, Active: true},
+				{ID: 1, Type: "percent_off", Value: 10, Stackable: true, Priority: 10, Active: true},
+				{ID: 3, Type: "percent_off", Value: 15, Active: true},
+			},
+			// 10% ของ 100 = 10 แล้วลดอีก 10 บาท = 20 มากกว่าโปรเดี่ยว 15%
+			wantApplied:  []int{1, 2},
+			wantDiscount: 2000,
+		},
+		{
+			name: "best single non-stackable beats the stack",
+			promos: []Promotion{
+				{ID: 1, Type: "percent_off", Value: 10, Stackable: true, Active: true},
+				{ID: 2, Code: "BIG", Type: "percent_off", Value: 25, Active: true},
+			},
+			codes:        []string{"big"},
+			wantApplied:  []int{2},
+			wantDiscount: 2500,
+		},
+		{
+			name: "tie between the stack and a single goes to the stack",
+			promos: []Promotion{
+				{ID: 1, Type: "percent_off", Value: 10, Stackable: true, Active: true},
+				{ID: 2, Code: "TEN", Type: "percent_off", Value: 10, Active: true},
+			},
+			codes:        []string{"TEN"},
+			wantApplied:  []int{1},
+			wantDiscount: 1000,
+			wantRejected: []RejectedCode{{Code: "TEN", Reason: "not_combinable"}},
+		},
+		{
+			name: "tie between singles goes to the higher priority",
+			promos: []Promotion{
+				{ID: 1, Code: "LOW", Type: "percent_off", Value: 10, Priority: 1, Active: true},
+				{ID: 2, Code: "HIGH", Type: "amount_off", Value: 10, Priority: 5, Active: true},
+			},
+			codes:        []string{"LOW", "HIGH"},
+			wantApplied:  []int{2},
+			wantDiscount: 1000,
+			wantRejected: []RejectedCode{{Code: "LOW", Reason: "not_combinable"}},
+		},
+		{
+			name: "tie at the same priority goes to the lower id",
+			promos: []Promotion{
+				{ID: 7, Code: "SEVEN", Type: "percent_off", Value: 10, Active: true},
+				{ID: 4, Code: "FOUR", Type: "percent_off", Value: 10, Active: true},
+			},
+			codes:        []string{"SEVEN", "FOUR"},
+			wantApplied:  []int{4},
+			wantDiscount: 1000,
+			wantRejected: []RejectedCode{{Code: "SEVEN", Reason: "not_combinable"}},
+		},
+		{
+			name: "stackable code that fails after the others keeps its reason",
+			promos: []Promotion{
+				{ID: 1, Type: "amount_off", Value: 60, Stackable: true, Priority: 10, Active: true},
+				{ID: 2, Code: "MIN50", Type: "percent_off", Value: 10, Stackable: true, MinSpend: 5000, Active: true},
+			},
+			codes:        []string{"MIN50"},
+			wantApplied:  []int{1},
+			wantDiscount: 6000,
+			wantRejected: []RejectedCode{{Code: "MIN50", Reason: "min_spend_not_met"}},
+		},
+		{
+			name:         "no promotions",
+			wantApplied:  []int{},
+			wantDiscount: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := []QuoteLine{testLine(t, 1, "100.00", 1)}
+			quote := priceQuote(lines, tt.promos, tt.codes, nil, now)
+			if got := appliedIDs(quote); !reflect.DeepEqual(got, tt.wantApplied) {
+				t.Errorf("applied = %v, want %v", got, tt.wantApplied)
+			}
+			if quote.Discount != tt.wantDiscount {
+				t.Errorf("discount = %v, want %v", quote.Discount, tt.wantDiscount)
+			}
+			if quote.Total != quote.Subtotal-tt.wantDiscount {
+				t.Errorf("total = %v, want %v", quote.Total, quote.Subtotal-tt.wantDiscount)
+			}
+			if !reflect.DeepEqual(quote.Rejected, tt.wantRejected) {
+				t.Errorf("rejected = %v, want %v", quote.Rejected, tt.wantRejected)
+			}
+		})
+	}
+}
+
+func TestPriceQuoteRejectedCodes(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	before, after := now.Add(-time.Hour), now.Add(time.Hour)
+
+	promos := []Promotion{
+		{ID: 1, Code: "OFF", Type: "percent_off", Value: 10, Active: false},
+		{ID: 2, Code: "SOON", Type: "percent_off", Value: 10, Active: true, StartsAt: &after},
+		{ID: 3, Code: "OLD", Type: "percent_off", Value: 10, Active: true, EndsAt: &before},
+		{ID: 4, Code: "FULL", Type: "percent_off", Value: 10, Active: true, UsageLimit: intPtr(5)},
+		{ID: 5, Code: "MINE", Type: "percent_off", Value: 10, Active: true, PerUserLimit: intPtr(1)},
+		{ID: 6, Code: "KIDS", Type: "percent_off", Value: 10, Active: true, CategoryID: intPtr(9)},
+		{ID: 7, Code: "BIGSPEND", Type: "percent_off", Value: 10, Active: true, MinSpend: 100000},
+		{ID: 8, Code: "B2G1", Type: "buy_x_get_y", Value: 100, BuyQuantity: 2, GetQuantity: 1, Active: true},
+		{ID: 9, Code: "SMALL", Type: "percent_off", Value: 5, Active: true},
+		{ID: 10, Code: "BEST", Type: "percent_off", Value: 20, Active: true},
+	}
+	usage := map[int]promotionUsage{4: {Total: 5}, 5: {Total: 1, ByUser: 1}}
+	codes := []string{"gone", "OFF", "SOON", "OLD", "FULL", "MINE", "KIDS", "BIGSPEND", "B2G1", "SMALL", "best", " BEST "}
+	lines := []QuoteLine{testLine(t, 1, "100.00", 1, 2)}
+
+	quote := priceQuote(lines, promos, codes, usage, now)
+
+	want := []RejectedCode{
+		{Code: "GONE", Reason: "not_found"},
+		{Code: "OFF", Reason: "inactive"},
+		{Code: "SOON", Reason: "not_started"},
+		{Code: "OLD", Reason: "expired"},
+		{Code: "FULL", Reason: "usage_limit_reached"},
+		{Code: "MINE", Reason: "user_limit_reached"},
+		{Code: "KIDS", Reason: "no_eligible_items"},
+		{Code: "BIGSPEND", Reason: "min_spend_not_met"},
+		{Code: "B2G1", Reason: "quantity_not_met"},
+		{Code: "SMALL", Reason: "not_combinable"},
+	}
+	if !reflect.DeepEqual(quote.Rejected, want) {
+		t.Errorf("rejected =\n%v\nwant\n%v", quote.Rejected, want)
+	}
+	if got := appliedIDs(quote); !reflect.DeepEqual(got, []int{10}) {
+		t.Errorf("applied = %v, want [10]", got)
+	}
+	if quote.Lines[0].Discount != 2000 || quote.Lines[0].Total != 8000 {
+		t.Errorf("line = %+v, want discount 20.00 and total 80.00", quote.Lines[0])
+	}
+
+	// engine ไม่มี state ให้ค่าเดิมได้ผลเดิมเสมอ
+	if again := priceQuote(lines, promos, codes, usage, now); !reflect.DeepEqual(again, quote) {
+		t.Error("priceQuote is not deterministic")
+	}
+}
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// ===================== Recommendation Models =====================
+type RecommendedBook struct {
+	BookID        int      `json:"book_id"`
+	Title         string   `json:"title"`
+	Author        string   `json:"author"`
+	CoverImage    string   `json:"cover_image,omitempty"`
+	Price         Money    `json:"price"`
+	Rating        float64  `json:"rating"`
+	Score         float64  `json:"score,omitempty"`
+	Reasons       []string `json:"reasons,omitempty"`         // customers_also_viewed, same_author, same_category
+	BecauseBookID *int     `json:"because_book_id,omitempty"` // เฉพาะคำแนะนำของ user
+}
+
+// RecommendationList บอกด้วยว่ารายการมาจากไหน
+// computed = ผลของ job, similar = ผู้แต่ง/หมวดเดียวกัน (job ยังไม่ได้คำนวณเล่มนี้), featured = user ใหม่ที่ยังไม่มีประวัติ
+type RecommendationList struct {
+	Source     string            `json:"source"`
+	ComputedAt *time.Time        `json:"computed_at,omitempty"`
+	Items      []RecommendedBook `json:"items"`
+}
+
+// RecommendationBuild สรุปผลการคำนวณหนึ่งรอบ
+type RecommendationBuild struct {
+	Books               int   `json:"books"`
+	Users               int   `json:"users"`
+	RelatedPairs        int   `json:"related_pairs"`
+	UserRecommendations int   `json:"user_recommendations"`
+	DurationMS          int64 `json:"duration_ms"`
+}
+
+const (
+	relatedPerBook          = 20
+	recommendationsPerUser  = 50
+	recommendedBookColumns  = `b.id, b.title, b.author, COALESCE(b.cover_image, ''), b.price, COALESCE(b.rating, 0)`
+	purchasedOrderStatusSQL = `('paid', 'shipped', 'delivered')`
+)
+
+// ===================== Book Views =====================
+// recordBookView นับการเปิดดูหนังสือ พลาดก็แค่ log ไม่ให้กระทบการดูหนังสือ
+func recordBookView(userID, bookID int) {
+	if userID == 0 {
+		return
+	}
+	_, err := db.Exec(`
+		INSERT INTO book_views (user_id, book_id) VALUES ($1, $2)
+		ON CONFLICT (user_id, book_id, viewed_on) DO UPDATE SET views = book_views.views + 1
+	`, userID, bookID)
+	if err != nil {
+		log.Printf("record book view failed: %v", err)
+	}
+}
+
+// ===================== Recommendation Builder =====================
+func recommendationWindowDays() int {
+	days, err := strconv.Atoi(getEnv("RECOMMENDATION_WINDOW_DAYS", "180"))
+	if err != nil || days < 1 {
+		log.Printf("invalid RECOMMENDATION_WINDOW_DAYS, using 180 days")
+		days = 180
+	}
+	return days
+}
+
+func recommendationInterval() time.Duration {
+	hours, err := strconv.Atoi(getEnv("RECOMMENDATION_INTERVAL_HOURS", "6"))
+	if err != nil || hours < 1 {
+		log.Printf("invalid RECOMMENDATION_INTERVAL_HOURS, using 6 hours")
+		hours = 6
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// rebuildLock คือ key ของ advisory lock ให้ rebuild รันทีละ instance แม้มีหลาย replica
+const rebuildLock = 130025
+
+var (
+	rebuildMu            sync.Mutex
+	errRebuildInProgress = errors.New("recommendations are already being rebuilt")
+)
+
+// loadRecommendationInputs reads the catalog and every user's views,
+// purchases and published reviews from the last windowDays days.
+func loadRecommendationInputs(windowDays int) ([]recBook, []userSignal, error) {
+	rows, err := db.Query(`
+		SELECT id, author, COALESCE(category_id, 0), COALESCE(rating, 0)
+		FROM books
+		WHERE deleted_at IS NULL
+	`)
+	if err != nil {
+		return nil, nil, err
+	}
+	var books []recBook
+	for rows.Next() {
+		var b recBook
+		if err := rows.Scan(&b.ID, &b.Author, &b.CategoryID, &b.Rating); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		books = append(books, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	rows, err = db.Query(`
+		SELECT user_id, book_id, SUM(view_days)::int, BOOL_OR(purchased), MAX(rating)::int
+		FROM (
+			SELECT user_id, book_id, COUNT(*) AS view_days, FALSE AS purchased, 0 AS rating
+			FROM book_views
+			WHERE viewed_on >= CURRENT_DATE - $1::int
+			GROUP BY user_id, book_id
+			UNION ALL
+			SELECT o.user_id, oi.book_id, 0, TRUE, 0
+			FROM orders o
+			JOIN order_items oi ON oi.order_id = o.id
+			WHERE o.status IN `+purchasedOrderStatusSQL+`
+			  AND o.user_id IS NOT NULL AND oi.book_id IS NOT NULL
+			  AND o.created_at >= CURRENT_DATE - $1::int
+			UNION ALL
+			SELECT user_id, book_id, 0, FALSE, rating
+			FROM reviews
+			WHERE status = 'published' AND book_id IS NOT NULL AND updated_at >= CURRENT_DATE - $1::int
+		) s
+		GROUP BY user_id, book_id
+	`, windowDays)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var signals []userSignal
+	for rows.Next() {
+		var s userSignal
+		if err := rows.Scan(&s.UserID, &s.BookID, &s.ViewDays, &s.Purchased, &s.Rating); err != nil {
+			return nil, nil, err
+		}
+		signals = append(signals, s)
+	}
+	return books, signals, rows.Err()
+}
+
+// rebuildRecommendations recomputes related books and per-user
+// recommendations and replaces both tables in one transaction, so readers
+// see either the old results or the new ones. Only one rebuild runs at a
+// time across all replicas (rebuildMu in-process, rebuildLock in
+// Postgres); a second caller gets errRebuildInProgress.
+func rebuildRecommendations() (RecommendationBuild, error) {
+	var build RecommendationBuild
+	if !rebuildMu.TryLock() {
+		return build, errRebuildInProgress
+	}
+	defer rebuildMu.Unlock()
+	started := time.Now()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return build, err
+	}
+	defer tx.Rollback()
+
+	// ถือ lock ตั้งแต่ก่อนอ่านข้อมูล replica อื่นจะไม่ DELETE/COPY ซ้อนกันจน primary key ชน
+	var locked bool
+	if err := tx.QueryRow("SELECT pg_try_advisory_xact_lock($1)", rebuildLock).Scan(&locked); err != nil {
+		return build, err
+	}
+	if !locked {
+		return build, errRebuildInProgress
+	}
+
+	books, signals, err := loadRecommendationInputs(recommendationWindowDays())
+	if err != nil {
+		return build, err
+	}
+	related := computeRelated(books, signals, relatedPerBook)
+	recommendations := computeUserRecommendations(signals, related, recommendationsPerUser)
+
+	if _, err := tx.Exec("DELETE FROM related_books"); err != nil {
+		return build, err
+	}
+	stmt, err := tx.Prepare(pq.CopyIn("related_books", "book_id", "related_book_id", "score", "reasons"))
+	if err != nil {
+		return build, err
+	}
+	for bookID, list := range related {
+		for _, r := range list {
+			if _, err := stmt.Exec(bookID, r.BookID, r.Score, pq.Array(r.Reasons)); err != nil {
+				stmt.Close()
+				return build, err
+			}
+			build.RelatedPairs++
+		}
+	}
+	if _, err := stmt.Exec(); err != nil {
+		stmt.Close()
+		return build, err
+	}
+	stmt.Close()
+
+	if _, err := tx.Exec("DELETE FROM user_recommendations"); err != nil {
+		return build, err
+	}
+	stmt, err = tx.Prepare(pq.CopyIn("user_recommendations", "user_id", "book_id", "score", "because_book_id", "reasons"))
+	if err != nil {
+		return build, err
+	}
+	for userID, list := range recommendations {
+		for _, r := range list {
+			because := sql.NullInt64{Int64: int64(r.BecauseBookID), Valid: r.BecauseBookID != 0}
+			if _, err := stmt.Exec(userID, r.BookID, r.Score, because, pq.Array(r.Reasons)); err != nil {
+				stmt.Close()
+				return build, err
+			}
+			build.UserRecommendations++
+		}
+	}
+	if _, err := stmt.Exec(); err != nil {
+		stmt.Close()
+		return build, err
+	}
+	stmt.Close()
+
+	if err := tx.Commit(); err != nil {
+		return build, err
+	}
+
+	users := map[int]bool{}
+	for _, s := range signals {
+		users[s.UserID] = true
+	}
+	build.Books = len(books)
+	build.Users = len(users)
+	build.DurationMS = time.Since(started).Milliseconds()
+	return build, nil
+}
+
+// startRecommendationBuilder rebuilds recommendations once at startup and
+// then every recommendation interval.
+func startRecommendationBuilder() {
+	interval := recommendationInterval()
+	go func() {
+		for {
+			build, err := rebuildRecommendations()
+			switch {
+			case errors.Is(err, errRebuildInProgress):
+				// staff หรือ replica อื่นกำลัง rebuild อยู่ รอบนี้ข้ามไป
+			case err != nil:
+				log.Printf("recommendation rebuild failed: %v", err)
+			default:
+				log.Printf("recommendations rebuilt: %d related pairs, %d user recommendations in %dms",
+					build.RelatedPairs, build.UserRecommendations, build.DurationMS)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// ===================== Recommendation Data =====================
+// scanRecommendedBooks อ่านแถวที่ขึ้นต้นด้วย recommendedBookColumns ตามด้วย score, reasons, because_book_id
+// และ computed_at ที่ใหม่ที่สุดของรายการ
+func scanRecommendedBooks(rows *sql.Rows) ([]RecommendedBook, *time.Time, error) {
+	defer rows.Close()
+	items := []RecommendedBook{}
+	var computedAt *time.Time
+	for rows.Next() {
+		var b RecommendedBook
+		var because sql.NullInt64
+		var at sql.NullTime
+		if err := rows.Scan(&b.BookID, &b.Title, &b.Author, &b.CoverImage, &b.Price, &b.Rating,
+			&b.Score, pq.Array(&b.Reasons), &because, &at); err != nil {
+			return nil, nil, err
+		}
+		if because.Valid {
+			id := int(because.Int64)
+			b.BecauseBookID = &id
+		}
+		if at.Valid && (computedAt == nil || at.Time.After(*computedAt)) {
+			computedAt = &at.Time
+		}
+		items = append(items, b)
+	}
+	return items, computedAt, rows.Err()
+}
+
+// parseRecommendationLimit อ่าน ?limit= ค่าเริ่มต้น 10
+func parseRecommendationLimit(c *gin.Context, max int) (int, bool) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 || limit > max {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(max)})
+		return 0, false
+	}
+	return limit, true
+}
+
+// ===================== Recommendation Handlers =====================
+// @Summary Get related books
+// @Description Customers also viewed, plus books by the same author or in the same category. Falls back to same author/category (source=similar) until the builder has covered the book.
+// @Tags Recommendations
+// @Produce json
+// @Param id path int true "Book ID"
+// @Param limit query int false "1-20 (default 10)"
+// @Success 200 {object} RecommendationList
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /books/{id}/related [get]
+// @security ApiKeyAuth
+func getRelatedBooks(c *gin.Context) {
+	bookID, ok := parseBookID(c)
+	if !ok {
+		return
+	}
+	limit, ok := parseRecommendationLimit(c, relatedPerBook)
+	if !ok {
+		return
+	}
+
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM books WHERE id = $1 AND deleted_at IS NULL)", bookID).Scan(&exists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "book not found"})
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT `+recommendedBookColumns+`, r.score, r.reasons, NULL::int, r.computed_at
+		FROM related_books r
+		JOIN books b ON b.id = r.related_book_id AND b.deleted_at IS NULL
+		WHERE r.book_id = $1
+		ORDER BY r.score DESC, b.id
+		LIMIT $2
+	`, bookID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	items, computedAt, err := scanRecommendedBooks(rows)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(items) > 0 {
+		c.JSON(http.StatusOK, RecommendationList{Source: "computed", ComputedAt: computedAt, Items: items})
+		return
+	}
+
+	// หนังสือใหม่ที่ job ยังไม่ได้คำนวณ ใช้ผู้แต่งเดียวกันก่อนแล้วตามด้วยหมวดเดียวกัน
+	rows, err = db.Query(`
+		SELECT `+recommendedBookColumns+`, 0::float8,
+		       CASE WHEN LOWER(b.author) = LOWER(src.author) THEN '{same_author}'::text[] ELSE '{same_category}'::text[] END,
+		       NULL::int, NULL::timestamp
+		FROM books src
+		JOIN books b ON b.id <> src.id AND b.deleted_at IS NULL
+		 AND (LOWER(b.author) = LOWER(src.author) OR b.category_id = src.category_id)
+		WHERE src.id = $1
+		ORDER BY LOWER(b.author) = LOWER(src.author) DESC, b.rating DESC NULLS LAST, b.id
+		LIMIT $2
+	`, bookID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	items, _, err = scanRecommendedBooks(rows)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, RecommendationList{Source: "similar", Items: items})
+}
+
+// @Summary Get my recommendations
+// @Description Books picked from what you viewed, bought and reviewed, recomputed every few hours. Users without history get the featured books (source=featured).
+// @Tags Recommendations
+// @Produce json
+// @Param limit query int false "1-50 (default 10)"
+// @Success 200 {object} RecommendationList
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /me/recommendations [get]
+// @security ApiKeyAuth
+func getMyRecommendations(c *gin.Context) {
+	limit, ok := parseRecommendationLimit(c, recommendationsPerUser)
+	if !ok {
+		return
+	}
+	userID := c.GetInt("user_id")
+
+	// ตัดเล่มที่ซื้อหรือรีวิวไปหลังจาก job รันครั้งล่าสุดออกด้วย
+	rows, err := db.Query(`
+		SELECT `+recommendedBookColumns+`, r.score, r.reasons, r.because_book_id, r.computed_at
+		FROM user_recommendations r
+		JOIN books b ON b.id = r.book_id AND b.deleted_at IS NULL
+		WHERE r.user_id = $1
+		  AND NOT EXISTS (SELECT 1 FROM reviews rv WHERE rv.user_id = $1 AND rv.book_id = b.id)
+		  AND NOT EXISTS (
+			SELECT 1 FROM orders o JOIN order_items oi ON oi.order_id = o.id
+			WHERE o.user_id = $1 AND oi.book_id = b.id AND o.status IN `+purchasedOrderStatusSQL+`
+		  )
+		ORDER BY r.score DESC, b.id
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	items, computedAt, err := scanRecommendedBooks(rows)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(items) > 0 {
+		c.JSON(http.StatusOK, RecommendationList{Source: "personalized", ComputedAt: computedAt, Items: items})
+		return
+	}
+
+	// cold start: เงื่อนไขเดียวกับ GET /api/v1/books/featured ของ week11-assignment
+	rows, err = db.Query(`
+		SELECT ` + recommendedBookColumns + `, 0::float8, '{}'::text[], NULL::int, NULL::timestamp
+		FROM books b
+		WHERE b.rating >= 4.0 AND b.deleted_at IS NULL
+		ORDER BY b.rating DESC, b.reviews DESC
+		LIMIT 10
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	items, _, err = scanRecommendedBooks(rows)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	c.JSON(http.StatusOK, RecommendationList{Source: "featured", Items: items})
+}
+
+// @Summary Rebuild recommendations now
+// @Description Runs the recommendation builder immediately instead of waiting for the next scheduled run
+// @Tags Recommendations
+// @Produce json
+// @Success 200 {object} RecommendationBuild
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /staff/recommendations/rebuild [post]
+// @security ApiKeyAuth
+func rebuildRecommendationsNow(c *gin.Context) {
+	build, err := rebuildRecommendations()
+	if errors.Is(err, errRebuildInProgress) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	logAudit(c.GetInt("user_id"), "rebuild", "recommendations", nil, gin.H{
+		"related_pairs":        build.RelatedPairs,
+		"user_recommendations": build.UserRecommendations,
+	}, c)
+
+	c.JSON(http.StatusOK, build)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// ===================== Recommendation Engine =====================
+// ไม่แตะ database เหมือน promotions engine ข้อมูลทั้งหมดส่งเข้ามา job เป็นคนอ่านและเขียนผล
+
+// recBook คือข้อมูลหนังสือที่ใช้หาความคล้าย
+type recBook struct {
+	ID         int
+	Author     string
+	CategoryID int // 0 = ไม่มีหมวด
+	Rating     float64
+}
+
+// userSignal รวมทุกอย่างที่ user หนึ่งคนทำกับหนังสือเล่มหนึ่งในช่วงเวลาที่ดู
+type userSignal struct {
+	UserID    int
+	BookID    int
+	ViewDays  int // จำนวนวันที่เปิดดู
+	Purchased bool
+	Rating    int // 0 = ไม่ได้รีวิว
+}
+
+// scoredBook is a candidate book with its score and why it was picked.
+type scoredBook struct {
+	BookID        int
+	Score         float64
+	Reasons       []string // customers_also_viewed, same_author, same_category
+	BecauseBookID int      // เฉพาะคำแนะนำของ user: หนังสือในประวัติที่ทำให้ได้เล่มนี้มากที่สุด
+}
+
+const (
+	coOccurrenceWeight = 1.0
+	sameAuthorWeight   = 0.5
+	sameCategoryWeight = 0.2
+	maxGroupPeers      = 50 // ผู้แต่งหรือหมวดที่มีหนังสือเยอะ ดูแค่เล่มที่ rating สูงสุดเท่านี้ กันคู่เยอะเกิน
+	maxUserHistory     = 50 // user ที่มีประวัติเยอะ ใช้แค่เล่มที่สนใจมากที่สุดเท่านี้
+)
+
+// signalWeight บอกว่า user สนใจหนังสือแค่ไหน ซื้อ > รีวิวดี > เปิดดู รีวิวแย่ติดลบ
+func signalWeight(s userSignal) float64 {
+	w := float64(min(s.ViewDays, 3))
+	if s.Purchased {
+		w += 5
+	}
+	switch {
+	case s.Rating >= 4:
+		w += 4
+	case s.Rating == 3:
+		w++
+	case s.Rating > 0:
+		w -= 3
+	}
+	return w
+}
+
+func normalizeAuthor(author string) string {
+	return strings.ToLower(strings.Join(strings.Fields(author), " "))
+}
+
+type weightedBook struct {
+	bookID int
+	weight float64
+}
+
+// positiveHistories groups the signals by user, keeping only books the
+// user liked (positive weight) that are still in the catalog.
+func positiveHistories(signals []userSignal, exists map[int]bool) map[int][]weightedBook {
+	byUser := map[int][]weightedBook{}
+	for _, s := range signals {
+		if w := signalWeight(s); w > 0 && exists[s.BookID] {
+			byUser[s.UserID] = append(byUser[s.UserID], weightedBook{s.BookID, w})
+		}
+	}
+	for user, history := range byUser {
+		sort.Slice(history, func(i, j int) bool {
+			if history[i].weight != history[j].weight {
+				return history[i].weight > history[j].weight
+			}
+			return history[i].bookID < history[j].bookID
+		})
+		if len(history) > maxUserHistory {
+			byUser[user] = history[:maxUserHistory]
+		}
+	}
+	return byUser
+}
+
+// computeRelated scores every pair of books and keeps the best limit per
+// book. Books liked by the same users score by a cosine-style overlap
+// (0 to 1) of those users' weights; sharing an author or a category adds
+// a fixed amount, and rating breaks ties.
+func computeRelated(books []recBook, signals []userSignal, limit int) map[int][]scoredBook {
+	exists := map[int]bool{}
+	for _, b := range books {
+		exists[b.ID] = true
+	}
+
+	type pair struct{ a, b int }
+	scores := map[pair]*scoredBook{}
+	add := func(a, b int, score float64, reason string) {
+		p := pair{a, b}
+		s, ok := scores[p]
+		if !ok {
+			s = &scoredBook{BookID: b}
+			scores[p] = s
+		}
+		s.Score += score
+		s.Reasons = append(s.Reasons, reason)
+	}
+
+	// co-occurrence
+	norms := map[int]float64{}
+	overlap := map[pair]float64{}
+	for _, history := range positiveHistories(signals, exists) {
+		for i, x := range history {
+			norms[x.bookID] += x.weight
+			for _, y := range history[i+1:] {
+				shared := math.Min(x.weight, y.weight)
+				overlap[pair{x.bookID, y.bookID}] += shared
+				overlap[pair{y.bookID, x.bookID}] += shared
+			}
+		}
+	}
+	for p, shared := range overlap {
+		add(p.a, p.b, coOccurrenceWeight*shared/math.Sqrt(norms[p.a]*norms[p.b]), "customers_also_viewed")
+	}
+
+	// ผู้แต่งเดียวกันและหมวดเดียวกัน
+	byRating := append([]recBook(nil), books...)
+	sort.SliceStable(byRating, func(i, j int) bool { return byRating[i].Rating > byRating[j].Rating })
+	authors := map[string][]int{}
+	categories := map[int][]int{}
+	for _, b := range byRating {
+		if author := normalizeAuthor(b.Author); author != "" && len(authors[author]) < maxGroupPeers {
+			authors[author] = append(authors[author], b.ID)
+		}
+		if b.CategoryID != 0 && len(categories[b.CategoryID]) < maxGroupPeers {
+			categories[b.CategoryID] = append(categories[b.CategoryID], b.ID)
+		}
+	}
+	for _, ids := range authors {
+		for _, a := range ids {
+			for _, b := range ids {
+				if a != b {
+					add(a, b, sameAuthorWeight, "same_author")
+				}
+			}
+		}
+	}
+	for _, ids := range categories {
+		for _, a := range ids {
+			for _, b := range ids {
+				if a != b {
+					add(a, b, sameCategoryWeight, "same_category")
+				}
+			}
+		}
+	}
+
+	rating := map[int]float64{}
+	for _, b := range books {
+		rating[b.ID] = b.Rating
+	}
+	related := map[int][]scoredBook{}
+	for p, s := range scores {
+		s.Score += rating[p.b] / 500
+		related[p.a] = append(related[p.a], *s)
+	}
+	for id, list := range related {
+		related[id] = topScored(list, limit)
+	}
+	return related
+}
+
+// computeUserRecommendations scores books for each user from the books
+// they liked: every liked book passes its weight on to its related books.
+// Books the user already bought or reviewed are left out.
+func computeUserRecommendations(signals []userSignal, related map[int][]scoredBook, limit int) map[int][]scoredBook {
+	exists := map[int]bool{}
+	for id := range related {
+		exists[id] = true
+	}
+	done := map[int]map[int]bool{}
+	for _, s := range signals {
+		if s.Purchased || s.Rating > 0 {
+			if done[s.UserID] == nil {
+				done[s.UserID] = map[int]bool{}
+			}
+			done[s.UserID][s.BookID] = true
+		}
+	}
+
+	recommendations := map[int][]scoredBook{}
+	for user, history := range positiveHistories(signals, exists) {
+		candidates := map[int]*scoredBook{}
+		best := map[int]float64{} // คะแนนจากหนังสือในประวัติที่ให้มากที่สุด
+		for _, h := range history {
+			for _, r := range related[h.bookID] {
+				if done[user][r.BookID] {
+					continue
+				}
+				c, ok := candidates[r.BookID]
+				if !ok {
+					c = &scoredBook{BookID: r.BookID}
+					candidates[r.BookID] = c
+				}
+				contribution := h.weight * r.Score
+				c.Score += contribution
+				if contribution > best[r.BookID] {
+					best[r.BookID] = contribution
+					c.BecauseBookID = h.bookID
+					c.Reasons = r.Reasons
+				}
+			}
+		}
+		list := make([]scoredBook, 0, len(candidates))
+		for _, c := range candidates {
+			list = append(list, *c)
+		}
+		if len(list) > 0 {
+			recommendations[user] = topScored(list, limit)
+		}
+	}
+	return recommendations
+}
+
+// topScored เรียงคะแนนมากไปน้อย (เท่ากันเอา id น้อยก่อน ผลจะเหมือนเดิมทุกครั้ง) แล้วตัดเหลือ limit
+func topScored(list []scoredBook, limit int) []scoredBook {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Score != list[j].Score {
+			return list[i].Score > list[j].Score
+		}
+		return list[i].BookID < list[j].BookID
+	})
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===================== Review Models =====================
+type Review struct {
+	ID          int        `json:"id"`
+	BookID      int        `json:"book_id"`
+	UserID      int        `json:"user_id"`
+	Username    string     `json:"username"`
+	Rating      int        `json:"rating"`
+	Title       string     `json:"title,omitempty"`
+	Body        string     `json:"body,omitempty"`
+	Status      string     `json:"status"` // published, hidden
+	ModeratedBy *int       `json:"moderated_by,omitempty"`
+	ModeratedAt *time.Time `json:"moderated_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+type ReviewRequest struct {
+	Rating int    `json:"rating" binding:"required,min=1,max=5"`
+	Title  string `json:"title" binding:"max=200"`
+	Body   string `json:"body" binding:"max=5000"`
+}
+
+type ReviewStatusRequest struct {
+	Status string `json:"status" binding:"required,oneof=published hidden"`
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+type ReviewList struct {
+	BookID  int      `json:"book_id"`
+	Rating  float64  `json:"rating"`
+	Count   int      `json:"count"` // จำนวนรีวิวที่ published (ตรงกับ books.reviews)
+	Reviews []Review `json:"reviews"`
+}
+
+const reviewSelect = `
+	SELECT r.id, r.book_id, r.user_id, u.username, r.rating, COALESCE(r.title, ''), COALESCE(r.body, ''),
+	       r.status, r.moderated_by, r.moderated_at, r.created_at, r.updated_at
+	FROM reviews r
+	JOIN users u ON u.id = r.user_id`
+
+func scanReview(row interface{ Scan(...interface{}) error }) (Review, error) {
+	var r Review
+	err := row.Scan(&r.ID, &r.BookID, &r.UserID, &r.Username, &r.Rating, &r.Title, &r.Body,
+		&r.Status, &r.ModeratedBy, &r.ModeratedAt, &r.CreatedAt, &r.UpdatedAt)
+	return r, err
+}
+
+// lockReviewedBook ล็อกแถวหนังสือไว้จนจบ transaction ให้การเขียนรีวิวของเล่มเดียวกันทำทีละรายการ
+// ค่าเฉลี่ยที่ refreshBookRating คำนวณจะได้ไม่ตกหล่นรีวิวที่เขียนพร้อมกัน
+func lockReviewedBook(tx *sql.Tx, bookID int) error {
+	var id int
+	return tx.QueryRow("SELECT id FROM books WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", bookID).Scan(&id)
+}
+
+// refreshBookRating recomputes books.rating and books.reviews from the
+// published reviews, or restores the seeded values (book_rating_seeds,
+// migration7) when the book has none. Call it in the same transaction as
+// the review change.
+// version is not bumped: the counters aren't an edit, so editors holding an
+// ETag for the book don't get a 412 because someone left a review. The
+// ETag still changes (it hashes the whole book), so cached GETs refresh.
+func refreshBookRating(tx *sql.Tx, bookID int) error {
+	_, err := tx.Exec(`
+		WITH published AS (
+			SELECT ROUND(AVG(rating), 2) AS rating, COUNT(*) AS reviews
+			FROM reviews WHERE book_id = $1 AND status = 'published'
+		)
+		UPDATE books b
+		SET rating = CASE WHEN p.reviews > 0 THEN p.rating ELSE COALESCE(s.rating, 0) END,
+		    reviews = CASE WHEN p.reviews > 0 THEN p.reviews ELSE COALESCE(s.reviews, 0) END
+		FROM published p
+		LEFT JOIN book_rating_seeds s ON s.book_id = $1
+		WHERE b.id = $1
+	`, bookID)
+	return err
+}
+
+// withReviewedBook runs fn in a transaction holding the lock on bookID and
+// refreshes the book's rating afterwards. Missing books return sql.ErrNoRows.
+func withReviewedBook(userID, bookID int, fn func(tx *sql.Tx) error) error {
+	return withActingUser(userID, func(tx *sql.Tx) error {
+		if err := lockReviewedBook(tx, bookID); err != nil {
+			return err
+		}
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return refreshBookRating(tx, bookID)
+	})
+}
+
+func parseBookID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "book not found"})
+		return 0, false
+	}
+	return id, true
+}
+
+// ===================== Review Handlers =====================
+// @Summary List reviews of a book
+// @Description Published reviews, newest first. Users with reviews:moderate can pass status=hidden or status=all.
+// @Tags Reviews
+// @Produce json
+// @Param id path int true "Book ID"
+// @Param status query string false "published (default), hidden or all"
+// @Success 200 {object} ReviewList
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /books/{id}/reviews [get]
+// @security ApiKeyAuth
+func listReviews(c *gin.Context) {
+	bookID, ok := parseBookID(c)
+	if !ok {
+		return
+	}
+
+	status := c.DefaultQuery("status", "published")
+	switch status {
+	case "published":
+	case "hidden", "all":
+		if !checkUserPermission(c.GetInt("user_id"), "reviews:moderate") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions", "required": "reviews:moderate"})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be published, hidden or all"})
+		return
+	}
+
+	list := ReviewList{BookID: bookID, Reviews: []Review{}}
+	err := db.QueryRow("SELECT COALESCE(rating, 0), COALESCE(reviews, 0) FROM books WHERE id = $1 AND deleted_at IS NULL", bookID).
+		Scan(&list.Rating, &list.Count)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "book not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := db.Query(reviewSelect+`
+		WHERE r.book_id = $1 AND ($2 = 'all' OR r.status = $2)
+		ORDER BY r.created_at DESC, r.id DESC
+	`, bookID, status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r, err := scanReview(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		list.Reviews = append(list.Reviews, r)
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// @Summary Write a review
+// @Description Each user can review a book once; use PUT to change it.
+// @Tags Reviews
+// @Accept json
+// @Produce json
+// @Param id path int true "Book ID"
+// @Param review body ReviewRequest true "Review"
+// @Success 201 {object} Review
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} ValidationErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /books/{id}/reviews [post]
+// @security ApiKeyAuth
+func createReview(c *gin.Context) {
+	bookID, ok := parseBookID(c)
+	if !ok {
+		return
+	}
+	var req ReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	var review Review
+	err := withReviewedBook(userID, bookID, func(tx *sql.Tx) error {
+		var id int
+		err := tx.QueryRow(`
+			INSERT INTO reviews (book_id, user_id, rating, title, body)
+			VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''))
+			RETURNING id
+		`, bookID, userID, req.Rating, req.Title, req.Body).Scan(&id)
+		if err != nil {
+			return err
+		}
+		review, err = scanReview(tx.QueryRow(reviewSelect+" WHERE r.id = $1", id))
+		return err
+	})
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "book not found"})
+		return
+	} else if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "you have already reviewed this book, use PUT to update it"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	logAudit(userID, "create", "reviews", review.ID, gin.H{
+		"book_id": bookID,
+		"rating":  review.Rating,
+	}, c)
+
+	c.JSON(http.StatusCreated, review)
+}
+
+// @Summary Update my review
+// @Description Replace the caller's review of the book. A hidden review stays hidden.
+// @Tags Reviews
+// @Accept json
+// @Produce json
+// @Param id path int true "Book ID"
+// @Param review body ReviewRequest true "Review"
+// @Success 200 {object} Review
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ValidationErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /books/{id}/reviews [put]
+// @security ApiKeyAuth
+func updateReview(c *gin.Context) {
+	bookID, ok := parseBookID(c)
+	if !ok {
+		return
+	}
+	var req ReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	var review Review
+	err := withReviewedBook(userID, bookID, func(tx *sql.Tx) error {
+		var id int
+		err := tx.QueryRow(`
+			UPDATE reviews
+			SET rating = $3, title = NULLIF($4, ''), body = NULLIF($5, ''), updated_at = NOW()
+			WHERE book_id = $1 AND user_id = $2
+			RETURNING id
+		`, bookID, userID, req.Rating, req.Title, req.Body).Scan(&id)
+		if err != nil {
+			return err
+		}
+		review, err = scanReview(tx.QueryRow(reviewSelect+" WHERE r.id = $1", id))
+		return err
+	})
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "review not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	logAudit(userID, "update", "reviews", review.ID, gin.H{
+		"book_id": bookID,
+		"rating":  review.Rating,
+	}, c)
+
+	c.JSON(http.StatusOK, review)
+}
+
+// @Summary Delete my review
+// @Tags Reviews
+// @Produce json
+// @Param id path int true "Book ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /books/{id}/reviews [delete]
+// @security ApiKeyAuth
+func deleteReview(c *gin.Context) {
+	bookID, ok := parseBookID(c)
+	if !ok {
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	var reviewID int
+	err := withReviewedBook(userID, bookID, func(tx *sql.Tx) error {
+		return tx.QueryRow("DELETE FROM reviews WHERE book_id = $1 AND user_id = $2 RETURNING id", bookID, userID).Scan(&reviewID)
+	})
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "review not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	logAudit(userID, "delete", "reviews", reviewID, gin.H{"book_id": bookID}, c)
+
+	c.JSON(http.StatusOK, gin.H{"message": "review deleted successfully"})
+}
+
+// @Summary Moderate a review
+// @Description Hide a review (removes it from the book's rating) or publish it again
+// @Tags Reviews
+// @Accept json
+// @Produce json
+// @Param id path int true "Book ID"
+// @Param review_id path int true "Review ID"
+// @Param status body ReviewStatusRequest true "New status"
+// @Success 200 {object} Review
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ValidationErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /books/{id}/reviews/{review_id}/status [put]
+// @security ApiKeyAuth
+func moderateReview(c *gin.Context) {
+	bookID, ok := parseBookID(c)
+	if !ok {
+		return
+	}
+	var req ReviewStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	reviewID, err := strconv.Atoi(c.Param("review_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "review not found"})
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	var review Review
+	var previous string
+	err = withReviewedBook(userID, bookID, func(tx *sql.Tx) error {
+		err := tx.QueryRow("SELECT status FROM reviews WHERE id = $1 AND book_id = $2 FOR UPDATE",
+			reviewID, bookID).Scan(&previous)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			UPDATE reviews SET status = $1, moderated_by = $2, moderated_at = NOW()
+			WHERE id = $3
+		`, req.Status, userID, reviewID)
+		if err != nil {
+			return err
+		}
+		review, err = scanReview(tx.QueryRow(reviewSelect+" WHERE r.id = $1", reviewID))
+		return err
+	})
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "review not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	logAudit(userID, "moderate", "reviews", review.ID, gin.H{
+		"book_id": bookID,
+		"from":    previous,
+		"to":      review.Status,
+		"reason":  req.Reason,
+	}, c)
+
+	c.JSON(http.StatusOK, review)
+}
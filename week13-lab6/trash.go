@@ -0,0 +1,213 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// ===================== Trash Model =====================
+type TrashedBook struct {
+	Book
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+// trashRetention อ่านจาก TRASH_RETENTION_DAYS (ค่าเริ่มต้น 30 วัน)
+func trashRetention() time.Duration {
+	days, err := strconv.Atoi(getEnv("TRASH_RETENTION_DAYS", "30"))
+	if err != nil || days < 1 {
+		log.Printf("invalid TRASH_RETENTION_DAYS, using 30 days")
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// ===================== Trash Handlers =====================
+// @Summary List trashed books
+// @Description List soft-deleted books, most recently deleted first
+// @Tags Books
+// @Produce json
+// @Success 200 {array} TrashedBook
+// @Failure 500 {object} ErrorResponse
+// @Router /books/trash [get]
+// @security ApiKeyAuth
+func listTrash(c *gin.Context) {
+	rows, err := db.Query(`
+		SELECT id, title, author, COALESCE(isbn, ''), COALESCE(year, 0), price, created_at, updated_at, deleted_at
+		FROM books
+		WHERE deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	retention := trashRetention()
+	books := []TrashedBook{}
+	for rows.Next() {
+		var b TrashedBook
+		if err := rows.Scan(&b.ID, &b.Title, &b.Author, &b.ISBN, &b.Year, &b.Price,
+			&b.CreatedAt, &b.UpdatedAt, &b.DeletedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		b.PurgeAt = b.DeletedAt.Add(retention)
+		books = append(books, b)
+	}
+
+	c.JSON(http.StatusOK, books)
+}
+
+// @Summary Restore a trashed book
+// @Tags Books
+// @Produce json
+// @Param id path int true "Book ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /books/{id}/restore [post]
+// @security ApiKeyAuth
+func restoreBook(c *gin.Context) {
+	id := c.Param("id")
+
+	var rowsAffected int64
+	userID := c.GetInt("user_id")
+	err := withActingUser(userID, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`
+			UPDATE books SET deleted_at = NULL, updated_at = NOW(), version = version + 1
+			WHERE id = $1 AND deleted_at IS NOT NULL
+		`, id)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "book not found in trash"})
+		return
+	}
+
+	logAudit(userID, "restore", "books", id, nil, c)
+
+	c.JSON(http.StatusOK, gin.H{"message": "book restored successfully"})
+}
+
+// ===================== Trash Purge Job =====================
+// trashPurgeLock คือ key ของ advisory lock ให้ purge รันทีละ instance แม้มีหลาย replica
+const trashPurgeLock = 130006
+
+type purgedBook struct {
+	id        int
+	title     string
+	deletedAt time.Time
+}
+
+// purgeTrash ลบถาวรหนังสือที่อยู่ในถังขยะนานเกิน retention และไม่มีของเหลือในสต็อก
+// ถ้า instance อื่นถือ lock อยู่ (กำลัง purge) รอบนี้ข้ามไป
+func purgeTrash(retention time.Duration) {
+	purged, err := purgeTrashLocked(time.Now().Add(-retention))
+	if err != nil {
+		log.Printf("trash purge failed: %v", err)
+		return
+	}
+	for _, b := range purged {
+		logAudit(0, "purge", "books", b.id, gin.H{
+			"title":      b.title,
+			"deleted_at": b.deletedAt,
+		}, nil)
+	}
+}
+
+func purgeTrashLocked(cutoff time.Time) ([]purgedBook, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// xact lock ปล่อยเองตอนจบ transaction ไม่ค้างอยู่กับ connection ใน pool
+	var locked bool
+	if err := tx.QueryRow("SELECT pg_try_advisory_xact_lock($1)", trashPurgeLock).Scan(&locked); err != nil {
+		return nil, err
+	}
+	if !locked {
+		return nil, nil
+	}
+
+	// เล่มที่ยังมีของในสต็อกไม่ purge ต้องตัดสต็อก (adjust) ให้เป็น 0 ก่อน ไม่งั้นยอดคงคลังจะหายไปเฉยๆ
+	// ประวัติ stock_movements และรีวิวยังอยู่ โดย book_id กลายเป็น NULL (migration7, migration8)
+	rows, err := tx.Query(`
+		SELECT b.id FROM books b
+		LEFT JOIN inventory i ON i.book_id = b.id
+		WHERE b.deleted_at IS NOT NULL AND b.deleted_at < $1 AND COALESCE(i.quantity, 0) = 0
+		FOR UPDATE OF b
+	`, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	// inventory อ้าง books แบบ RESTRICT (week11 migration 012) ต้องลบแถวสต็อก 0 ก่อน
+	if _, err := tx.Exec("DELETE FROM inventory WHERE book_id = ANY($1)", pq.Array(ids)); err != nil {
+		return nil, err
+	}
+	rows, err = tx.Query("DELETE FROM books WHERE id = ANY($1) RETURNING id, title, deleted_at", pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var purged []purgedBook
+	for rows.Next() {
+		var b purgedBook
+		if err := rows.Scan(&b.id, &b.title, &b.deletedAt); err != nil {
+			return nil, err
+		}
+		purged = append(purged, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	return purged, tx.Commit()
+}
+
+// startTrashPurger runs purgeTrash once at startup and then every hour.
+func startTrashPurger() {
+	retention := trashRetention()
+	go func() {
+		for {
+			purgeTrash(retention)
+			time.Sleep(time.Hour)
+		}
+	}()
+}
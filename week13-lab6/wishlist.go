@@ -0,0 +1,628 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===================== Wishlist Models =====================
+type WishlistItem struct {
+	BookID         int       `json:"book_id"`
+	Title          string    `json:"title"`
+	Author         string    `json:"author"`
+	CoverImage     string    `json:"cover_image,omitempty"`
+	Price          Money     `json:"price"`
+	OriginalPrice  Money     `json:"original_price,omitempty"`
+	Discount       int       `json:"discount,omitempty"`
+	PriceWhenAdded Money     `json:"price_when_added"`
+	PriceDrop      Money     `json:"price_drop,omitempty"` // ถูกลงเท่าไรตั้งแต่เพิ่มเข้า wishlist
+	Available      int       `json:"available"`
+	Unavailable    bool      `json:"unavailable,omitempty"` // หนังสืออยู่ในถังขยะ
+	Note           string    `json:"note,omitempty"`
+	Notify         bool      `json:"notify"`
+	AddedAt        time.Time `json:"added_at"`
+}
+
+type WishlistRequest struct {
+	BookID int    `json:"book_id" binding:"required,gt=0"`
+	Note   string `json:"note" binding:"max=500"`
+	Notify *bool  `json:"notify"` // ไม่ส่ง = true
+}
+
+// WishlistUpdateRequest แก้เฉพาะ field ที่ส่งมา
+type WishlistUpdateRequest struct {
+	Note   *string `json:"note" binding:"omitempty,max=500"`
+	Notify *bool   `json:"notify"`
+}
+
+// Notification คือข้อความที่เข้าคิวไว้ส่งให้ user
+type Notification struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	BookID    *int       `json:"book_id,omitempty"`
+	Kind      string     `json:"kind"` // price_drop, price_increase, back_in_stock
+	Subject   string     `json:"subject"`
+	Body      string     `json:"body"`
+	Status    string     `json:"status"` // pending, sending, sent, failed
+	Attempts  int        `json:"attempts"`
+	LastError string     `json:"last_error,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	SentAt    *time.Time `json:"sent_at,omitempty"`
+}
+
+// ===================== Wishlist Changes =====================
+// bookSnapshot คือราคาและสต็อกที่ user เห็นล่าสุด เก็บไว้ใน wishlist_items เทียบกับค่าปัจจุบัน
+type bookSnapshot struct {
+	Price    Money
+	Discount int
+	InStock  bool
+}
+
+// wishlistChange decides which notification, if any, a change from
+// before to after deserves. Coming back in stock wins over a price change
+// in the same check; going out of stock isn't worth a message.
+func wishlistChange(before, after bookSnapshot) string {
+	switch {
+	case after.InStock && !before.InStock:
+		return "back_in_stock"
+	case after.Price < before.Price || after.Price == before.Price && after.Discount > before.Discount:
+		return "price_drop"
+	case after.Price > before.Price || after.Discount < before.Discount:
+		return "price_increase"
+	}
+	return ""
+}
+
+// wishlistMessage เขียนหัวข้อและเนื้อหาของการแจ้งเตือน
+func wishlistMessage(kind, title string, before, after bookSnapshot) (string, string) {
+	currency := paymentCurrency()
+	price := after.Price.Format() + " " + currency
+	if after.Discount > 0 {
+		price += fmt.Sprintf(" (%d%% off)", after.Discount)
+	}
+	var subject, body string
+	switch kind {
+	case "back_in_stock":
+		subject = "Back in stock: " + title
+		body = fmt.Sprintf("%s is back in stock at %s.", title, price)
+	case "price_drop":
+		subject = "Price drop: " + title
+		body = fmt.Sprintf("%s is now %s, down from %s %s.", title, price, before.Price.Format(), currency)
+	default:
+		subject = "Price change: " + title
+		body = fmt.Sprintf("%s is now %s, was %s %s.", title, price, before.Price.Format(), currency)
+	}
+	return subject, body + "\n\nYou are receiving this because the book is on your wishlist. " +
+		"Turn off notify for the book in your wishlist to stop these messages.\n"
+}
+
+// checkWishlists compares every wishlisted book with the snapshot taken
+// the last time it was checked and queues a notification for each change
+// that deserves one. The snapshot moves forward either way, so each
+// change is reported once.
+func checkWishlists() {
+	rows, err := db.Query(`
+		SELECT w.user_id, w.book_id, b.title, w.notify,
+		       w.last_price, w.last_discount, w.last_in_stock,
+		       b.price, COALESCE(b.discount, 0), COALESCE(i.quantity, 0) > 0
+		FROM wishlist_items w
+		JOIN books b ON b.id = w.book_id AND b.deleted_at IS NULL
+		LEFT JOIN inventory i ON i.book_id = b.id
+		WHERE b.price <> w.last_price
+		   OR COALESCE(b.discount, 0) <> w.last_discount
+		   OR (COALESCE(i.quantity, 0) > 0) <> w.last_in_stock
+		ORDER BY w.book_id, w.user_id
+	`)
+	if err != nil {
+		log.Printf("wishlist check failed: %v", err)
+		return
+	}
+	type change struct {
+		userID, bookID int
+		title          string
+		notify         bool
+		before, after  bookSnapshot
+	}
+	var changes []change
+	for rows.Next() {
+		var ch change
+		if err := rows.Scan(&ch.userID, &ch.bookID, &ch.title, &ch.notify,
+			&ch.before.Price, &ch.before.Discount, &ch.before.InStock,
+			&ch.after.Price, &ch.after.Discount, &ch.after.InStock); err != nil {
+			rows.Close()
+			log.Printf("wishlist check failed: %v", err)
+			return
+		}
+		changes = append(changes, ch)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Printf("wishlist check failed: %v", err)
+		return
+	}
+
+	queued := 0
+	for _, ch := range changes {
+		ok, err := recordWishlistChange(ch.userID, ch.bookID, ch.title, ch.notify, ch.before, ch.after)
+		if err != nil {
+			log.Printf("wishlist check failed for user %d book %d: %v", ch.userID, ch.bookID, err)
+			continue
+		}
+		if ok {
+			queued++
+		}
+	}
+	if queued > 0 {
+		log.Printf("queued %d wishlist notifications", queued)
+	}
+}
+
+// recordWishlistChange moves one snapshot forward and queues its
+// notification in the same transaction. The update only matches the
+// snapshot that was read, so a concurrent check can't queue it twice.
+func recordWishlistChange(userID, bookID int, title string, notify bool, before, after bookSnapshot) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE wishlist_items
+		SET last_price = $3, last_discount = $4, last_in_stock = $5
+		WHERE user_id = $1 AND book_id = $2
+		  AND last_price = $6 AND last_discount = $7 AND last_in_stock = $8
+	`, userID, bookID, after.Price, after.Discount, after.InStock, before.Price, before.Discount, before.InStock)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return false, nil
+	}
+
+	kind := wishlistChange(before, after)
+	if !notify || kind == "" {
+		return false, tx.Commit()
+	}
+	subject, body := wishlistMessage(kind, title, before, after)
+	_, err = tx.Exec(`
+		INSERT INTO notifications (user_id, book_id, kind, subject, body)
+		VALUES ($1, $2, $3, $4, $5)
+	`, userID, bookID, kind, subject, body)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// ===================== Notification Delivery =====================
+const maxNotificationAttempts = 5
+
+var sender notifier
+
+// notificationLease คือเวลาที่แถวที่ claim แล้วเป็นของ instance นั้น ถ้า instance ตายระหว่างส่ง
+// แถวยังเป็น sending อยู่ เมื่อพ้นเวลานี้ instance อื่นจะ claim ไปส่งต่อ
+// ต้องนานกว่าการส่งหนึ่งชุด (notificationBatch x timeout 30 วินาที)
+const (
+	notificationBatch = 10
+	notificationLease = 10 * time.Minute
+)
+
+// deliverNotifications sends queued notifications that are due through
+// the configured notifier, a batch at a time. Each batch is claimed first
+// (status sending, SKIP LOCKED), so replicas running the same job never
+// pick up the same row. A failed send is retried later with a growing
+// delay and given up after maxNotificationAttempts.
+func deliverNotifications() {
+	for {
+		due, err := claimNotifications()
+		if err != nil {
+			log.Printf("notification delivery failed: %v", err)
+			return
+		}
+		if len(due) == 0 {
+			return
+		}
+		for _, p := range due {
+			sendNotification(p)
+		}
+	}
+}
+
+type claimedNotification struct {
+	id, attempts int
+	msg          notificationMessage
+}
+
+func claimNotifications() ([]claimedNotification, error) {
+	rows, err := db.Query(`
+		UPDATE notifications n
+		SET status = 'sending', next_attempt_at = NOW() + $2 * INTERVAL '1 second'
+		FROM users u
+		WHERE u.id = n.user_id
+		  AND n.id IN (
+			SELECT id FROM notifications
+			WHERE status IN ('pending', 'sending') AND next_attempt_at <= NOW()
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		  )
+		RETURNING n.id, n.subject, n.body, n.attempts, COALESCE(u.email, ''), u.username
+	`, notificationBatch, int(notificationLease.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []claimedNotification
+	for rows.Next() {
+		var p claimedNotification
+		if err := rows.Scan(&p.id, &p.msg.Subject, &p.msg.Body, &p.attempts, &p.msg.To, &p.msg.Username); err != nil {
+			return nil, err
+		}
+		due = append(due, p)
+	}
+	return due, rows.Err()
+}
+
+// sendNotification ส่งหนึ่งฉบับที่ claim ไว้แล้วบันทึกผล ถ้าบันทึกไม่สำเร็จแถวจะค้างเป็น sending
+// จนพ้น lease แล้วถูกส่งซ้ำ จึงต้อง log ไว้ให้เห็น
+func sendNotification(p claimedNotification) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	err := sender.Send(ctx, p.msg)
+	cancel()
+
+	if err == nil {
+		_, err := db.Exec(`
+			UPDATE notifications SET status = 'sent', attempts = attempts + 1, sent_at = NOW(), last_error = NULL
+			WHERE id = $1 AND status = 'sending'
+		`, p.id)
+		if err != nil {
+			log.Printf("notification %d was sent but could not be marked sent, it may be sent again: %v", p.id, err)
+		}
+		return
+	}
+
+	attempts := p.attempts + 1
+	status := "pending"
+	if attempts >= maxNotificationAttempts || err == errNoRecipient {
+		status = "failed"
+	}
+	log.Printf("notification %d via %s failed (attempt %d): %v", p.id, sender.Name(), attempts, err)
+	// รอ 1, 4, 9, 16 นาทีก่อนลองใหม่
+	_, dbErr := db.Exec(`
+		UPDATE notifications
+		SET status = $2, attempts = $3, last_error = $4, next_attempt_at = NOW() + $5 * INTERVAL '1 minute'
+		WHERE id = $1 AND status = 'sending'
+	`, p.id, status, attempts, err.Error(), attempts*attempts)
+	if dbErr != nil {
+		log.Printf("notification %d: could not record failed attempt: %v", p.id, dbErr)
+	}
+}
+
+// notifyInterval อ่านจาก NOTIFY_INTERVAL_MINUTES (ค่าเริ่มต้น 5 นาที)
+func notifyInterval() time.Duration {
+	minutes, err := strconv.Atoi(getEnv("NOTIFY_INTERVAL_MINUTES", "5"))
+	if err != nil || minutes < 1 {
+		log.Printf("invalid NOTIFY_INTERVAL_MINUTES, using 5 minutes")
+		minutes = 5
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// startWishlistWatcher checks wishlists and delivers what it queued, once
+// at startup and then every notify interval.
+func startWishlistWatcher() {
+	interval := notifyInterval()
+	go func() {
+		for {
+			checkWishlists()
+			deliverNotifications()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// ===================== Wishlist Data =====================
+func loadWishlist(userID int) ([]WishlistItem, error) {
+	rows, err := db.Query(`
+		SELECT b.id, b.title, b.author, COALESCE(b.cover_image, ''),
+		       b.price, COALESCE(b.original_price, 0), COALESCE(b.discount, 0),
+		       w.added_price, COALESCE(i.quantity, 0), b.deleted_at IS NOT NULL,
+		       COALESCE(w.note, ''), w.notify, w.added_at
+		FROM wishlist_items w
+		JOIN books b ON b.id = w.book_id
+		LEFT JOIN inventory i ON i.book_id = b.id
+		WHERE w.user_id = $1
+		ORDER BY w.added_at DESC, b.id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []WishlistItem{}
+	for rows.Next() {
+		var item WishlistItem
+		if err := rows.Scan(&item.BookID, &item.Title, &item.Author, &item.CoverImage,
+			&item.Price, &item.OriginalPrice, &item.Discount,
+			&item.PriceWhenAdded, &item.Available, &item.Unavailable,
+			&item.Note, &item.Notify, &item.AddedAt); err != nil {
+			return nil, err
+		}
+		if item.Price < item.PriceWhenAdded {
+			item.PriceDrop = item.PriceWhenAdded - item.Price
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func respondWishlist(c *gin.Context, status int) {
+	items, err := loadWishlist(c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(status, items)
+}
+
+func parseWishlistBookID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("book_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "book is not in the wishlist"})
+		return 0, false
+	}
+	return id, true
+}
+
+// ===================== Wishlist Handlers =====================
+// @Summary Get my wishlist
+// @Description Newest first, with current price, stock and how much the price dropped since the book was added
+// @Tags Wishlist
+// @Produce json
+// @Success 200 {array} WishlistItem
+// @Failure 500 {object} ErrorResponse
+// @Router /wishlist [get]
+// @security ApiKeyAuth
+func getWishlist(c *gin.Context) {
+	respondWishlist(c, http.StatusOK)
+}
+
+// @Summary Add a book to my wishlist
+// @Description Adding a book that is already on the wishlist updates its note and notify setting
+// @Tags Wishlist
+// @Accept json
+// @Produce json
+// @Param item body WishlistRequest true "Book, note and whether to be notified"
+// @Success 201 {array} WishlistItem
+// @Success 200 {array} WishlistItem
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ValidationErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /wishlist [post]
+// @security ApiKeyAuth
+func addWishlistItem(c *gin.Context) {
+	var req WishlistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	notify := true
+	if req.Notify != nil {
+		notify = *req.Notify
+	}
+
+	// snapshot เริ่มจากราคาและสต็อกตอนนี้ จะแจ้งเตือนเฉพาะสิ่งที่เปลี่ยนหลังจากนี้
+	var inserted bool
+	err := db.QueryRow(`
+		INSERT INTO wishlist_items (user_id, book_id, note, notify, added_price, last_price, last_discount, last_in_stock)
+		SELECT $1, b.id, NULLIF($3, ''), $4, b.price, b.price, COALESCE(b.discount, 0), COALESCE(i.quantity, 0) > 0
+		FROM books b LEFT JOIN inventory i ON i.book_id = b.id
+		WHERE b.id = $2 AND b.deleted_at IS NULL
+		ON CONFLICT (user_id, book_id) DO UPDATE
+		SET note = EXCLUDED.note, notify = EXCLUDED.notify, updated_at = NOW()
+		RETURNING xmax = 0 -- xmax เป็น 0 เฉพาะแถวที่เพิ่ง insert
+	`, c.GetInt("user_id"), req.BookID, req.Note, notify).Scan(&inserted)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "book not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	status := http.StatusOK
+	if inserted {
+		status = http.StatusCreated
+	}
+	respondWishlist(c, status)
+}
+
+// @Summary Update a wishlist item
+// @Tags Wishlist
+// @Accept json
+// @Produce json
+// @Param book_id path int true "Book ID"
+// @Param item body WishlistUpdateRequest true "Fields to change"
+// @Success 200 {array} WishlistItem
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ValidationErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /wishlist/{book_id} [put]
+// @security ApiKeyAuth
+func updateWishlistItem(c *gin.Context) {
+	bookID, ok := parseWishlistBookID(c)
+	if !ok {
+		return
+	}
+	var req WishlistUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	var note string
+	if req.Note != nil {
+		note = *req.Note
+	}
+	result, err := db.Exec(`
+		UPDATE wishlist_items
+		SET note = CASE WHEN $3 THEN NULLIF($4, '') ELSE note END,
+		    notify = COALESCE($5, notify),
+		    updated_at = NOW()
+		WHERE user_id = $1 AND book_id = $2
+	`, c.GetInt("user_id"), bookID, req.Note != nil, note, req.Notify)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "book is not in the wishlist"})
+		return
+	}
+	respondWishlist(c, http.StatusOK)
+}
+
+// @Summary Remove a book from my wishlist
+// @Tags Wishlist
+// @Produce json
+// @Param book_id path int true "Book ID"
+// @Success 200 {array} WishlistItem
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /wishlist/{book_id} [delete]
+// @security ApiKeyAuth
+func removeWishlistItem(c *gin.Context) {
+	bookID, ok := parseWishlistBookID(c)
+	if !ok {
+		return
+	}
+	result, err := db.Exec("DELETE FROM wishlist_items WHERE user_id = $1 AND book_id = $2", c.GetInt("user_id"), bookID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "book is not in the wishlist"})
+		return
+	}
+	respondWishlist(c, http.StatusOK)
+}
+
+// ===================== Notification Handlers =====================
+const notificationSelect = `
+	SELECT id, user_id, book_id, kind, subject, body, status, attempts, COALESCE(last_error, ''), created_at, sent_at
+	FROM notifications`
+
+func respondNotifications(c *gin.Context, userID int) {
+	status := c.Query("status")
+	if status != "" && status != "pending" && status != "sending" && status != "sent" && status != "failed" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending, sending, sent or failed"})
+		return
+	}
+	rows, err := db.Query(notificationSelect+`
+		WHERE ($1 = 0 OR user_id = $1) AND ($2 = '' OR status = $2)
+		ORDER BY id DESC
+		LIMIT 100
+	`, userID, status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	list := []Notification{}
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(&n.ID, &n.UserID, &n.BookID, &n.Kind, &n.Subject, &n.Body, &n.Status,
+			&n.Attempts, &n.LastError, &n.CreatedAt, &n.SentAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		list = append(list, n)
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// @Summary List my notifications
+// @Description Latest 100, newest first
+// @Tags Wishlist
+// @Produce json
+// @Param status query string false "pending, sending, sent or failed"
+// @Success 200 {array} Notification
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /notifications [get]
+// @security ApiKeyAuth
+func listMyNotifications(c *gin.Context) {
+	respondNotifications(c, c.GetInt("user_id"))
+}
+
+// @Summary List all notifications
+// @Description Latest 100 across all users, newest first. Use status=failed to find undelivered ones.
+// @Tags Wishlist
+// @Produce json
+// @Param status query string false "pending, sending, sent or failed"
+// @Success 200 {array} Notification
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /staff/notifications [get]
+// @security ApiKeyAuth
+func listAllNotifications(c *gin.Context) {
+	respondNotifications(c, 0)
+}
+
+// @Summary Retry a failed notification
+// @Description Puts the notification back in the queue; it goes out on the next delivery run
+// @Tags Wishlist
+// @Produce json
+// @Param id path int true "Notification ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /staff/notifications/{id}/retry [post]
+// @security ApiKeyAuth
+func retryNotification(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "notification not found"})
+		return
+	}
+
+	var status string
+	err = db.QueryRow("SELECT status FROM notifications WHERE id = $1", id).Scan(&status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "notification not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if status != "failed" {
+		c.JSON(http.StatusConflict, gin.H{"error": "only failed notifications can be retried", "status": status})
+		return
+	}
+
+	_, err = db.Exec(`
+		UPDATE notifications SET status = 'pending', attempts = 0, next_attempt_at = NOW()
+		WHERE id = $1 AND status = 'failed'
+	`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	logAudit(c.GetInt("user_id"), "retry", "notifications", id, nil, c)
+	c.JSON(http.StatusOK, gin.H{"message": "notification queued for retry"})
+}